@@ -0,0 +1,74 @@
+package gice
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// backupMagic is the first line of a backup file, followed by a line with the
+// JSON-encoded Backup header and the raw flash content.
+const backupMagic = "gice backup 1\n"
+
+// Backup is the header of a flash dump written by WriteBackup.
+type Backup struct {
+	FlashID string    `json:"flash_id"`        // JEDEC ID in hex
+	Flash   string    `json:"flash,omitempty"` // name of the flash, if known
+	Size    int       `json:"size"`            // number of bytes dumped
+	Time    time.Time `json:"time"`
+	SHA256  string    `json:"sha256"` // of the dumped bytes, in hex
+}
+
+// IsBackup reports whether data starts like a file written by WriteBackup.
+func IsBackup(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(backupMagic))
+}
+
+// WriteBackup writes the flash content data with the header b to w. The size
+// and checksum of b are set from data.
+func WriteBackup(w io.Writer, b Backup, data []byte) error {
+	sum := sha256.Sum256(data)
+	b.Size = len(data)
+	b.SHA256 = hex.EncodeToString(sum[:])
+	hdr, err := json.Marshal(b)
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, backupMagic); err != nil {
+		return err
+	}
+	if _, err := w.Write(append(hdr, '\n')); err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// ReadBackup parses a file written by WriteBackup, checking the size and
+// checksum of the content against its header.
+func ReadBackup(data []byte) (Backup, []byte, error) {
+	b := Backup{}
+	if !IsBackup(data) {
+		return b, nil, errors.New("not a gice backup")
+	}
+	hdr, content, ok := bytes.Cut(data[len(backupMagic):], []byte{'\n'})
+	if !ok {
+		return b, nil, errors.New("backup header truncated")
+	}
+	if err := json.Unmarshal(hdr, &b); err != nil {
+		return b, nil, fmt.Errorf("backup header: %w", err)
+	}
+	if len(content) != b.Size {
+		return b, nil, fmt.Errorf("backup holds %d bytes, header says %d", len(content), b.Size)
+	}
+	sum := sha256.Sum256(content)
+	if hex.EncodeToString(sum[:]) != b.SHA256 {
+		return b, nil, errors.New("backup checksum mismatch")
+	}
+	return b, content, nil
+}
@@ -0,0 +1,252 @@
+package bitstream
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+var bitstreamPreamble = []byte{0x7E, 0xAA, 0x99, 0x7E}
+
+// Errors that callers can test for with errors.Is.
+var (
+	ErrNoPreamble = errors.New("no bitstream preamble found")
+	ErrTruncated  = fmt.Errorf("truncated bitstream: %w", io.ErrUnexpectedEOF)
+)
+
+var errMultibootEntry = errors.New("multiboot header entry")
+
+// Info describes an iCE40 bitstream image. [bitstream-format]
+type Info struct {
+	Offset  int    // offset of the image, including its comment
+	Size    int    // size of the image in bytes
+	Comment string // comment lines separated by '\n'
+}
+
+// Parse finds the first bitstream in buf, skipping multiboot header
+// entries, and determines its extent by walking through its commands. The
+// configuration data itself is not decoded.
+func Parse(buf []byte) (*Info, error) {
+	from := 0
+	for {
+		i := bytes.Index(buf[from:], bitstreamPreamble)
+		if i < 0 {
+			return nil, ErrNoPreamble
+		}
+		preamble := from + i
+
+		end, err := parseBitstreamCommands(buf[preamble:])
+		if errors.Is(err, errMultibootEntry) {
+			from = preamble + len(bitstreamPreamble)
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("bitstream at 0x%X: %w", preamble, err)
+		}
+
+		info := &Info{
+			Offset: preamble,
+			Size:   end,
+		}
+		if start, comment, ok := findComment(buf[:preamble]); ok {
+			info.Offset = start
+			info.Size += preamble - start
+			info.Comment = comment
+		}
+		return info, nil
+	}
+}
+
+// FindAll returns all the bitstreams in buf, skipping multiboot header
+// entries and damaged images. The offsets are relative to buf.
+func FindAll(buf []byte) []Info {
+	var found []Info
+	for from := 0; ; {
+		info, err := Parse(buf[from:])
+		if errors.Is(err, ErrNoPreamble) {
+			return found
+		}
+		if err != nil {
+			// Look for the next image after the preamble of the damaged one
+			from += bytes.Index(buf[from:], bitstreamPreamble) + len(bitstreamPreamble)
+			continue
+		}
+		info.Offset += from
+		found = append(found, *info)
+		from = info.Offset + info.Size
+	}
+}
+
+// SetComment returns a copy of the bitstream img with its comment
+// replaced by comment. Lines are separated by '\n'. The comment is not covered
+// by the bitstream CRC.
+func SetComment(img []byte, comment string) ([]byte, error) {
+	if strings.ContainsAny(comment, "\x00\xFF") {
+		return nil, errors.New("comment must not contain 0x00 or 0xFF bytes")
+	}
+	info, err := Parse(img)
+	if err != nil {
+		return nil, err
+	}
+	preamble := bytes.Index(img[info.Offset:], bitstreamPreamble) + info.Offset
+
+	out := make([]byte, 0, len(img)+len(comment)+4)
+	out = append(out, img[:info.Offset]...)
+	out = append(out, 0xFF, 0x00)
+	out = append(out, strings.ReplaceAll(comment, "\n", "\x00")...)
+	out = append(out, 0x00, 0xFF)
+	out = append(out, img[preamble:]...)
+	return out, nil
+}
+
+// findComment looks for the comment field FF 00 ... 00 FF immediately before
+// the preamble and returns its offset and content.
+func findComment(buf []byte) (start int, comment string, ok bool) {
+	if !bytes.HasSuffix(buf, []byte{0x00, 0xFF}) {
+		return 0, "", false
+	}
+	start = bytes.LastIndexByte(buf[:len(buf)-2], 0xFF)
+	if start < 0 || buf[start+1] != 0x00 {
+		return 0, "", false
+	}
+	body := buf[start+2 : len(buf)-2]
+	return start, string(bytes.ReplaceAll(body, []byte{0}, []byte{'\n'})), true
+}
+
+// parseBitstreamCommands walks through the commands following the preamble at
+// the beginning of buf and returns the length up to the wakeup command,
+// including the trailing padding byte written by icepack. It checks the CRC
+// and that every CRAM bank is written with a size matching a known device.
+func parseBitstreamCommands(buf []byte) (int, error) {
+	i := len(bitstreamPreamble)
+	width, height, bank := 0, 0, 0
+	crcStart := -1
+	crc, crcAt := uint16(crcInit), 0 // CRC of buf[crcStart:crcAt]
+	cramBanks := [4]bool{}
+	crcChecked := false
+	for {
+		if i >= len(buf) {
+			return 0, ErrTruncated
+		}
+		cmdAt := i
+		cmd, n := buf[i]>>4, int(buf[i]&0x0F)
+		if i+1+n > len(buf) {
+			return 0, ErrTruncated
+		}
+		payload := buf[i+1 : i+1+n]
+		i += 1 + n
+
+		switch cmd {
+		case 0x0:
+			if n != 1 {
+				return 0, fmt.Errorf("invalid opcode length %d at 0x%X", n, cmdAt)
+			}
+			switch payload[0] {
+			case 0x01, 0x03: // write CRAM / BRAM data
+				if width == 0 || height == 0 || width*height%8 != 0 {
+					return 0, fmt.Errorf("invalid bank size %dx%d at 0x%X", width, height, cmdAt)
+				}
+				if payload[0] == 0x01 {
+					if !knownCRAMSize(width, height) {
+						return 0, fmt.Errorf("CRAM bank size %dx%d at 0x%X matches no known device", width, height, cmdAt)
+					}
+					cramBanks[bank] = true
+				}
+				size := width * height / 8
+				if i+size+2 > len(buf) {
+					return 0, ErrTruncated
+				}
+				i += size
+				if buf[i] != 0x00 || buf[i+1] != 0x00 {
+					return 0, fmt.Errorf("missing end of bank data at 0x%X", i)
+				}
+				i += 2
+			case 0x05: // reset CRC
+				crcStart = i
+				crc, crcAt = crcInit, i
+			case 0x06: // wakeup
+				if cramBanks != [4]bool{true, true, true, true} {
+					return 0, errors.New("not all CRAM banks are written")
+				}
+				if !crcChecked {
+					return 0, errors.New("missing CRC check")
+				}
+				if i < len(buf) && buf[i] == 0x00 {
+					i++
+				}
+				return i, nil
+			case 0x08: // reboot
+				return 0, errMultibootEntry
+			default:
+				return 0, fmt.Errorf("unknown opcode 0x%02X at 0x%X", payload[0], cmdAt)
+			}
+		case 0x1: // bank number
+			bank = int(be16(payload))
+			if bank >= len(cramBanks) {
+				return 0, fmt.Errorf("bank number %d out of range at 0x%X", bank, cmdAt)
+			}
+		case 0x2: // CRC check
+			if crcStart < 0 {
+				return 0, fmt.Errorf("CRC check without CRC reset at 0x%X", cmdAt)
+			}
+			// Continue from the previous check, so that repeated checks
+			// do not compute the CRC from the reset again
+			for _, b := range buf[crcAt : cmdAt+1] {
+				crc = updateCRC(crc, b)
+			}
+			crcAt = cmdAt + 1
+			if want := be16(payload); crc != want {
+				return 0, fmt.Errorf("CRC mismatch at 0x%X: computed %04X, stored %04X", cmdAt, crc, want)
+			}
+			crcChecked = true
+		case 0x6: // bank width
+			width = int(be16(payload)) + 1
+		case 0x7: // bank height
+			height = int(be16(payload))
+		case 0x4, 0x5, 0x8, 0x9:
+			// boot address, frequency range, bank offset, feature flags
+		default:
+			return 0, fmt.Errorf("unknown command 0x%02X at 0x%X", buf[cmdAt], cmdAt)
+		}
+	}
+}
+
+// knownCRAMSize reports whether a CRAM bank of the size belongs to a known
+// device. Odd banks of the 5k are shorter.
+func knownCRAMSize(width, height int) bool {
+	for _, d := range knownFPGAs {
+		if d.cramWidth != width {
+			continue
+		}
+		if height == d.cramHeight || d.kind == ice5K && height == d.cramHeight/2+8 {
+			return true
+		}
+	}
+	return false
+}
+
+// Check validates every bitstream in img, e.g. the images of a multiboot
+// layout. Data without any bitstream preamble is accepted as is.
+func Check(img []byte) error {
+	for off := 0; ; {
+		info, err := Parse(img[off:])
+		if errors.Is(err, ErrNoPreamble) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("at 0x%X: %w", off, err)
+		}
+		off += info.Offset + info.Size
+	}
+}
+
+// be16 decodes a big-endian value of up to 2 bytes.
+func be16(b []byte) uint16 {
+	v := uint16(0)
+	for _, c := range b {
+		v = v<<8 | uint16(c)
+	}
+	return v
+}
@@ -0,0 +1,101 @@
+package bitstream
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/gentam/gice/board"
+)
+
+// packed returns the bitstream packed from the ASCII bitstream src.
+func packed(t testing.TB, src string) []byte {
+	t.Helper()
+	var out bytes.Buffer
+	p := Packer{}
+	if err := p.Pack(&out, strings.NewReader(src)); err != nil {
+		t.Fatal(err)
+	}
+	return out.Bytes()
+}
+
+func FuzzParse(f *testing.F) {
+	img := packed(f, ".comment fuzz\n.device 1k\n")
+	f.Add(img)
+	f.Add(img[:len(img)/2])
+	f.Add(append(NewMultibootHeader(board.Generic).Bytes(), img...))
+	f.Add(bitstreamPreamble)
+	f.Add([]byte{})
+	f.Fuzz(func(t *testing.T, buf []byte) {
+		if info, err := Parse(buf); err == nil {
+			if info.Offset < 0 || info.Size <= 0 || info.Offset+info.Size > len(buf) {
+				t.Fatalf("bitstream at 0x%X of %d bytes outside the %d input bytes", info.Offset, info.Size, len(buf))
+			}
+		}
+		for _, info := range FindAll(buf) {
+			if info.Offset < 0 || info.Offset+info.Size > len(buf) {
+				t.Fatalf("bitstream at 0x%X of %d bytes outside the %d input bytes", info.Offset, info.Size, len(buf))
+			}
+		}
+		Check(buf)
+	})
+}
+
+func FuzzParseMultibootHeader(f *testing.F) {
+	f.Add(NewMultibootHeader(board.Generic).Bytes())
+	f.Add(make([]byte, MultibootHeaderSize))
+	f.Add(bitstreamPreamble)
+	f.Fuzz(func(t *testing.T, buf []byte) {
+		h, err := ParseMultibootHeader(buf)
+		if err != nil {
+			return
+		}
+		got, err := ParseMultibootHeader(h.Bytes())
+		if err != nil {
+			t.Fatalf("re-encoded header: %v", err)
+		}
+		if *got != *h {
+			t.Fatalf("re-encoded header %v, want %v", got, h)
+		}
+	})
+}
+
+func TestCheck(t *testing.T) {
+	img := packed(t, ".comment check\n.device 1k\n")
+	corrupted := bytes.Clone(img)
+	corrupted[len(img)/2] ^= 0x01
+	layout := func(images ...[]byte) []byte {
+		buf := NewMultibootHeader(board.ICEstick).Bytes()
+		for i, img := range images {
+			buf = append(buf, bytes.Repeat([]byte{0xFF}, board.ICEstick.SlotAddr(i)-len(buf))...)
+			buf = append(buf, img...)
+		}
+		return buf
+	}
+	tests := []struct {
+		name string
+		img  []byte
+		err  error // nil for any error
+		ok   bool
+	}{
+		{name: "valid", img: img, ok: true},
+		{name: "multiboot layout", img: layout(img, img), ok: true},
+		{name: "no bitstream", img: []byte("user data"), ok: true},
+		{name: "corrupted", img: corrupted},
+		{name: "truncated", img: img[:len(img)/2], err: ErrTruncated},
+		{name: "corrupted second image", img: layout(img, corrupted)},
+		{name: "truncated second image", img: layout(img, img[:len(img)-10]), err: ErrTruncated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Check(tt.img)
+			if (err == nil) != tt.ok {
+				t.Fatalf("Check = %v, want ok %v", err, tt.ok)
+			}
+			if tt.err != nil && !errors.Is(err, tt.err) {
+				t.Errorf("Check = %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
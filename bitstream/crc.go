@@ -1,4 +1,4 @@
-package gice
+package bitstream
 
 import "io"
 
@@ -0,0 +1,8 @@
+// Package bitstream parses, checks and packs iCE40 bitstream images and builds
+// the multiboot header selecting between them.
+//
+// # References:
+//
+//   - [bitstream-format]: Bitstream File Format Documentation (https://github.com/YosysHQ/icestorm/blob/master/docs/source/format.rst)
+//   - [icepack]: icepack.cc (https://github.com/YosysHQ/icestorm/blob/master/icepack/icepack.cc)
+package bitstream
@@ -1,4 +1,4 @@
-package gice
+package bitstream
 
 type fpgaDevice struct {
 	kind       deviceKind
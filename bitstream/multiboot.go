@@ -0,0 +1,173 @@
+package bitstream
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/gentam/gice/board"
+)
+
+// Multiboot header layout, as produced by icemulti:
+//
+//	7E AA 99 7E     preamble
+//	92 00 FF        boot mode (0x10: cold boot, select image with CBSEL pins)
+//	44 03 AA AA AA  boot address (24-bit, MSB first)
+//	82 00 00        bank offset
+//	01 08           reboot
+//	00 ...          padding up to 32 bytes
+//
+// The header holds 5 such entries: the power-on image followed by the 4 warm
+// boot images selected with SB_WARMBOOT S1/S0.
+const (
+	multibootEntrySize  = 32
+	multibootEntries    = 5
+	MultibootHeaderSize = multibootEntrySize * multibootEntries
+
+	// MultibootSlots is the number of warm boot slots.
+	MultibootSlots = multibootEntries - 1
+)
+
+// BootEntry is a single jump vector of the multiboot header.
+type BootEntry struct {
+	ColdBoot bool // cold boot flag; only meaningful for the power-on entry
+	Addr     int  // flash address of the bitstream
+}
+
+// MultibootHeader holds the power-on entry and the 4 warm boot entries.
+type MultibootHeader struct {
+	PowerOn BootEntry
+	Slots   [MultibootSlots]BootEntry
+}
+
+// NewMultibootHeader returns a header laying out the warm boot slots
+// SlotSize apart as described by the board profile. The power-on entry
+// points to slot 0.
+func NewMultibootHeader(b *board.Board) *MultibootHeader {
+	h := &MultibootHeader{}
+	for i := range h.Slots {
+		h.Slots[i].Addr = b.SlotAddr(i)
+	}
+	h.PowerOn.Addr = h.Slots[0].Addr
+	return h
+}
+
+// ParseMultibootHeader parses the multiboot header at the beginning of buf.
+func ParseMultibootHeader(buf []byte) (*MultibootHeader, error) {
+	if len(buf) < MultibootHeaderSize {
+		return nil, fmt.Errorf("multiboot header requires %d bytes, got %d", MultibootHeaderSize, len(buf))
+	}
+
+	h := &MultibootHeader{}
+	for i := range multibootEntries {
+		e, err := parseBootEntry(buf[i*multibootEntrySize : (i+1)*multibootEntrySize])
+		if err != nil {
+			return nil, fmt.Errorf("entry %d: %w", i, err)
+		}
+		if i == 0 {
+			h.PowerOn = e
+		} else {
+			h.Slots[i-1] = e
+		}
+	}
+	return h, nil
+}
+
+func parseBootEntry(b []byte) (BootEntry, error) {
+	if !bytes.HasPrefix(b, bitstreamPreamble) {
+		return BootEntry{}, errors.New("missing preamble")
+	}
+	b = b[len(bitstreamPreamble):]
+	if b[0] != 0x92 || b[1] != 0x00 {
+		return BootEntry{}, fmt.Errorf("unexpected boot mode command %02X %02X", b[0], b[1])
+	}
+	if b[3] != 0x44 || b[4] != 0x03 {
+		return BootEntry{}, fmt.Errorf("unexpected boot address command %02X %02X", b[3], b[4])
+	}
+	if !bytes.Equal(b[8:13], []byte{0x82, 0x00, 0x00, 0x01, 0x08}) {
+		return BootEntry{}, errors.New("missing reboot command")
+	}
+	return BootEntry{
+		ColdBoot: b[2]&0x10 != 0,
+		Addr:     int(b[5])<<16 | int(b[6])<<8 | int(b[7]),
+	}, nil
+}
+
+// Bytes returns the binary representation of the header.
+func (h *MultibootHeader) Bytes() []byte {
+	buf := make([]byte, 0, MultibootHeaderSize)
+	for i := range multibootEntries {
+		e := h.PowerOn
+		if i > 0 {
+			e = h.Slots[i-1]
+		}
+		mode := byte(0x00)
+		if e.ColdBoot {
+			mode = 0x10
+		}
+		buf = append(buf, bitstreamPreamble...)
+		buf = append(buf,
+			0x92, 0x00, mode,
+			0x44, 0x03, byte(e.Addr>>16), byte(e.Addr>>8), byte(e.Addr),
+			0x82, 0x00, 0x00,
+			0x01, 0x08,
+		)
+		buf = append(buf, make([]byte, (i+1)*multibootEntrySize-len(buf))...)
+	}
+	return buf
+}
+
+// Retarget points warm boot slot n (0-3) to addr.
+func (h *MultibootHeader) Retarget(slot, addr int) error {
+	if slot < 0 || slot >= MultibootSlots {
+		return fmt.Errorf("slot %d out of range [0, %d]", slot, MultibootSlots-1)
+	}
+	if addr < MultibootHeaderSize || addr > 1<<24-1 {
+		return fmt.Errorf("address 0x%X out of range", addr)
+	}
+	h.Slots[slot].Addr = addr
+	return nil
+}
+
+// String lists the jump vectors of the header.
+func (h *MultibootHeader) String() string {
+	b := strings.Builder{}
+	fmt.Fprintf(&b, "power-on: 0x%06X", h.PowerOn.Addr)
+	if h.PowerOn.ColdBoot {
+		b.WriteString(" (cold boot)")
+	}
+	for i, e := range h.Slots {
+		fmt.Fprintf(&b, "\nslot %d:   0x%06X", i, e.Addr)
+	}
+	return b.String()
+}
+
+// PatchMultibootImage retargets warm boot slot n of the multiboot image img to
+// addr in place, leaving the other vectors and the images untouched.
+func PatchMultibootImage(img []byte, slot, addr int) error {
+	h, err := ParseMultibootHeader(img)
+	if err != nil {
+		return err
+	}
+	if err := h.Retarget(slot, addr); err != nil {
+		return err
+	}
+	copy(img, h.Bytes())
+	return nil
+}
+
+// Dedicated reports whether the slot has a valid vector that is not shared
+// with another warm boot slot.
+func (h *MultibootHeader) Dedicated(slot int) bool {
+	addr := h.Slots[slot].Addr
+	if addr < MultibootHeaderSize {
+		return false
+	}
+	for i, e := range h.Slots {
+		if i != slot && e.Addr == addr {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,115 @@
+package bitstream
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/gentam/gice/board"
+)
+
+func TestNewMultibootHeader(t *testing.T) {
+	tests := []struct {
+		board *board.Board
+		slots [MultibootSlots]int
+	}{
+		{board.ICEstick, [MultibootSlots]int{0x10000, 0x20000, 0x30000, 0x40000}},
+		{board.ICEBreaker, [MultibootSlots]int{0x20000, 0x40000, 0x60000, 0x80000}},
+		{board.Generic, [MultibootSlots]int{0x40000, 0x80000, 0xC0000, 0x100000}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.board.Name, func(t *testing.T) {
+			h := NewMultibootHeader(tt.board)
+			if h.PowerOn.Addr != tt.slots[0] || h.PowerOn.ColdBoot {
+				t.Errorf("power-on entry %+v, want slot 0 at 0x%X", h.PowerOn, tt.slots[0])
+			}
+			for i, e := range h.Slots {
+				if e.Addr != tt.slots[i] {
+					t.Errorf("slot %d at 0x%X, want 0x%X", i, e.Addr, tt.slots[i])
+				}
+				if !h.Dedicated(i) {
+					t.Errorf("slot %d not dedicated", i)
+				}
+			}
+			got, err := ParseMultibootHeader(h.Bytes())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *got != *h {
+				t.Errorf("parsed %v, want %v", got, h)
+			}
+		})
+	}
+}
+
+func TestRetarget(t *testing.T) {
+	tests := []struct {
+		name       string
+		slot, addr int
+		ok         bool
+	}{
+		{"first slot", 0, 0x20000, true},
+		{"last slot", MultibootSlots - 1, 0xFF0000, true},
+		{"right after the header", 1, MultibootHeaderSize, true},
+		{"last address", 2, 1<<24 - 1, true},
+		{"negative slot", -1, 0x20000, false},
+		{"slot past the last", MultibootSlots, 0x20000, false},
+		{"inside the header", 1, MultibootHeaderSize - 1, false},
+		{"past 24 bits", 1, 1 << 24, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewMultibootHeader(board.ICEBreaker)
+			want := *h
+			err := h.Retarget(tt.slot, tt.addr)
+			if (err == nil) != tt.ok {
+				t.Fatalf("Retarget(%d, 0x%X) = %v, want ok %v", tt.slot, tt.addr, err, tt.ok)
+			}
+			if tt.ok {
+				want.Slots[tt.slot].Addr = tt.addr
+			}
+			if *h != want {
+				t.Errorf("header %v, want %v", h, &want)
+			}
+		})
+	}
+}
+
+func TestPatchMultibootImage(t *testing.T) {
+	b := board.ICEstick
+	bit := packed(t, ".comment patch\n.device 1k\n")
+	img := NewMultibootHeader(b).Bytes()
+	img = append(img, make([]byte, b.SlotAddr(0)-len(img))...)
+	img = append(img, bit...)
+
+	if err := PatchMultibootImage(img, 2, 0x50000); err != nil {
+		t.Fatal(err)
+	}
+	h, err := ParseMultibootHeader(img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := NewMultibootHeader(b)
+	want.Slots[2].Addr = 0x50000
+	if *h != *want {
+		t.Errorf("patched header %v, want %v", h, want)
+	}
+	if !bytes.Equal(img[b.SlotAddr(0):], bit) {
+		t.Errorf("image of slot 0 changed")
+	}
+
+	patched := bytes.Clone(img)
+	for _, slot := range []int{-1, MultibootSlots} {
+		if err := PatchMultibootImage(img, slot, 0x50000); err == nil {
+			t.Errorf("patched slot %d", slot)
+		}
+	}
+	if err := PatchMultibootImage(img, 1, 0x10); err == nil {
+		t.Errorf("patched slot 1 to the header")
+	}
+	if !bytes.Equal(img, patched) {
+		t.Errorf("image changed by a failed patch")
+	}
+	if err := PatchMultibootImage(bit, 0, 0x50000); err == nil {
+		t.Errorf("patched a bitstream without a multiboot header")
+	}
+}
@@ -1,4 +1,4 @@
-package gice
+package bitstream
 
 import (
 	"bufio"
@@ -255,7 +255,7 @@ func (p *Packer) ReadASCII(r io.Reader) error {
 			continue
 
 		default:
-			if cmd[0] == '.' {
+			if strings.HasPrefix(cmd, ".") {
 				return fmt.Errorf("unknown command: %q", cmd)
 			}
 			return fmt.Errorf("unexpected data line: %q", line)
@@ -297,6 +297,9 @@ func (p *Packer) tileCoordInRange(tileX, tileY int) bool {
 
 // [bitstream-format]
 func (p *Packer) WriteBits(w io.Writer) error {
+	if p.device == nil {
+		return fmt.Errorf("missing device information")
+	}
 	cw := newCRCWriter(w)
 	cw.write(0xFF, 0x00) // comment start
 	for _, ch := range p.comment {
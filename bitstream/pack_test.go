@@ -0,0 +1,28 @@
+package bitstream
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func FuzzPack(f *testing.F) {
+	f.Add(".comment fuzz\n.device 1k\n")
+	f.Add(".device 1k\n.logic_tile 1 1\n" + strings.Repeat("0", 54) + "\n")
+	f.Add(".device 8k\n.ram_data 0 1\n" + strings.Repeat("0", 64) + "\n")
+	// Inputs that used to panic
+	f.Add(".comment no device\n")
+	f.Add(" \n")
+	f.Add(".device 1k\n.logic_tile 99 99\n")
+	f.Add(".device 1k\n.io_tile 0 1\nzz\n")
+	f.Fuzz(func(t *testing.T, src string) {
+		var out bytes.Buffer
+		p := Packer{}
+		if err := p.Pack(&out, strings.NewReader(src)); err != nil {
+			return
+		}
+		if err := Check(out.Bytes()); err != nil {
+			t.Fatalf("packed bitstream: %v", err)
+		}
+	})
+}
@@ -0,0 +1,184 @@
+package board
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Board describes how an iCE40 FPGA and its configuration flash are laid out
+// on a supported board.
+type Board struct {
+	Name string
+
+	// SlotSize is the distance between warm boot images in a multiboot flash
+	// layout. Warm boot slot n (0-3) is placed at (n+1)*SlotSize, leaving the
+	// first slot for the multiboot header.
+	SlotSize int
+
+	// CBSel lists the FTDI pins wired to the iCE40 CBSEL0 and CBSEL1 cold boot
+	// selection pins, if any.
+	CBSel []Pin
+
+	// Pins names auxiliary signals wired to FTDI pins, such as power enable or
+	// mode select lines, which are often on ACBUS.
+	Pins map[string]Pin
+
+	// PowerActiveLow inverts the power enable signal SignalPower of Pins.
+	PowerActiveLow bool
+
+	// Channel is the FT2232H channel wired to the flash and the FPGA
+	// configuration pins.
+	Channel Channel
+
+	// Desc lists prefixes of the FTDI EEPROM description string identifying
+	// the board, for Detect.
+	Desc []string
+
+	// Reserved lists flash ranges that must never be erased or programmed,
+	// such as factory calibration data. See flash.Flash.Reserved.
+	Reserved []ReservedRange
+}
+
+// SlotAddr returns the flash address of warm boot slot n (0-3) in the multiboot
+// layout of the board.
+func (b *Board) SlotAddr(slot int) int { return (slot + 1) * b.SlotSize }
+
+// Channel is an interface of the FT2232H.
+type Channel int
+
+const (
+	ChannelA Channel = iota
+	ChannelB
+)
+
+func (c Channel) String() string { return string(rune('A' + c)) }
+
+// ParseChannel parses "A" or "B".
+func ParseChannel(s string) (Channel, error) {
+	switch s {
+	case "A", "a":
+		return ChannelA, nil
+	case "B", "b":
+		return ChannelB, nil
+	}
+	return 0, fmt.Errorf("invalid channel %q", s)
+}
+
+// ReservedRange is a named flash address range [Start, End).
+type ReservedRange struct {
+	Name       string
+	Start, End int
+}
+
+func (r ReservedRange) String() string {
+	s := fmt.Sprintf("0x%06X-0x%06X", r.Start, r.End)
+	if r.Name == "" {
+		return s
+	}
+	return r.Name + " " + s
+}
+
+// SignalPower is the name in Board.Pins of the signal enabling the board power,
+// active high unless Board.PowerActiveLow is set. See gice.Device.PowerCycle.
+const SignalPower = "power"
+
+// Pin identifies an FTDI GPIO by its index in the header: 0-7 are ADBUS0-7 and
+// 8-15 are ACBUS0-7.
+type Pin int
+
+func (p Pin) String() string {
+	if p < 8 {
+		return "ADBUS" + strconv.Itoa(int(p))
+	}
+	return "ACBUS" + strconv.Itoa(int(p)-8)
+}
+
+// ParsePin parses a pin name as returned by Pin.String, e.g. "ADBUS5" or
+// "ACBUS0", or a signal name of the board profile b, which may be nil.
+func (b *Board) ParsePin(s string) (Pin, error) {
+	if b != nil {
+		if p, ok := b.Pins[s]; ok {
+			return p, nil
+		}
+	}
+	return ParsePin(s)
+}
+
+// ParsePin parses a pin name as returned by Pin.String, e.g. "ADBUS5" or
+// "ACBUS0".
+func ParsePin(s string) (Pin, error) {
+	name := strings.ToUpper(s)
+	for prefix, base := range map[string]int{"ADBUS": 0, "ACBUS": 8} {
+		if n, ok := strings.CutPrefix(name, prefix); ok {
+			i, err := strconv.Atoi(n)
+			if err != nil || i < 0 || i > 7 {
+				break
+			}
+			return Pin(base + i), nil
+		}
+	}
+	return 0, fmt.Errorf("invalid pin %q", s)
+}
+
+var (
+	// ICEstick is the Lattice iCEstick (iCE40HX1K, N25Q32). [Lattice-EB82]
+	ICEstick = &Board{
+		Name:     "icestick",
+		SlotSize: 64 << 10, // HX1K bitstream is 32220 bytes
+		Desc:     []string{"Lattice FTUSB Interface Cable", "Lattice FT2232H"},
+	}
+
+	// ICEBreaker is the iCEBreaker (iCE40UP5K, W25Q128). [iCEBreaker]
+	ICEBreaker = &Board{
+		Name:     "icebreaker",
+		SlotSize: 128 << 10, // UP5K bitstream is 104090 bytes
+		Desc:     []string{"iCEBreaker"},
+	}
+
+	// Generic is the fallback for boards that are not recognized. Its
+	// slots fit the largest iCE40 bitstream.
+	Generic = &Board{
+		Name:     "generic",
+		SlotSize: 256 << 10, // HX8K bitstream is 135100 bytes
+	}
+)
+
+var knownBoards = []*Board{
+	ICEstick,
+	ICEBreaker,
+	Generic,
+}
+
+// Lookup returns the board profile with the given name, or nil if there is
+// no such board.
+func Lookup(name string) *Board {
+	for _, b := range knownBoards {
+		if b.Name == name {
+			return b
+		}
+	}
+	return nil
+}
+
+// Names returns the names of all known board profiles.
+func Names() []string {
+	names := make([]string, len(knownBoards))
+	for i, b := range knownBoards {
+		names[i] = b.Name
+	}
+	return names
+}
+
+// Detect returns the board profile matching the FTDI EEPROM description
+// string, e.g. "iCEBreaker V1.0e", or nil if the board is not recognized.
+func Detect(desc string) *Board {
+	for _, b := range knownBoards {
+		for _, prefix := range b.Desc {
+			if strings.HasPrefix(desc, prefix) {
+				return b
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,9 @@
+// Package board describes the iCE40 boards supported by gice: how the FPGA and
+// its configuration flash are wired to the programmer, and where the warm boot
+// images of a multiboot layout go.
+//
+// # References:
+//
+//   - [Lattice-EB82]: iCEstick User Manual (https://www.latticesemi.com/view_document?document_id=50701)
+//   - [iCEBreaker]: iCEBreaker FPGA (https://github.com/icebreaker-fpga/icebreaker/blob/master/hardware/v1.0e/icebreaker-sch.pdf)
+package board
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/gentam/gice"
+)
+
+func backupCommand(args []string) {
+	fs := flag.NewFlagSet("backup", flag.ExitOnError)
+	if err := fs.Parse(args); err != nil {
+		fatalUsage("invalid arguments: %v", err)
+	}
+	if fs.NArg() != 1 {
+		fatalUsage("usage: backup file")
+	}
+	outPath := fs.Arg(0)
+
+	d := openDevice()
+	holdFlash(d)
+	defer closeFlash(d)
+	flashID, name, err := d.Flash.ReadID()
+	if err != nil {
+		fatalf("read flash ID: %v", err)
+	}
+	if name == "" {
+		exitf(exitUnknownFlash, "unknown flash %X; use read -n to dump it", flashID)
+	}
+
+	start := time.Now()
+	data, err := d.Flash.Read(0, d.Flash.Size())
+	if err != nil {
+		fatalf("read flash: %v", err)
+	}
+	out, err := os.Create(outPath)
+	if err != nil {
+		fatalf("create %q: %v", outPath, err)
+	}
+	w := bufio.NewWriter(out)
+	b := gice.Backup{FlashID: fmt.Sprintf("%X", flashID), Flash: name, Time: time.Now().UTC()}
+	if err := gice.WriteBackup(w, b, data); err != nil {
+		fatalf("write backup: %v", err)
+	}
+	if err := w.Flush(); err != nil {
+		fatalf("write backup: %v", err)
+	}
+	if err := out.Close(); err != nil {
+		fatalf("write backup: %v", err)
+	}
+	slog.Info("backed up", "flash", name, "size", len(data), "duration", time.Since(start).Round(time.Millisecond))
+}
+
+func restoreCommand(args []string) {
+	fs := flag.NewFlagSet("restore", flag.ExitOnError)
+	var (
+		force     bool
+		noRelease bool
+	)
+	fs.BoolVar(&force, "force", false, "restore even if the flash ID differs from the backup")
+	fs.BoolVar(&noRelease, "no-release", false, "keep the FPGA in reset after restoring")
+	if err := fs.Parse(args); err != nil {
+		fatalUsage("invalid arguments: %v", err)
+	}
+	if fs.NArg() != 1 {
+		fatalUsage("usage: restore file")
+	}
+	raw, err := os.ReadFile(fs.Arg(0))
+	if err != nil {
+		fatalf("read backup: %v", err)
+	}
+	b, data, err := gice.ReadBackup(raw)
+	if err != nil {
+		fatalf("%q: %v", fs.Arg(0), err)
+	}
+
+	var opts []gice.Option
+	if noRelease {
+		opts = append(opts, gice.WithKeepReset())
+	}
+	d := openDevice(opts...)
+	holdFlash(d)
+	defer closeFlash(d)
+	flashID, name, err := d.Flash.ReadID()
+	if err != nil {
+		fatalf("read flash ID: %v", err)
+	}
+	if id := fmt.Sprintf("%X", flashID); id != b.FlashID && !force {
+		fatalf("flash %s (%s) differs from the backup of %s (%s); use -force to restore anyway", id, name, b.FlashID, b.Flash)
+	}
+	if b.Size > d.Flash.Size() {
+		fatalf("backup of %d bytes exceeds the flash size %d", b.Size, d.Flash.Size())
+	}
+	slog.Info("restoring", "flash", b.Flash, "size", b.Size, "time", b.Time.Local().Format(time.DateTime))
+
+	start := time.Now()
+	if b.Size == d.Flash.Size() {
+		err = d.Flash.EraseChip()
+	} else {
+		err = d.Flash.EraseRegions([]gice.Region{{Addr: 0, Data: data}})
+	}
+	if err != nil {
+		fatalf("erase flash: %v", err)
+	}
+	if err := d.Flash.Write(bytes.NewReader(data)); err != nil {
+		fatalf("write flash: %v", err)
+	}
+	got, err := d.Flash.Read(0, len(data))
+	if err != nil {
+		fatalf("read flash: %v", err)
+	}
+	if sum := sha256.Sum256(got); hex.EncodeToString(sum[:]) != b.SHA256 {
+		exitf(exitVerifyMismatch, "verify failed: flash content differs from the backup")
+	}
+	slog.Info("restored", "duration", time.Since(start).Round(time.Millisecond))
+
+	if err := d.Flash.PowerDown(); err != nil {
+		fatalf("flash power down: %v", err)
+	}
+	if err := d.ReleaseFlash(); err != nil {
+		fatalf("release flash: %v", err)
+	}
+	if noRelease {
+		return
+	}
+	if elapsed, err := d.FinishConfiguration(configTimeout); err != nil {
+		slog.Warn("FPGA not configured", "err", err)
+	} else {
+		slog.Info("configured", "duration", elapsed.Round(time.Microsecond))
+	}
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"time"
+)
+
+func bootCommand(args []string) {
+	fs := flag.NewFlagSet("boot", flag.ExitOnError)
+	var (
+		timeout time.Duration
+	)
+	fs.DurationVar(&timeout, "t", configTimeout, "timeout waiting for CDONE")
+	if err := fs.Parse(args); err != nil {
+		fatalUsage("invalid arguments: %v", err)
+	}
+
+	d := openDevice()
+	defer closeFlash(d)
+
+	if err := d.ReleaseFlash(); err != nil {
+		fatalf("release FPGA reset: %v", err)
+	}
+	elapsed, err := d.FinishConfiguration(timeout)
+	if err != nil {
+		fatalf("boot failed: %v", err)
+	}
+	fmt.Printf("configured in %v\n", elapsed.Round(time.Microsecond))
+}
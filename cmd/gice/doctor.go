@@ -0,0 +1,206 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+
+	"github.com/gentam/gice"
+	"github.com/gentam/gice/board"
+	"github.com/gentam/gice/transport"
+	"periph.io/x/conn/v3/physic"
+	"periph.io/x/d2xx"
+	"periph.io/x/host/v3/ftdi"
+)
+
+// doctor collects the findings of doctorCommand, and of "test all".
+type doctor struct{ failed bool }
+
+func (*doctor) ok(format string, a ...any) { fmt.Printf("ok    "+format+"\n", a...) }
+
+func (*doctor) warn(format string, a ...any) { fmt.Printf("warn  "+format+"\n", a...) }
+
+func (doc *doctor) fail(format string, a ...any) {
+	fmt.Printf("FAIL  "+format+"\n", a...)
+	doc.failed = true
+}
+
+// hint prints an indented suggestion for the previous finding.
+func (*doctor) hint(format string, a ...any) { fmt.Printf("      "+format+"\n", a...) }
+
+func doctorCommand(args []string) {
+	fs := flag.NewFlagSet("doctor", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, `Usage:
+	doctor
+
+Check the FTDI driver, the device and its EEPROM, the FPGA configuration pins
+and the flash at several SPI clocks, and suggest fixes. The FPGA is reset and
+reconfigured from the flash.
+`)
+	}
+	if err := fs.Parse(args); err != nil {
+		fatalUsage("invalid arguments: %v", err)
+	}
+
+	doc := &doctor{}
+	d := doc.device()
+	if d != nil && d.FTDI != nil {
+		doc.eeprom(d)
+	}
+	if d != nil {
+		doc.pins(d)
+		doc.flash(d)
+		closeFlash(d)
+	}
+	if doc.failed {
+		exit(exitError)
+	}
+}
+
+// device checks the FTDI driver and opens the device.
+func (doc *doctor) device() *gice.Device {
+	if programmer == "ftdi" && remote == "" {
+		switch {
+		case !d2xx.Available && transport.USBAvailable:
+			doc.ok("FTDI driver not available in this build; using raw USB like -programmer usb")
+		case !d2xx.Available:
+			doc.fail("FTDI driver not available in this build")
+			doc.hint("build with CGO_ENABLED=1, or use another -programmer")
+			return nil
+		default:
+			if _, err := gice.Devices(); err != nil {
+				doc.fail("%v", err)
+				return nil
+			}
+			broken := false
+			for _, dev := range ftdi.All() {
+				if name := dev.String(); strings.HasPrefix(name, "broken#") {
+					doc.fail("FTDI device %s", name)
+					broken = true
+				}
+			}
+			if broken {
+				doc.driverHint()
+			}
+		}
+	}
+
+	d, err := newDevice()
+	if err != nil {
+		doc.fail("open device: %v", err)
+		doc.driverHint()
+		return nil
+	}
+	name := programmer
+	if d.FTDI != nil {
+		name = d.FTDI.String()
+	}
+	doc.ok("opened %s", name)
+	return d
+}
+
+// driverHint explains the usual causes of devices that cannot be opened.
+func (doc *doctor) driverHint() {
+	switch runtime.GOOS {
+	case "linux":
+		doc.hint("check the permissions of /dev/bus/usb, e.g. with the udev rule")
+		doc.hint(`SUBSYSTEM=="usb", ATTRS{idVendor}=="0403", MODE="0660", TAG+="uaccess"`)
+		if _, err := os.Stat("/sys/module/ftdi_sio"); err == nil {
+			doc.hint(`ftdi_sio is loaded and may claim the device; try "sudo rmmod ftdi_sio"`)
+		}
+	case "darwin":
+		doc.hint("the Apple or FTDI VCP driver may claim the interface; set it to d2xx with")
+		doc.hint(`"gice eeprom write -a d2xx", or unload the VCP driver`)
+	case "windows":
+		doc.hint("install the FTDI D2XX driver (ftd2xx.dll); interfaces set to the VCP")
+		doc.hint(`driver cannot be opened, see "gice eeprom write -a d2xx"`)
+	}
+	doc.hint("close other programs using the device, such as openFPGALoader or iceprog")
+}
+
+// eeprom checks the board detection and the channel configuration.
+func (doc *doctor) eeprom(d *gice.Device) {
+	ee := ftdi.EEPROM{}
+	if err := d.FTDI.EEPROM(&ee); err != nil {
+		doc.fail("read EEPROM: %v", err)
+		return
+	}
+	if d.Board == board.Generic {
+		doc.warn("board not recognized from the EEPROM description %q", ee.Desc)
+		doc.hint(`use -board, or set the description with "gice eeprom write -desc"`)
+	} else {
+		doc.ok("board %s (%q)", d.Board.Name, ee.Desc)
+	}
+	if ee.Serial == "" {
+		doc.warn("no serial number; devices cannot be told apart with -d and the UART is not found")
+		doc.hint(`set one with "gice eeprom write -serial"`)
+	}
+	if ch := ee.AsFT2232H(); ch != nil {
+		a, b := channelName(ch.AIsFifo, ch.ADriverType), channelName(ch.BIsFifo, ch.BDriverType)
+		doc.ok("channel A: %s, channel B: %s", a, b)
+		if a == "uart" && runtime.GOOS != "linux" {
+			doc.warn("channel A uses the VCP driver, which may prevent MPSSE access")
+			doc.hint(`set it to d2xx with "gice eeprom write -a d2xx"`)
+		}
+	}
+}
+
+// pins checks that CDONE and CRESET_B can be read.
+func (doc *doctor) pins(d *gice.Device) {
+	s, err := d.FPGAStatus()
+	if err != nil {
+		doc.warn("FPGA status: %v", err)
+		return
+	}
+	doc.ok("CDONE %s, CRESET_B %s (%s): %s", s.CDone, s.CReset, s.CResetFunc, s.State())
+}
+
+// flash reads the flash ID at decreasing SPI clocks.
+func (doc *doctor) flash(d *gice.Device) {
+	if err := d.HoldFPGAReset(); err != nil {
+		doc.warn("hold FPGA reset: %v; the FPGA may drive the flash", err)
+	}
+	defer d.ReleaseFlash()
+
+	clocks := []physic.Frequency{30 * physic.MegaHertz, 10 * physic.MegaHertz, physic.MegaHertz, 100 * physic.KiloHertz}
+	var okAt []physic.Frequency
+	for _, f := range clocks {
+		if err := d.SetClock(f); err != nil {
+			doc.fail("set SPI clock %s: %v", f, err)
+			return
+		}
+		id, name, err := readFlashID(d)
+		switch {
+		case err != nil:
+			doc.fail("flash at %s: %v", f, err)
+		case id == [3]byte{} || id == [3]byte{0xFF, 0xFF, 0xFF}:
+			doc.warn("flash at %s: no answer (ID %X)", f, id)
+		case name == "":
+			doc.warn("flash at %s: unknown ID %X", f, id)
+			okAt = append(okAt, f)
+		default:
+			doc.ok("flash at %s: %X %s", f, id, name)
+			okAt = append(okAt, f)
+		}
+	}
+	switch {
+	case len(okAt) == 0:
+		doc.fail("the flash does not answer")
+		doc.hint("check that CRESET_B is wired to ADBUS7 and holds the FPGA in reset,")
+		doc.hint("the channel (-channel) and the SPI wiring (ADBUS0-2, chip select on ADBUS4)")
+	case okAt[0] != clocks[0]:
+		doc.warn("the flash only answers up to %s", okAt[0])
+		doc.hint("check the cable and wiring length for signal integrity")
+	}
+	d.SetClock(clocks[0])
+}
+
+func readFlashID(d *gice.Device) ([3]byte, string, error) {
+	if err := d.Flash.PowerUp(); err != nil {
+		return [3]byte{}, "", err
+	}
+	return d.Flash.ReadID()
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"periph.io/x/host/v3/ftdi"
+)
+
+func eepromCommand(args []string) {
+	if len(args) == 0 || args[0] != "write" {
+		fmt.Fprintf(os.Stderr, "Usage:\n\teeprom write [flags]\n\nRun \"eeprom write -h\" for the flags; use \"info\" to read the EEPROM.\n")
+		os.Exit(exitUsage)
+	}
+
+	fs := flag.NewFlagSet("eeprom write", flag.ExitOnError)
+	var (
+		manufacturer string
+		desc         string
+		serial       string
+		channelA     string
+		channelB     string
+		yes          bool
+	)
+	fs.StringVar(&manufacturer, "manufacturer", "", "manufacturer string")
+	fs.StringVar(&desc, "desc", "", `product description string (e.g. "iCEBreaker V1.0e" to be detected as an iCEBreaker)`)
+	fs.StringVar(&serial, "serial", "", "serial number")
+	fs.StringVar(&channelA, "a", "", "channel A configuration: uart (VCP driver), d2xx, fifo")
+	fs.StringVar(&channelB, "b", "", "channel B configuration: uart (VCP driver), d2xx, fifo")
+	fs.BoolVar(&yes, "yes", false, "write the EEPROM; without it, only print the changes")
+	if err := fs.Parse(args[1:]); err != nil {
+		fatalUsage("invalid arguments: %v", err)
+	}
+
+	d := openDevice()
+	if d.FTDI == nil {
+		fatalf("eeprom requires an FTDI programmer")
+	}
+	ee := ftdi.EEPROM{}
+	if err := d.FTDI.EEPROM(&ee); err != nil {
+		fatalf("read EEPROM: %v", err)
+	}
+	old := ee
+	old.Raw = append([]byte(nil), ee.Raw...)
+
+	changed := false
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "yes":
+			return
+		case "manufacturer":
+			ee.Manufacturer = manufacturer
+		case "desc":
+			ee.Desc = desc
+		case "serial":
+			ee.Serial = serial
+			if h := ee.AsHeader(); h != nil {
+				h.SerNumEnable = 1
+			}
+		case "a", "b":
+			ch := ee.AsFT2232H()
+			if ch == nil {
+				fatalf("unexpected EEPROM size %d", len(ee.Raw))
+			}
+			fifo, driver, config := &ch.AIsFifo, &ch.ADriverType, channelA
+			if f.Name == "b" {
+				fifo, driver, config = &ch.BIsFifo, &ch.BDriverType, channelB
+			}
+			if err := setChannel(fifo, driver, config); err != nil {
+				fatalUsage("-%s: %v", f.Name, err)
+			}
+		}
+		changed = true
+	})
+	if !changed {
+		fatalUsage("nothing to write")
+	}
+	if err := ee.Validate(); err != nil {
+		fatalUsage("%v", err)
+	}
+
+	printEEPROMChange("Manufacturer", old.Manufacturer, ee.Manufacturer)
+	printEEPROMChange("Desc", old.Desc, ee.Desc)
+	printEEPROMChange("Serial", old.Serial, ee.Serial)
+	if o, n := old.AsFT2232H(), ee.AsFT2232H(); o != nil && n != nil {
+		printEEPROMChange("Channel A", channelName(o.AIsFifo, o.ADriverType), channelName(n.AIsFifo, n.ADriverType))
+		printEEPROMChange("Channel B", channelName(o.BIsFifo, o.BDriverType), channelName(n.BIsFifo, n.BDriverType))
+	}
+	if !yes {
+		slog.Info("dry run; rerun with -yes to write the EEPROM")
+		exit(exitError)
+	}
+
+	if err := d.FTDI.WriteEEPROM(&ee); err != nil {
+		fatalf("write EEPROM: %v", err)
+	}
+	slog.Info("EEPROM written; replug the device to apply the changes")
+}
+
+// setChannel sets the interface mode and driver of a channel of the FT2232H.
+func setChannel(fifo, driver *uint8, config string) error {
+	switch config {
+	case "uart":
+		*fifo, *driver = 0, 1
+	case "d2xx":
+		*fifo, *driver = 0, 0
+	case "fifo":
+		*fifo, *driver = 1, 0
+	default:
+		return fmt.Errorf("unknown channel configuration %q", config)
+	}
+	return nil
+}
+
+func channelName(fifo, driver uint8) string {
+	switch {
+	case fifo != 0:
+		return "fifo"
+	case driver != 0:
+		return "uart"
+	}
+	return "d2xx"
+}
+
+func printEEPROMChange(field, old, new string) {
+	if old == new {
+		fmt.Printf("%-13s %s\n", field+":", old)
+		return
+	}
+	fmt.Printf("%-13s %s -> %s\n", field+":", old, new)
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/gentam/gice"
+)
+
+func eraseCommand(args []string) {
+	fs := flag.NewFlagSet("erase", flag.ExitOnError)
+	var (
+		addr int
+		size int
+		chip bool
+	)
+	sizeVar(fs, &addr, "a", 0, "start address, a multiple of 4KB")
+	sizeVar(fs, &size, "n", 0, "number of bytes to erase, a multiple of 4KB")
+	fs.BoolVar(&chip, "chip", false, "bulk erase the entire flash")
+	if err := fs.Parse(args); err != nil {
+		fatalUsage("invalid arguments: %v", err)
+	}
+
+	const subsectorSize = 4 << 10
+	switch {
+	case chip && (addr != 0 || size != 0):
+		fatalUsage("-chip and -a/-n are mutually exclusive")
+	case !chip && size <= 0:
+		fatalUsage("missing -n or -chip")
+	case addr < 0 || addr%subsectorSize != 0:
+		fatalUsage("address 0x%X is not aligned to a 4KB subsector", addr)
+	case size%subsectorSize != 0:
+		fatalUsage("size 0x%X is not a multiple of 4KB; use 0x%X to erase the subsectors it touches", size, (size+subsectorSize-1)/subsectorSize*subsectorSize)
+	}
+
+	stderrTTY, err := isTTY(os.Stderr)
+	if err != nil {
+		fatalf("stderr: %v", err)
+	}
+
+	d := openFlash()
+	defer closeFlash(d)
+
+	start := time.Now()
+	if chip {
+		slog.Debug("erase chip")
+		if err := d.Flash.EraseChip(); err != nil {
+			fatalf("erase chip: %v", err)
+		}
+	} else {
+		if err := d.Flash.CheckFits([]gice.Region{{Addr: addr, Data: make([]byte, size)}}); err != nil {
+			fatalf("erase: %v", err)
+		}
+		if stderrTTY && !quiet {
+			d.Flash.Progress = func(done, total int) {
+				fmt.Fprintf(os.Stderr, "\rerasing 0x%06X-0x%06X: %3d%%", addr, addr+size, done*100/total)
+			}
+		}
+		err := d.Flash.Erase(addr, size)
+		if stderrTTY && !quiet {
+			fmt.Fprintln(os.Stderr)
+		}
+		if err != nil {
+			fatalf("erase 0x%06X: %v", addr, err)
+		}
+	}
+	slog.Info("erased", addrAttr("addr", addr), "size", size, "chip", chip, "duration", time.Since(start).Round(time.Millisecond))
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/gentam/gice"
+	"github.com/gentam/gice/flash"
+)
+
+// Exit codes, listed in the usage text so that scripts can tell the causes of
+// failures apart.
+const (
+	exitError          = 1 // any other failure
+	exitUsage          = 2 // invalid arguments
+	exitDeviceNotFound = 3
+	exitUnknownFlash   = 4 // the operation needs a known flash chip
+	exitVerifyMismatch = 5
+	exitCDoneTimeout   = 6
+	exitProtection     = 7 // the status register or the range is write-protected, or reserved
+	exitBoardMismatch  = 8 // info -expect-board did not match
+)
+
+// exitf prints the message, finishes the command and exits with code.
+func exitf(code int, format string, a ...any) {
+	fmt.Fprintf(os.Stderr, format+"\n", a...)
+	exit(code)
+}
+
+// exit finishes the command and exits with code.
+func exit(code int) {
+	finish()
+	os.Exit(code)
+}
+
+// finish closes the devices left open and the output files, records the
+// erases of the command with -wear and prints the -stats summary.
+func finish() {
+	closeDevices()
+	closeOutputs()
+	recordWear()
+	printStats()
+}
+
+// errorCode returns the exit code for the first argument that is an error
+// with a known cause, or exitError.
+func errorCode(a []any) int {
+	for _, v := range a {
+		err, ok := v.(error)
+		if !ok {
+			continue
+		}
+		switch {
+		case errors.Is(err, gice.ErrDeviceNotFound):
+			return exitDeviceNotFound
+		case errors.Is(err, flash.ErrUnknownFlash):
+			return exitUnknownFlash
+		case errors.Is(err, flash.ErrVerifyMismatch):
+			return exitVerifyMismatch
+		case errors.Is(err, gice.ErrCDoneTimeout):
+			return exitCDoneTimeout
+		case errors.Is(err, flash.ErrStatusProtected), errors.Is(err, flash.ErrWriteProtected),
+			errors.Is(err, flash.ErrReserved):
+			return exitProtection
+		}
+	}
+	return exitError
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/gentam/gice"
+)
+
+func fillCommand(args []string) {
+	fs := flag.NewFlagSet("fill", flag.ExitOnError)
+	var (
+		addr    int
+		size    int
+		pattern string
+	)
+	sizeVar(fs, &addr, "a", 0, "start address")
+	sizeVar(fs, &size, "n", 0, "number of bytes to fill")
+	fs.StringVar(&pattern, "p", "ff", "pattern to repeat, in hex (e.g. 00, ff, deadbeef)")
+	if err := fs.Parse(args); err != nil {
+		fatalUsage("invalid arguments: %v", err)
+	}
+	if size <= 0 {
+		fatalUsage("missing -n")
+	}
+	if addr < 0 {
+		fatalUsage("negative address %d", addr)
+	}
+	p, err := parseHexBytes(pattern)
+	if err != nil || len(p) == 0 {
+		fatalUsage("-p: invalid pattern %q", pattern)
+	}
+
+	d := openFlash()
+	defer closeFlash(d)
+
+	data := bytes.Repeat(p, (size+len(p)-1)/len(p))[:size]
+	start := time.Now()
+	erased, err := d.Flash.UpdateRegions([]gice.Region{{Addr: addr, Data: data}})
+	if err != nil {
+		fatalf("fill: %v", err)
+	}
+	slog.Info("filled", addrAttr("addr", addr), "size", size, "pattern", hex.EncodeToString(p), "erased_subsectors", erased, "duration", time.Since(start).Round(time.Millisecond))
+}
+
+// parseHexBytes parses bytes written in hex, optionally prefixed with 0x and
+// separated by spaces, colons or underscores: "deadbeef", "0xDE:AD".
+func parseHexBytes(s string) ([]byte, error) {
+	s = strings.TrimPrefix(strings.ToLower(s), "0x")
+	s = strings.NewReplacer(" ", "", ":", "", "_", "").Replace(s)
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid hex bytes %q", s)
+	}
+	return b, nil
+}
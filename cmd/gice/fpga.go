@@ -0,0 +1,37 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+)
+
+func fpgaCommand(args []string) {
+	fs := flag.NewFlagSet("fpga", flag.ExitOnError)
+	var (
+		jsonOut bool
+	)
+	fs.BoolVar(&jsonOut, "json", false, "print JSON")
+	if err := fs.Parse(args); err != nil {
+		fatalUsage("invalid arguments: %v", err)
+	}
+
+	d := openDevice()
+	defer closeFlash(d)
+
+	s, err := d.FPGAStatus()
+	if err != nil {
+		fatalf("read FPGA status: %v", err)
+	}
+	if jsonOut {
+		printJSON(struct {
+			CDone      bool   `json:"cdone"`
+			CReset     bool   `json:"creset_b"`
+			CResetFunc string `json:"creset_b_function"`
+			State      string `json:"state"`
+		}{bool(s.CDone), bool(s.CReset), s.CResetFunc, s.State()})
+		return
+	}
+	fmt.Printf("CDONE:           %s\n", s.CDone)
+	fmt.Printf("CRESET_B:        %s (%s)\n", s.CReset, s.CResetFunc)
+	fmt.Printf("State:           %s\n", s.State())
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/gentam/gice"
+	"periph.io/x/conn/v3/gpio"
+)
+
+func gpioCommand(args []string) {
+	fs := flag.NewFlagSet("gpio", flag.ExitOnError)
+	var force bool
+	fs.BoolVar(&force, "force", false, "allow the SPI and FPGA configuration pins (ADBUS0-2, 4, 6, 7)")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, `Usage:
+	gpio [-force] get [PIN...]    read the level and direction (default: all pins)
+	gpio [-force] in PIN...       set as input (high impedance)
+	gpio [-force] set PIN=0|1...  drive as output
+
+PIN is an FTDI pin, ADBUS0-7 or ACBUS0-7, or a signal of the board profile.
+Without -force, only the spare pins ADBUS3, ADBUS5, and ACBUS0-7 are allowed.
+Levels set are kept until the device is opened again.
+
+`)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		fatalUsage("invalid arguments: %v", err)
+	}
+	if fs.NArg() < 2 && fs.Arg(0) != "get" {
+		fs.Usage()
+		os.Exit(exitUsage)
+	}
+
+	lookup := func(d *gice.Device, name string) gpio.PinIO {
+		pin, err := d.Board.ParsePin(name)
+		if err != nil {
+			fatalUsage("%v", err)
+		}
+		get := d.GPIO
+		if force {
+			get = d.Pin
+		}
+		p, err := get(pin)
+		if err != nil {
+			fatalf("%v", err)
+		}
+		return p
+	}
+
+	switch fs.Arg(0) {
+	case "get":
+		d := openDevice()
+		if fs.NArg() == 1 {
+			low, high, err := d.ReadPins()
+			if err != nil {
+				fatalf("read pins: %v", err)
+			}
+			levels := uint16(high)<<8 | uint16(low)
+			for p := range gice.Pin(16) {
+				fmt.Printf("%s\t%s\n", p, gpio.Level(levels>>p&1 != 0))
+			}
+			return
+		}
+		for _, name := range fs.Args()[1:] {
+			p := lookup(d, name)
+			fmt.Printf("%s\t%s\t%s\n", strings.ToUpper(name), p.Read(), p.Function())
+		}
+	case "in":
+		d := openDevice()
+		for _, name := range fs.Args()[1:] {
+			if err := lookup(d, name).In(gpio.PullNoChange, gpio.NoEdge); err != nil {
+				fatalf("%s: %v", name, err)
+			}
+		}
+	case "set":
+		d := openDevice()
+		for _, arg := range fs.Args()[1:] {
+			name, value, ok := strings.Cut(arg, "=")
+			if !ok || (value != "0" && value != "1") {
+				fatalUsage("invalid assignment %q; use PIN=0 or PIN=1", arg)
+			}
+			if err := lookup(d, name).Out(value == "1"); err != nil {
+				fatalf("%s: %v", name, err)
+			}
+		}
+	default:
+		fs.Usage()
+		os.Exit(exitUsage)
+	}
+}
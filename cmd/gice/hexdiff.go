@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+const (
+	colorRed   = "\x1b[31m"
+	colorGreen = "\x1b[32m"
+	colorReset = "\x1b[0m"
+)
+
+// hexDiff prints the 16-byte lines where want and got differ side by side,
+// highlighting the differing bytes when color is set, and returns the number
+// of differing bytes. At most maxLines lines are printed unless it is 0.
+func hexDiff(w io.Writer, addr int, want, got []byte, maxLines int, color bool) int {
+	const lineSize = 16
+	diffs, lines := 0, 0
+	for off := 0; off < len(want); off += lineSize {
+		end := min(off+lineSize, len(want))
+		n := 0
+		for i := off; i < end; i++ {
+			if want[i] != got[i] {
+				n++
+			}
+		}
+		if n == 0 {
+			continue
+		}
+		diffs += n
+
+		lines++
+		if maxLines > 0 && lines > maxLines {
+			continue
+		}
+		if lines == 1 {
+			fmt.Fprintf(w, "%-8s  %-47s | %s\n", "address", "expected", "flash")
+		}
+		fmt.Fprintf(w, "%08x  %s | %s\n", addr+off,
+			hexLine(want[off:end], got[off:end], colorGreen, color),
+			hexLine(got[off:end], want[off:end], colorRed, color))
+	}
+	if maxLines > 0 && lines > maxLines {
+		fmt.Fprintf(w, "... %d more differing lines\n", lines-maxLines)
+	}
+	return diffs
+}
+
+// hexLine formats b in hex, marking the bytes that differ from other in color,
+// or in upper case without color. The result is padded to a full line.
+func hexLine(b, other []byte, highlight string, color bool) string {
+	s := strings.Builder{}
+	for i, c := range b {
+		if i > 0 {
+			s.WriteByte(' ')
+		}
+		switch {
+		case c == other[i]:
+			fmt.Fprintf(&s, "%02x", c)
+		case color:
+			fmt.Fprintf(&s, "%s%02x%s", highlight, c, colorReset)
+		default:
+			fmt.Fprintf(&s, "%02X", c)
+		}
+	}
+	s.WriteString(strings.Repeat(" ", 3*(16-len(b))))
+	return s.String()
+}
+
+// hexDump writes data in the format of hex.Dump, with the addresses counting
+// from base rather than 0.
+func hexDump(w io.Writer, base int, data []byte) {
+	const lineSize = 16
+	for off := 0; off < len(data); off += lineSize {
+		line := data[off:min(off+lineSize, len(data))]
+		s := strings.Builder{}
+		fmt.Fprintf(&s, "%08x  ", base+off)
+		for i := range lineSize {
+			if i < len(line) {
+				fmt.Fprintf(&s, "%02x ", line[i])
+			} else {
+				s.WriteString("   ")
+			}
+			if i == 7 {
+				s.WriteByte(' ')
+			}
+		}
+		s.WriteString(" |")
+		for _, c := range line {
+			if c < 0x20 || c > 0x7e {
+				c = '.'
+			}
+			s.WriteByte(c)
+		}
+		s.WriteString("|\n")
+		io.WriteString(w, s.String())
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestHexDiff(t *testing.T) {
+	// 2.5 lines, with a difference in each
+	want := make([]byte, 40)
+	got := bytes.Clone(want)
+	got[3], got[20], got[39] = 0xAB, 0x01, 0xFF
+	tests := []struct {
+		name     string
+		got      []byte
+		maxLines int
+		color    bool
+		diffs    int
+		out      []string
+	}{
+		{
+			name: "no differences",
+			got:  want,
+		},
+		{
+			name:  "differences",
+			got:   got,
+			diffs: 3,
+			out: []string{
+				"address   expected                                        | flash",
+				"00001000  00 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00 | 00 00 00 AB 00 00 00 00 00 00 00 00 00 00 00 00",
+				"00001010  00 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00 | 00 00 00 00 01 00 00 00 00 00 00 00 00 00 00 00",
+				"00001020  00 00 00 00 00 00 00 00                         | 00 00 00 00 00 00 00 FF                        ",
+			},
+		},
+		{
+			name:     "line limit and color",
+			got:      got,
+			maxLines: 1,
+			color:    true,
+			diffs:    3,
+			out: []string{
+				"address   expected                                        | flash",
+				"00001000  00 00 00 \x1b[32m00\x1b[0m 00 00 00 00 00 00 00 00 00 00 00 00 | 00 00 00 \x1b[31mab\x1b[0m 00 00 00 00 00 00 00 00 00 00 00 00",
+				"... 2 more differing lines",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var b strings.Builder
+			if n := hexDiff(&b, 0x1000, want, tt.got, tt.maxLines, tt.color); n != tt.diffs {
+				t.Errorf("%d differing bytes, want %d", n, tt.diffs)
+			}
+			out := ""
+			if tt.out != nil {
+				out = strings.Join(tt.out, "\n") + "\n"
+			}
+			if b.String() != out {
+				t.Errorf("printed\n%s\nwant\n%s", b.String(), out)
+			}
+		})
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+)
+
+// hooks runs external commands after a write succeeds or fails, passing the
+// context in GICE_* environment variables.
+type hooks struct {
+	onSuccess string
+	onFailure string
+	env       []string
+}
+
+func (h *hooks) setenv(key, value string) {
+	h.env = append(h.env, key+"="+value)
+}
+
+func (h *hooks) run(cmd string, env ...string) {
+	if cmd == "" {
+		return
+	}
+	c := exec.Command("sh", "-c", cmd)
+	c.Env = append(append(os.Environ(), h.env...), env...)
+	c.Stdin = os.Stdin
+	c.Stdout = os.Stdout
+	c.Stderr = os.Stderr
+	if err := c.Run(); err != nil {
+		slog.Error("hook failed", "cmd", cmd, "err", err)
+	}
+}
+
+func (h *hooks) success() { h.run(h.onSuccess) }
+
+// fatalf runs the failure hook and exits.
+func (h *hooks) fatalf(format string, a ...any) {
+	msg := fmt.Sprintf(format, a...)
+	h.run(h.onFailure, "GICE_ERROR="+msg)
+	exitf(errorCode(a), "%s", msg)
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/gentam/gice"
+	"periph.io/x/conn/v3/i2c"
+	"periph.io/x/conn/v3/physic"
+)
+
+func i2cCommand(args []string) {
+	fs := flag.NewFlagSet("i2c", flag.ExitOnError)
+	var (
+		freq  uint
+		nread int
+	)
+	fs.UintVar(&freq, "f", 100, "bus clock in kHz")
+	sizeVar(fs, &nread, "n", 1, "number of bytes to read")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, `Usage:
+	i2c [flags] scan                   list responding addresses
+	i2c [flags] read ADDR [BYTE...]    write the bytes (e.g. a register), then read -n bytes
+	i2c [flags] write ADDR BYTE...     write the bytes
+
+ADDR and BYTE are numbers such as 0x50. The bus is on ADBUS0 (SCL) and
+ADBUS1+ADBUS2 (SDA) of the channel selected with -channel.
+
+`)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		fatalUsage("invalid arguments: %v", err)
+	}
+	if fs.NArg() < 1 || (fs.Arg(0) != "scan" && fs.NArg() < 2) {
+		fs.Usage()
+		os.Exit(exitUsage)
+	}
+
+	bus, err := gice.NewI2C(ftdiOptions()...)
+	if err != nil {
+		fatalf("%v", err)
+	}
+	defer bus.Close()
+	if err := bus.SetSpeed(physic.Frequency(freq) * physic.KiloHertz); err != nil {
+		fatalf("set bus clock: %v", err)
+	}
+
+	if fs.Arg(0) == "scan" {
+		// Skip the reserved addresses 0x00-0x07 and 0x78-0x7F
+		for addr := uint16(0x08); addr < 0x78; addr++ {
+			if bus.Tx(addr, nil, make([]byte, 1)) == nil {
+				fmt.Printf("0x%02X\n", addr)
+			}
+		}
+		return
+	}
+
+	addr := parseByte(fs.Arg(1))
+	var w []byte
+	for _, arg := range fs.Args()[2:] {
+		w = append(w, parseByte(arg))
+	}
+	switch fs.Arg(0) {
+	case "read":
+		r := make([]byte, nread)
+		if err := i2cTx(bus, addr, w, r); err != nil {
+			fatalf("%v", err)
+		}
+		fmt.Print(hex.Dump(r))
+	case "write":
+		if len(w) == 0 {
+			fatalUsage("nothing to write")
+		}
+		if err := i2cTx(bus, addr, w, nil); err != nil {
+			fatalf("%v", err)
+		}
+	default:
+		fs.Usage()
+		os.Exit(exitUsage)
+	}
+}
+
+func i2cTx(bus i2c.Bus, addr byte, w, r []byte) error {
+	if err := bus.Tx(uint16(addr), w, r); err != nil {
+		return fmt.Errorf("0x%02X: %w", addr, err)
+	}
+	return nil
+}
+
+func parseByte(s string) byte {
+	n, err := strconv.ParseUint(s, 0, 8)
+	if err != nil {
+		fatalUsage("invalid byte %q", s)
+	}
+	return byte(n)
+}
@@ -1,37 +1,117 @@
 package main
 
 import (
+	"flag"
 	"fmt"
+	"strings"
 
 	"github.com/gentam/gice"
+	"github.com/gentam/gice/board"
+	"github.com/gentam/gice/flash"
 	"periph.io/x/host/v3/ftdi"
 )
 
-func infoCommand() {
-	d, err := gice.NewDevice()
-	if err != nil {
-		fatalf("%v", err)
+// infoJSON is the output of "info -json".
+type infoJSON struct {
+	Type           string            `json:"type"`
+	VendorID       uint16            `json:"vendor_id"`
+	DeviceID       uint16            `json:"device_id"`
+	Manufacturer   string            `json:"manufacturer"`
+	ManufacturerID string            `json:"manufacturer_id"`
+	Desc           string            `json:"desc"`
+	Serial         string            `json:"serial"`
+	Board          string            `json:"board"`
+	MaxPower       uint16            `json:"max_power_ma"`
+	SelfPowered    bool              `json:"self_powered"`
+	RemoteWakeup   bool              `json:"remote_wakeup"`
+	PullDownEnable bool              `json:"pull_down_enable"`
+	Pins           map[string]string `json:"pins"` // function by pin, e.g. "ADBUS0"
+	Flash          *infoFlashJSON    `json:"flash,omitempty"`
+}
+
+// infoFlashJSON is the flash section of "info -json", if the flash answered.
+type infoFlashJSON struct {
+	ID        string `json:"id"`             // JEDEC ID in hex
+	Name      string `json:"name,omitempty"` // empty if unknown
+	Size      int    `json:"size,omitempty"` // omitted if the flash is unknown
+	SFDP      string `json:"sfdp,omitempty"` // revision, if the flash has SFDP
+	Protected [2]int `json:"protected"`      // [start, end)
+	SRP       bool   `json:"srp"`            // status register protected
+}
+
+func infoCommand(args []string) {
+	fs := flag.NewFlagSet("info", flag.ExitOnError)
+	var (
+		jsonOut     bool
+		probeFlash  bool
+		expectBoard string
+	)
+	fs.BoolVar(&jsonOut, "json", false, "print JSON")
+	fs.BoolVar(&probeFlash, "flash", true, "identify the flash and read its SFDP and protection, holding the FPGA in reset meanwhile")
+	fs.StringVar(&expectBoard, "expect-board", "", "exit with status 8 unless the board is recognized as `name`: "+strings.Join(board.Names(), ", "))
+	if err := fs.Parse(args); err != nil {
+		fatalUsage("invalid arguments: %v", err)
 	}
+	if expectBoard != "" && board.Lookup(expectBoard) == nil {
+		fatalUsage("unknown board %q", expectBoard)
+	}
+
+	d := openDevice()
 	ft := d.FTDI
+	if ft == nil {
+		fatalf("info requires an FTDI programmer")
+	}
 
 	// Reference: https://github.com/periph/cmd/tree/main/ftdi-list
 	i := ftdi.Info{}
 	ft.Info(&i)
-	fmt.Printf("Type:            %s\n", i.Type)
-	fmt.Printf("Vendor ID:       %#04x\n", i.VenID)
-	fmt.Printf("Device ID:       %#04x\n", i.DevID)
 
 	ee := ftdi.EEPROM{}
 	if err := ft.EEPROM(&ee); err != nil {
 		fatalf("read EEPROM: %v", err)
 	}
+	h := ee.AsHeader()
+
+	var flashInfo *infoFlashJSON
+	if probeFlash {
+		flashInfo = readFlashInfo(d)
+	}
+	defer checkBoard(d, expectBoard)
+	defer closeFlash(d)
+
+	if jsonOut {
+		out := infoJSON{
+			Type:           i.Type,
+			VendorID:       i.VenID,
+			DeviceID:       i.DevID,
+			Manufacturer:   ee.Manufacturer,
+			ManufacturerID: ee.ManufacturerID,
+			Desc:           ee.Desc,
+			Serial:         ee.Serial,
+			Board:          d.Board.Name,
+			MaxPower:       h.MaxPower,
+			SelfPowered:    h.SelfPowered != 0,
+			RemoteWakeup:   h.RemoteWakeup != 0,
+			PullDownEnable: h.PullDownEnable != 0,
+			Pins:           map[string]string{},
+			Flash:          flashInfo,
+		}
+		for n, p := range ft.Header() {
+			out.Pins[gice.Pin(n).String()] = p.Function()
+		}
+		printJSON(out)
+		return
+	}
+
+	fmt.Printf("Type:            %s\n", i.Type)
+	fmt.Printf("Vendor ID:       %#04x\n", i.VenID)
+	fmt.Printf("Device ID:       %#04x\n", i.DevID)
 
 	fmt.Printf("Manufacturer:    %s\n", ee.Manufacturer)
 	fmt.Printf("ManufacturerID:  %s\n", ee.ManufacturerID)
 	fmt.Printf("Desc:            %s\n", ee.Desc)
 	fmt.Printf("Serial:          %s\n", ee.Serial)
 
-	h := ee.AsHeader()
 	fmt.Printf("MaxPower:        %dmA\n", h.MaxPower)
 	fmt.Printf("SelfPowered:     %x\n", h.SelfPowered)
 	fmt.Printf("RemoteWakeup:    %x\n", h.RemoteWakeup)
@@ -40,4 +120,60 @@ func infoCommand() {
 	for _, p := range ft.Header() {
 		fmt.Printf("%s: %s\n", p, p.Function())
 	}
+
+	switch {
+	case flashInfo == nil && probeFlash:
+		fmt.Printf("Flash:           not answering\n")
+	case flashInfo == nil:
+	case flashInfo.Name == "":
+		fmt.Printf("Flash:           %s (unknown)\n", flashInfo.ID)
+	default:
+		fmt.Printf("Flash:           %s %s, %d bytes\n", flashInfo.ID, flashInfo.Name, flashInfo.Size)
+	}
+	if flashInfo != nil {
+		sfdp := "none"
+		if flashInfo.SFDP != "" {
+			sfdp = "revision " + flashInfo.SFDP
+		}
+		fmt.Printf("SFDP:            %s\n", sfdp)
+		prot := flash.Protection{Start: flashInfo.Protected[0], End: flashInfo.Protected[1]}
+		fmt.Printf("Protected:       %s", prot)
+		if flashInfo.SRP {
+			fmt.Printf(", status register protected (SRP)")
+		}
+		fmt.Println()
+	}
+}
+
+// readFlashInfo reads the flash ID, SFDP revision and protection with the
+// FPGA held in reset, returning nil if the flash does not answer.
+func readFlashInfo(d *gice.Device) *infoFlashJSON {
+	d.HoldFPGAReset()
+	defer d.ReleaseFlash()
+	if err := d.Flash.PowerUp(); err != nil {
+		return nil
+	}
+	defer d.Flash.PowerDown()
+	id, name, err := d.Flash.ReadID()
+	if err != nil || id == [3]byte{} || id == [3]byte{0xFF, 0xFF, 0xFF} {
+		return nil
+	}
+	info := &infoFlashJSON{ID: fmt.Sprintf("%X", id), Name: name, Size: knownSize(d.Flash, name)}
+	if s, err := d.Flash.ReadSFDPHeader(); err == nil {
+		info.SFDP = fmt.Sprintf("%d.%d", s.Major, s.Minor)
+	}
+	if regs, err := d.Flash.ReadStatusRegisters(); err == nil {
+		prot := d.Flash.Protection(regs)
+		info.Protected = [2]int{prot.Start, prot.End}
+		info.SRP = regs.SR.StatusRegisterProtect()
+	}
+	return info
+}
+
+// checkBoard exits with exitBoardMismatch if the board was not recognized as
+// the one named expect.
+func checkBoard(d *gice.Device, expect string) {
+	if expect != "" && d.Board.Name != expect {
+		exitf(exitBoardMismatch, "board is %s, expected %s", d.Board.Name, expect)
+	}
 }
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+)
+
+// setupLog installs the default logger writing structured lines to stderr:
+// info and above by default, debug with -v, and errors only with -q.
+func setupLog() {
+	level := slog.LevelInfo
+	switch {
+	case verbose:
+		level = slog.LevelDebug
+	case quiet:
+		level = slog.LevelError
+	}
+	h := slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: level,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			// Timestamps are left to whatever captures the output
+			if a.Key == slog.TimeKey && len(groups) == 0 && !verbose {
+				return slog.Attr{}
+			}
+			return a
+		},
+	})
+	slog.SetDefault(slog.New(h))
+}
+
+// traceOut receives the SPI transaction log of -trace, if set.
+var traceOut io.Writer
+
+// outputs are the files created for the flags, closed by closeOutputs.
+var outputs []*os.File
+
+// createOutput creates the file of the flag, to be closed by closeOutputs.
+func createOutput(flag, path string) *os.File {
+	f, err := os.Create(path)
+	if err != nil {
+		fatalf("-%s: %v", flag, err)
+	}
+	outputs = append(outputs, f)
+	return f
+}
+
+// closeOutputs syncs and closes the files created for the flags.
+func closeOutputs() {
+	for _, f := range outputs {
+		if err := f.Sync(); err != nil {
+			slog.Warn("sync", "file", f.Name(), "err", err)
+		}
+		if err := f.Close(); err != nil {
+			slog.Warn("close", "file", f.Name(), "err", err)
+		}
+	}
+	outputs = nil
+}
+
+// setupTrace opens the destination of -trace.
+func setupTrace() {
+	switch trace {
+	case "":
+	case "-":
+		traceOut = os.Stderr
+	default:
+		traceOut = createOutput("trace", trace)
+	}
+}
+
+// recordOut receives the SPI transaction recording of -record, if set.
+var recordOut io.Writer
+
+// setupRecord creates the file of -record.
+func setupRecord() {
+	if record == "" {
+		return
+	}
+	recordOut = createOutput("record", record)
+}
+
+// vcdOut receives the waveform dump of -vcd, if set.
+var vcdOut io.Writer
+
+// setupVCD creates the file of -vcd.
+func setupVCD() {
+	if vcd == "" {
+		return
+	}
+	vcdOut = createOutput("vcd", vcd)
+}
+
+// addrAttr formats a flash address the way hex dumps show it.
+func addrAttr(key string, addr int) slog.Attr {
+	return slog.String(key, fmt.Sprintf("0x%06X", addr))
+}
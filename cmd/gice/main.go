@@ -1,43 +1,153 @@
 package main
 
 import (
+	"encoding/json"
 	"flag"
 	"fmt"
+	"log/slog"
+	"net"
 	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gentam/gice"
+	"github.com/gentam/gice/board"
 )
 
-func fatalf(format string, a ...any) {
-	fmt.Fprintf(os.Stderr, format+"\n", a...)
-	os.Exit(1)
-}
+// configTimeout is how long to wait for the FPGA to configure itself from flash.
+const configTimeout = time.Second
 
-func fatalUsage(format string, a ...any) {
-	fmt.Fprintf(os.Stderr, format+"\n", a...)
-	os.Exit(2)
-}
+// fatalf exits with the code of the error cause among a, see errorCode.
+func fatalf(format string, a ...any) { exitf(errorCode(a), format, a...) }
+
+func fatalUsage(format string, a ...any) { exitf(exitUsage, format, a...) }
 
 func usage() {
 	fmt.Fprintf(os.Stderr, `Usage:
-	%s <command> [arguments]
+	%s [-v|-q] [-trace file] [-record file] [-vcd file] [-stats] [-sleep] [-wear file] [-d serial|index] [-channel A|B] [-programmer spec] [-remote host:port] <command> [arguments]
 
 Commands:
 	read	read flash memory
 	write	write/erase flash memory
+	erase	erase flash memory
+	fill	fill a flash range with a repeating pattern
+	wipe	erase the whole flash and check that every bit reads back 1
+	map	show which flash sectors are programmed and where the bitstreams are
+	peek	dump a few bytes of flash memory
+	poke	write a few bytes, preserving the rest of the flash
+	patch	apply a list of byte patches in one pass
+	test	test the flash with patterns
+	verify	compare flash memory with a file or the golden images of the board
+	backup	dump the whole flash with its identity and checksum
+	restore	write a backup back after checking it matches the flash
 	pack	convert ASCII input into a bitstream file
 	unpack	convert bitstream input into an ASCII file
+	reset	reset the FPGA to reconfigure it from flash
+	boot	release the FPGA reset and wait for it to configure
+	sram	configure the FPGA directly with a bitstream, leaving the flash untouched
+	make	run a build command, then write and boot the bitstream it produced
+	fpga	print FPGA configuration status
+	status	print flash identity, status registers, protection and CDONE
+	protect	print or set the flash block protection
+	unprotect	remove the flash block protection
+	otp	read, write or lock the one-time programmable area of the flash
+	term	attach a serial terminal to the board's UART
+	gpio	read or drive FTDI pins
+	power	switch or cycle the board power through an FTDI pin
+	i2c	access I²C devices on the FTDI
+	pad	pad an image to erase sector boundaries or strip trailing 0xFF
 	info	print device information
+	version	print the version, revision and built-in flash and board lists
+	shell	interactive prompt keeping the flash open between commands
+	doctor	diagnose driver, EEPROM, pin and flash problems
+	reset-adapter	reinitialize a wedged programmer and check the flash answers
+	eeprom	write the FTDI EEPROM
+	serve-serprog	expose the flash to flashrom over the serprog protocol
+	remoted	serve the device to "gice -remote" clients over TCP
 
 Run "%s <command> -h" for more information about a command.
+
+Exit status:
+	0	success
+	1	other failure
+	2	invalid arguments
+	3	FT2232H device not found
+	4	flash chip unknown
+	5	verify mismatch
+	6	CDONE timeout
+	7	flash write-protected or range reserved
+	8	board profile not the expected one
 `, os.Args[0], os.Args[0])
-	os.Exit(2)
+	os.Exit(exitUsage)
 }
 
+var (
+	// deviceSelector is the -d flag: a serial number or an index.
+	deviceSelector string
+
+	// programmer is the -programmer flag, see programmerOptions.
+	programmer string
+
+	// channel is the -channel flag: the FT2232H channel wired to the flash.
+	channel string
+
+	// remote is the -remote flag: the address of a "gice remoted" server.
+	remote string
+
+	// verbose and quiet are the -v and -q flags selecting the log level.
+	verbose, quiet bool
+
+	// reserved is the -reserve flag: flash ranges to protect in addition to
+	// those of the board profile, unless -allow-reserved is set.
+	reserved      reserveFlag
+	allowReserved bool
+
+	// trace is the -trace flag: where to log SPI transactions ("-": stderr).
+	trace string
+
+	// record is the -record flag: where to record SPI transactions for
+	// -programmer replay.
+	record string
+
+	// vcd is the -vcd flag: where to dump SPI transactions as waveforms.
+	vcd string
+
+	// stats is the -stats flag, see printStats.
+	stats bool
+
+	// sleep is the -sleep flag, see gice.WithAutoPowerDown.
+	sleep bool
+
+	// wearFile is the -wear flag: where to count the erases per flash chip.
+	wearFile string
+)
+
 func main() {
 	flag.Usage = usage
+	flag.StringVar(&deviceSelector, "d", "", "select the device by serial number or index")
+	flag.StringVar(&channel, "channel", "", "FT2232H channel wired to the flash: A, B (default: board profile, A)")
+	flag.StringVar(&remote, "remote", "", "use the device served by \"gice remoted\" at `host:port`")
+	flag.StringVar(&programmer, "programmer", "ftdi", "programmer: ftdi (usb in builds without cgo), d2xx[:INDEX[,latency=MS]], usb[:latency=MS], spidev:PORT,cs=GPIO,reset=GPIO,cdone=GPIO, rpi-gpio[:clk=GPIO,...], serprog:DEV|HOST:PORT, replay:FILE, virtual:FILE[,model=n25q32][,timing=none]")
+	flag.BoolVar(&verbose, "v", false, "log debug messages and timestamps")
+	flag.BoolVar(&quiet, "q", false, "only log errors")
+	flag.Var(&reserved, "reserve", "never erase or program the flash range `start-end` or start+size (repeatable)")
+	flag.BoolVar(&allowReserved, "allow-reserved", false, "allow erasing and programming the reserved ranges of the board profile and -reserve")
+	flag.StringVar(&trace, "trace", "", "log every SPI transaction to `file` (\"-\": stderr)")
+	flag.StringVar(&record, "record", "", "record every SPI transaction to `file`, to be served back with -programmer replay:file")
+	flag.StringVar(&vcd, "vcd", "", "dump every SPI transaction to `file` as a VCD waveform, e.g. for PulseView")
+	flag.BoolVar(&sleep, "sleep", false, "keep the flash in deep power-down while the shell is idle, waking it on the next command")
+	flag.StringVar(&wearFile, "wear", "", "count the erases of each flash chip in `file`, reported by status")
+	flag.BoolVar(&stats, "stats", false, "print the bytes read, programmed and erased, throughput and wall time when done")
 	flag.Parse()
 	if flag.NArg() == 0 {
 		usage()
 	}
+	setupLog()
+	setupTrace()
+	setupRecord()
+	setupVCD()
 
 	cmd := flag.Arg(0)
 	rest := flag.Args()[1:]
@@ -46,18 +156,83 @@ func main() {
 		readCommand(rest)
 	case "write":
 		writeCommand(rest)
+	case "erase":
+		eraseCommand(rest)
+	case "fill":
+		fillCommand(rest)
+	case "wipe":
+		wipeCommand(rest)
+	case "map":
+		mapCommand(rest)
+	case "peek":
+		peekCommand(rest)
+	case "poke":
+		pokeCommand(rest)
+	case "patch":
+		patchCommand(rest)
+	case "test":
+		testCommand(rest)
+	case "backup":
+		backupCommand(rest)
+	case "restore":
+		restoreCommand(rest)
+	case "verify":
+		verifyCommand(rest)
 	case "pack":
 		packCommand(rest)
 	case "unpack":
 		unpackCommand(rest)
+	case "reset":
+		resetCommand(rest)
+	case "term":
+		termCommand(rest)
+	case "gpio":
+		gpioCommand(rest)
+	case "power":
+		powerCommand(rest)
+	case "i2c":
+		i2cCommand(rest)
+	case "pad":
+		padCommand(rest)
+	case "boot":
+		bootCommand(rest)
+	case "sram":
+		sramCommand(rest)
+	case "make":
+		makeCommand(rest)
+	case "protect":
+		protectCommand(rest)
+	case "unprotect":
+		unprotectCommand(rest)
+	case "otp":
+		otpCommand(rest)
+	case "status":
+		statusCommand(rest)
+	case "fpga":
+		fpgaCommand(rest)
+	case "serve-serprog":
+		serveSerprogCommand(rest)
+	case "remoted":
+		remotedCommand(rest)
+	case "eeprom":
+		eepromCommand(rest)
+	case "reset-adapter":
+		resetAdapterCommand(rest)
+	case "doctor":
+		doctorCommand(rest)
+	case "shell":
+		shellCommand(rest)
 	case "info":
-		infoCommand()
+		infoCommand(rest)
+	case "version":
+		versionCommand(rest)
 	case "help":
 		usage()
 	default:
 		fmt.Fprintf(os.Stderr, "Unknown command: %q\n", cmd)
 		usage()
 	}
+	finish()
 }
 
 func isTTY(f *os.File) (bool, error) {
@@ -67,3 +242,166 @@ func isTTY(f *os.File) (bool, error) {
 	}
 	return (info.Mode() & os.ModeCharDevice) != 0, nil
 }
+
+// printJSON prints v as indented JSON to stdout.
+func printJSON(v any) {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		fatalf("encode JSON: %v", err)
+	}
+}
+
+// isFlagSet tells whether the flag name was given on the command line.
+func isFlagSet(fs *flag.FlagSet, name string) bool {
+	set := false
+	fs.Visit(func(f *flag.Flag) { set = set || f.Name == name })
+	return set
+}
+
+// lookupBoard returns the board profile for name, or nil for an empty name.
+func lookupBoard(name string) *gice.Board {
+	if name == "" {
+		return nil
+	}
+	b := board.Lookup(name)
+	if b == nil {
+		fatalUsage("unknown board %q", name)
+	}
+	return b
+}
+
+// warnGenericBoard warns when the board was neither given with -board nor
+// recognized from the EEPROM.
+func warnGenericBoard(d *gice.Device, name string) {
+	if name == "" && d.Board == board.Generic {
+		slog.Warn("board not recognized; using the generic profile (use -board to select one)")
+	}
+}
+
+func formatNames() string {
+	names := make([]string, len(gice.Formats))
+	for i, f := range gice.Formats {
+		names[i] = string(f)
+	}
+	return strings.Join(names, ", ")
+}
+
+// newDevice opens the device selected with -d and -programmer.
+func newDevice(opts ...gice.Option) (*gice.Device, error) {
+	popts, err := programmerOptions(programmer)
+	if err != nil {
+		fatalUsage("-programmer: %v", err)
+	}
+	opts = append(opts, popts...)
+	if remote != "" {
+		c, err := net.Dial("tcp", remote)
+		if err != nil {
+			return nil, fmt.Errorf("connect to remote: %w", err)
+		}
+		opts = append(opts, gice.WithRemote(c))
+	}
+	opts = append(opts, ftdiOptions()...)
+	opts = append(opts, gice.WithLogger(slog.Default()))
+	if traceOut != nil {
+		opts = append(opts, gice.WithTrace(traceOut))
+	}
+	if recordOut != nil {
+		opts = append(opts, gice.WithRecord(recordOut))
+	}
+	if vcdOut != nil {
+		opts = append(opts, gice.WithVCD(vcdOut))
+	}
+	if sleep {
+		opts = append(opts, gice.WithAutoPowerDown())
+	}
+	d, err := gice.NewDevice(opts...)
+	if err != nil {
+		return nil, err
+	}
+	d.Flash.Reserved = append(d.Flash.Reserved, reserved...)
+	if allowReserved {
+		d.Flash.Reserved = nil
+	}
+	statsFlash = d.Flash
+	trackWear(d)
+	openDevices = append(openDevices, d)
+	return d, nil
+}
+
+// ftdiOptions returns the options selecting the FT2232H with -d and -channel.
+func ftdiOptions() []gice.Option {
+	var opts []gice.Option
+	if channel != "" {
+		ch, err := board.ParseChannel(channel)
+		if err != nil {
+			fatalUsage("-channel: %v", err)
+		}
+		opts = append(opts, gice.WithChannel(ch))
+	}
+	if deviceSelector != "" {
+		if n, err := strconv.Atoi(deviceSelector); err == nil {
+			opts = append(opts, gice.WithIndex(n))
+		} else {
+			opts = append(opts, gice.WithSerial(deviceSelector))
+		}
+	}
+	return opts
+}
+
+// openDevice is newDevice exiting on error.
+func openDevice(opts ...gice.Option) *gice.Device {
+	d, err := newDevice(opts...)
+	if err != nil {
+		fatalf("%v", err)
+	}
+	return d
+}
+
+// openFlash opens the device, holds the FPGA in reset and identifies the
+// flash, warning if it is unknown. Hand the flash back with closeFlash.
+func openFlash(opts ...gice.Option) *gice.Device {
+	d := openDevice(opts...)
+	holdFlash(d)
+	flashID, name, err := d.Flash.ReadID()
+	if err != nil {
+		fatalf("read flash ID: %v", err)
+	}
+	if name == "" {
+		slog.Warn("unknown flash", "id", fmt.Sprintf("%X", flashID))
+	}
+	return d
+}
+
+// holdFlash holds the FPGA in reset and powers up the flash of d, exiting on
+// error.
+func holdFlash(d *gice.Device) {
+	d.HoldFPGAReset()
+	if err := d.Flash.PowerUp(); err != nil {
+		fatalf("flash power up: %v", err)
+	}
+}
+
+// openDevices are the devices opened by newDevice and not closed yet, closed
+// by finish when the command exits early.
+var openDevices []*gice.Device
+
+// closeFlash closes the device, powering down the flash and releasing the FPGA
+// reset unless the FPGA was already released. Closing it again does nothing.
+func closeFlash(d *gice.Device) {
+	i := slices.Index(openDevices, d)
+	if i < 0 {
+		return
+	}
+	openDevices = slices.Delete(openDevices, i, i+1)
+	if err := d.Close(); err != nil {
+		slog.Warn("close device", "err", err)
+	}
+}
+
+// closeDevices closes the devices left open, last opened first.
+func closeDevices() {
+	for len(openDevices) > 0 {
+		closeFlash(openDevices[len(openDevices)-1])
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gentam/gice"
+	"github.com/gentam/gice/bitstream"
+	"github.com/gentam/gice/board"
+)
+
+func makeCommand(args []string) {
+	fs := flag.NewFlagSet("make", flag.ExitOnError)
+	var (
+		output    string
+		boardName string
+		force     bool
+		noRelease bool
+	)
+	fs.StringVar(&output, "o", "", "bitstream produced by the build (default: the newest .bin file it wrote under the current directory)")
+	fs.StringVar(&boardName, "board", "", "board profile: "+strings.Join(board.Names(), ", "))
+	fs.BoolVar(&force, "force", false, "write even if the bitstream fails the consistency check")
+	fs.BoolVar(&noRelease, "no-release", false, "keep the FPGA in reset after writing")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: make [flags] -- build command [arguments]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		fatalUsage("invalid arguments: %v", err)
+	}
+	if fs.NArg() == 0 {
+		fatalUsage("missing build command, e.g. make -- make")
+	}
+	profile := lookupBoard(boardName)
+
+	start := time.Now()
+	c := exec.Command(fs.Arg(0), fs.Args()[1:]...)
+	c.Stdin = os.Stdin
+	c.Stdout = os.Stdout
+	c.Stderr = os.Stderr
+	if err := c.Run(); err != nil {
+		exitf(exitError, "build: FAILED (%v)", err)
+	}
+	built := time.Since(start)
+	fmt.Printf("build: ok (%s)\n", built.Round(time.Millisecond))
+
+	if output == "" {
+		var err error
+		if output, err = newestBitstream(".", start); err != nil {
+			fatalf("%v; use -o to name the bitstream", err)
+		}
+	} else if info, err := os.Stat(output); err == nil && info.ModTime().Before(start) {
+		slog.Warn("bitstream not updated by the build", "file", output)
+	}
+	data, err := os.ReadFile(output)
+	if err != nil {
+		fatalf("read bitstream: %v", err)
+	}
+	if !force {
+		if err := bitstream.Check(data); err != nil {
+			fatalf("invalid bitstream %q: %v; use -force to write anyway", output, err)
+		}
+	}
+	slog.Info("bitstream", "file", output, "size", len(data))
+
+	job := &writeJob{
+		regions:   []gice.Region{{Addr: 0, Data: data}},
+		board:     profile,
+		boardName: boardName,
+		slot:      -1,
+		noRelease: noRelease,
+		strict:    !noRelease,
+	}
+	flashStart := time.Now()
+	if _, err := job.run(&hooks{}); err != nil {
+		fatalf("flash: FAILED (%v)", err)
+	}
+	fmt.Printf("flash: ok (%s, %s)\n", output, time.Since(flashStart).Round(time.Millisecond))
+	if noRelease {
+		fmt.Println("boot: skipped (-no-release)")
+	} else {
+		fmt.Println("boot: ok (CDONE high)")
+	}
+}
+
+// newestBitstream returns the most recently modified .bin file under dir
+// written since start, skipping hidden directories.
+func newestBitstream(dir string, start time.Time) (string, error) {
+	var (
+		newest  string
+		newTime time.Time
+	)
+	// Some file systems only keep whole seconds
+	start = start.Truncate(time.Second)
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if path != dir && strings.HasPrefix(info.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if filepath.Ext(path) != ".bin" {
+			return nil
+		}
+		if t := info.ModTime(); !t.Before(start) && t.After(newTime) {
+			newest, newTime = path, t
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	if newest == "" {
+		return "", errors.New("the build wrote no .bin file")
+	}
+	return newest, nil
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/gentam/gice/bitstream"
+)
+
+func mapCommand(args []string) {
+	fs := flag.NewFlagSet("map", flag.ExitOnError)
+	var (
+		sample     int
+		sectorSize int
+	)
+	fs.IntVar(&sample, "sample", 0, "only read N pages of 256 bytes spread over each sector (0: read everything)")
+	sizeVar(fs, &sectorSize, "sector", 64<<10, "size of the sectors shown: 4k or 64k")
+	if err := fs.Parse(args); err != nil {
+		fatalUsage("invalid arguments: %v", err)
+	}
+	if sectorSize != 4<<10 && sectorSize != 64<<10 {
+		fatalUsage("-sector must be 4k or 64k")
+	}
+	const pageSize = 256
+	pages := sectorSize / pageSize
+	if sample < 0 || sample >= pages {
+		sample = 0
+	}
+
+	d := openFlash()
+	defer closeFlash(d)
+	size := d.Flash.Size()
+
+	// Read each sector, or evenly spaced pages of it, and keep the full
+	// content to look for bitstreams
+	var full []byte
+	used := make([]bool, size/sectorSize)
+	for i := range used {
+		addr := i * sectorSize
+		var data []byte
+		if sample == 0 {
+			b, err := d.Flash.Read(addr, sectorSize)
+			if err != nil {
+				fatalf("read flash: %v", err)
+			}
+			full = append(full, b...)
+			data = b
+		} else {
+			for p := range sample {
+				b, err := d.Flash.Read(addr+p*pages/sample*pageSize, pageSize)
+				if err != nil {
+					fatalf("read flash: %v", err)
+				}
+				data = append(data, b...)
+			}
+		}
+		used[i] = strings.Trim(string(data), "\xFF") != ""
+	}
+
+	const perLine = 64
+	fmt.Printf("%dKB sectors, '#' programmed, '.' blank:\n", sectorSize>>10)
+	n := 0
+	for i := 0; i < len(used); i += perLine {
+		var line strings.Builder
+		for _, u := range used[i:min(i+perLine, len(used))] {
+			if u {
+				line.WriteByte('#')
+				n++
+			} else {
+				line.WriteByte('.')
+			}
+		}
+		fmt.Printf("0x%06X  %s\n", i*sectorSize, line.String())
+	}
+	fmt.Printf("%d of %d sectors programmed\n", n, len(used))
+
+	if full == nil {
+		fmt.Println("bitstreams are only located when reading everything (-sample 0)")
+		return
+	}
+	if h, err := bitstream.ParseMultibootHeader(full); err == nil {
+		fmt.Printf("multiboot header at 0x000000:\n  %s\n", strings.ReplaceAll(h.String(), "\n", "\n  "))
+	}
+	for _, b := range bitstream.FindAll(full) {
+		fmt.Printf("bitstream at 0x%06X-0x%06X (%d bytes)", b.Offset, b.Offset+b.Size-1, b.Size)
+		if b.Comment != "" {
+			fmt.Printf(": %s", strings.ReplaceAll(b.Comment, "\n", "; "))
+		}
+		fmt.Println()
+	}
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"bufio"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/gentam/gice"
+	"github.com/gentam/gice/flash"
+)
+
+const otpUsage = `Usage:
+	otp read [-r N] [-o file]        dump the OTP regions (default: all)
+	otp write -r N [-offset N] file  program a file into OTP region N
+	otp lock -r N -yes               PERMANENTLY lock OTP region N
+
+The one-time programmable area holds 3 security registers of 256 bytes on
+Winbond flash chips and a single 64-byte OTP array on Micron ones. Programming
+can only clear bits and is never undone by erasing the flash. Locking a region
+cannot be undone by any means.
+
+Run "otp <command> -h" for the flags.
+`
+
+func otpCommand(args []string) {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, otpUsage)
+		os.Exit(exitUsage)
+	}
+	switch args[0] {
+	case "read":
+		otpReadCommand(args[1:])
+	case "write":
+		otpWriteCommand(args[1:])
+	case "lock":
+		otpLockCommand(args[1:])
+	default:
+		fmt.Fprint(os.Stderr, otpUsage)
+		os.Exit(exitUsage)
+	}
+}
+
+func otpReadCommand(args []string) {
+	fs := flag.NewFlagSet("otp read", flag.ExitOnError)
+	var (
+		region  int
+		outPath string
+	)
+	fs.IntVar(&region, "r", 0, "OTP region to read (default: all)")
+	fs.StringVar(&outPath, "o", "", "write the raw region to the file instead of dumping it; requires -r")
+	if err := fs.Parse(args); err != nil {
+		fatalUsage("invalid arguments: %v", err)
+	}
+	if outPath != "" && region == 0 {
+		fatalUsage("-o requires -r")
+	}
+
+	d, otp := openOTPDevice()
+	defer closeFlash(d)
+
+	if outPath != "" {
+		data, err := d.Flash.ReadOTP(region)
+		if err != nil {
+			fatalf("read OTP: %v", err)
+		}
+		if err := os.WriteFile(outPath, data, 0o644); err != nil {
+			fatalf("write output: %v", err)
+		}
+		return
+	}
+	for n := 1; n <= otp.Count; n++ {
+		if region != 0 && n != region {
+			continue
+		}
+		data, err := d.Flash.ReadOTP(n)
+		if err != nil {
+			fatalf("read OTP: %v", err)
+		}
+		locked, err := d.Flash.OTPLocked(n)
+		if err != nil {
+			fatalf("read OTP lock: %v", err)
+		}
+		state := "unlocked"
+		if locked {
+			state = "locked"
+		}
+		fmt.Printf("Region %d (%s):\n%s", n, state, hex.Dump(data))
+	}
+}
+
+func otpWriteCommand(args []string) {
+	fs := flag.NewFlagSet("otp write", flag.ExitOnError)
+	var (
+		region int
+		offset int
+	)
+	fs.IntVar(&region, "r", 0, "OTP region to program")
+	sizeVar(fs, &offset, "offset", 0, "offset in the region")
+	if err := fs.Parse(args); err != nil {
+		fatalUsage("invalid arguments: %v", err)
+	}
+	if region == 0 || fs.NArg() != 1 {
+		fatalUsage("usage: otp write -r N [-offset N] file")
+	}
+	data, err := os.ReadFile(fs.Arg(0))
+	if err != nil {
+		fatalf("read input: %v", err)
+	}
+
+	d, _ := openOTPDevice()
+	defer closeFlash(d)
+
+	locked, err := d.Flash.OTPLocked(region)
+	if err != nil {
+		fatalf("read OTP lock: %v", err)
+	}
+	if locked {
+		exitf(exitProtection, "OTP region %d is locked", region)
+	}
+	if err := d.Flash.WriteOTP(region, offset, data); err != nil {
+		fatalf("write OTP: %v", err)
+	}
+	got, err := d.Flash.ReadOTP(region)
+	if err != nil {
+		fatalf("read OTP: %v", err)
+	}
+	if n := hexDiff(os.Stdout, offset, data, got[offset:offset+len(data)], 10, false); n > 0 {
+		exitf(exitVerifyMismatch, "verify failed: %d bytes differ; programming cannot set bits", n)
+	}
+	slog.Info("OTP written", "region", region, "offset", offset, "size", len(data))
+}
+
+func otpLockCommand(args []string) {
+	fs := flag.NewFlagSet("otp lock", flag.ExitOnError)
+	var (
+		region int
+		yes    bool
+	)
+	fs.IntVar(&region, "r", 0, "OTP region to lock")
+	fs.BoolVar(&yes, "yes", false, "lock the region; without it, only print what would happen")
+	if err := fs.Parse(args); err != nil {
+		fatalUsage("invalid arguments: %v", err)
+	}
+	if region == 0 {
+		fatalUsage("usage: otp lock -r N -yes")
+	}
+
+	d, _ := openOTPDevice()
+	defer closeFlash(d)
+
+	locked, err := d.Flash.OTPLocked(region)
+	if err != nil {
+		fatalf("read OTP lock: %v", err)
+	}
+	if locked {
+		slog.Info("OTP region already locked", "region", region)
+		return
+	}
+
+	fmt.Fprintf(os.Stderr, `WARNING: locking OTP region %d is IRREVERSIBLE.
+Its current content becomes read-only forever: it can never be programmed
+or erased again, by gice or any other tool, and the lock survives erasing
+the flash and power cycles. Only the chip is affected, not the board.
+`, region)
+	if !yes {
+		slog.Info("dry run; rerun with -yes to lock the region")
+		exit(exitError)
+	}
+	if tty, _ := isTTY(os.Stdin); tty {
+		confirm := fmt.Sprintf("lock %d", region)
+		fmt.Fprintf(os.Stderr, "Type %q to continue: ", confirm)
+		line, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		if strings.TrimSpace(line) != confirm {
+			fatalf("aborted")
+		}
+	}
+	if err := d.Flash.LockOTP(region); err != nil {
+		fatalf("lock OTP: %v", err)
+	}
+	slog.Info("OTP region locked", "region", region)
+}
+
+// openOTPDevice opens the device and identifies the flash, as the OTP layout
+// depends on it.
+func openOTPDevice() (*gice.Device, flash.OTP) {
+	d := openDevice()
+	holdFlash(d)
+	if _, _, err := d.Flash.ReadID(); err != nil {
+		fatalf("read flash ID: %v", err)
+	}
+	otp, err := d.Flash.OTP()
+	if err != nil {
+		fatalf("%v", err)
+	}
+	return d, otp
+}
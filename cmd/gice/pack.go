@@ -6,7 +6,7 @@ import (
 	"path/filepath"
 	"strings"
 
-	"github.com/gentam/gice"
+	"github.com/gentam/gice/bitstream"
 )
 
 func packCommand(args []string) {
@@ -60,7 +60,7 @@ func packCommand(args []string) {
 		defer outFile.Close()
 	}
 
-	p := gice.Packer{}
+	p := bitstream.Packer{}
 	p.SkipBRAMInit = skipBRAMInit
 	p.NoSleep = noSleep
 	if err := p.Pack(outFile, inFile); err != nil {
@@ -115,7 +115,7 @@ func unpackCommand(args []string) {
 		defer outFile.Close()
 	}
 
-	p := gice.Packer{}
+	p := bitstream.Packer{}
 	if err := p.Unpack(outFile, inFile); err != nil {
 		fatalf("unpack: %v", err)
 	}
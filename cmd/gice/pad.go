@@ -0,0 +1,61 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"os"
+
+	"github.com/gentam/gice"
+)
+
+func padCommand(args []string) {
+	fs := flag.NewFlagSet("pad", flag.ExitOnError)
+	var (
+		outFilePath string
+		align       int
+		strip       bool
+	)
+	fs.StringVar(&outFilePath, "o", "", "output file (default: stdout)")
+	sizeVar(fs, &align, "align", 4<<10, "pad to a multiple of the size in bytes (e.g. 4k or 64k erase sectors)")
+	fs.BoolVar(&strip, "strip", false, "strip trailing 0xFF instead of padding")
+	if err := fs.Parse(args); err != nil {
+		fatalUsage("invalid arguments: %v", err)
+	}
+
+	stdinTTY, err := isTTY(os.Stdin)
+	if err != nil {
+		fatalf("stdin: %v", err)
+	}
+	inFilePath := fs.Arg(0)
+	if inFilePath == "" && stdinTTY {
+		fatalUsage("missing input")
+	}
+	inFile := os.Stdin
+	if inFilePath != "" {
+		if inFile, err = os.Open(inFilePath); err != nil {
+			fatalf("open %q: %v", inFilePath, err)
+		}
+		defer inFile.Close()
+	}
+	img, err := io.ReadAll(inFile)
+	if err != nil {
+		fatalf("read input: %v", err)
+	}
+
+	if strip {
+		img = gice.TrimImage(img)
+	} else {
+		img = gice.PadImage(img, align)
+	}
+
+	outFile := os.Stdout
+	if outFilePath != "" {
+		if outFile, err = os.Create(outFilePath); err != nil {
+			fatalf("create %q: %v", outFilePath, err)
+		}
+		defer outFile.Close()
+	}
+	if _, err := outFile.Write(img); err != nil {
+		fatalf("write: %v", err)
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/gentam/gice"
+)
+
+func patchCommand(args []string) {
+	fs := flag.NewFlagSet("patch", flag.ExitOnError)
+	var (
+		patches  patchFlag
+		filePath string
+	)
+	fs.Var(&patches, "p", "patch `ADDR=BYTES`, with the bytes in hex (repeatable)")
+	fs.StringVar(&filePath, "f", "", `read patches from the file, one "ADDR BYTES..." per line ("#" starts a comment)`)
+	if err := fs.Parse(args); err != nil {
+		fatalUsage("invalid arguments: %v", err)
+	}
+	if filePath != "" {
+		if err := patches.readFile(filePath); err != nil {
+			fatalUsage("%v", err)
+		}
+	}
+	if len(patches) == 0 {
+		fatalUsage("missing -p or -f")
+	}
+
+	d := openFlash()
+	defer closeFlash(d)
+	for _, p := range patches {
+		slog.Debug("patch", addrAttr("addr", p.Addr), "size", len(p.Data))
+	}
+	erased, err := d.Flash.UpdateRegions(patches)
+	if err != nil {
+		fatalf("patch: %v", err)
+	}
+	slog.Info("patched", "patches", len(patches), "erased_subsectors", erased)
+}
+
+// patchFlag collects patches given as ADDR=BYTES.
+type patchFlag []gice.Region
+
+func (f *patchFlag) String() string { return "" }
+
+func (f *patchFlag) Set(s string) error {
+	addr, data, ok := strings.Cut(s, "=")
+	if !ok {
+		return fmt.Errorf("missing =BYTES in %q", s)
+	}
+	return f.add(addr, []string{data})
+}
+
+func (f *patchFlag) add(addr string, data []string) error {
+	a, err := parseSize(addr)
+	if err != nil || a < 0 {
+		return fmt.Errorf("invalid address %q", addr)
+	}
+	r := gice.Region{Addr: a}
+	for _, s := range data {
+		b, err := parseHexBytes(s)
+		if err != nil {
+			return err
+		}
+		r.Data = append(r.Data, b...)
+	}
+	if len(r.Data) == 0 {
+		return fmt.Errorf("no bytes to patch at %s", addr)
+	}
+	*f = append(*f, r)
+	return nil
+}
+
+// readFile adds the patches of a file with one "ADDR BYTES..." per line.
+func (f *patchFlag) readFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	sc := bufio.NewScanner(file)
+	for n := 1; sc.Scan(); n++ {
+		line, _, _ := strings.Cut(sc.Text(), "#")
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if err := f.add(fields[0], fields[1:]); err != nil {
+			return fmt.Errorf("%s:%d: %w", path, n, err)
+		}
+	}
+	return sc.Err()
+}
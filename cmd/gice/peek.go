@@ -0,0 +1,84 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/gentam/gice"
+)
+
+func peekCommand(args []string) {
+	fs := flag.NewFlagSet("peek", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage:\n\tpeek ADDR [N]\n\nDump N (default 16) bytes of the flash from ADDR.\n")
+	}
+	if err := fs.Parse(args); err != nil {
+		fatalUsage("invalid arguments: %v", err)
+	}
+	if fs.NArg() < 1 || fs.NArg() > 2 {
+		fs.Usage()
+		os.Exit(exitUsage)
+	}
+	addr, err := parseSize(fs.Arg(0))
+	if err != nil || addr < 0 {
+		fatalUsage("invalid address %q", fs.Arg(0))
+	}
+	n := 16
+	if fs.NArg() == 2 {
+		if n, err = parseSize(fs.Arg(1)); err != nil || n <= 0 {
+			fatalUsage("invalid length %q", fs.Arg(1))
+		}
+	}
+
+	d := openFlash()
+	defer closeFlash(d)
+	if err := d.Flash.CheckFits([]gice.Region{{Addr: addr, Data: make([]byte, n)}}); err != nil {
+		fatalf("peek: %v", err)
+	}
+	data, err := d.Flash.Read(addr, n)
+	if err != nil {
+		fatalf("read flash: %v", err)
+	}
+	hexDump(os.Stdout, addr, data)
+}
+
+func pokeCommand(args []string) {
+	fs := flag.NewFlagSet("poke", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, `Usage:
+	poke ADDR BYTES...
+
+Write the bytes, given in hex (e.g. "12 34" or "1234"), at ADDR. The rest of
+the 4KB subsectors touched is preserved, and they are only erased if needed.
+`)
+	}
+	if err := fs.Parse(args); err != nil {
+		fatalUsage("invalid arguments: %v", err)
+	}
+	if fs.NArg() < 2 {
+		fs.Usage()
+		os.Exit(exitUsage)
+	}
+	addr, err := parseSize(fs.Arg(0))
+	if err != nil || addr < 0 {
+		fatalUsage("invalid address %q", fs.Arg(0))
+	}
+	var data []byte
+	for _, arg := range fs.Args()[1:] {
+		b, err := parseHexBytes(arg)
+		if err != nil {
+			fatalUsage("%v", err)
+		}
+		data = append(data, b...)
+	}
+
+	d := openFlash()
+	defer closeFlash(d)
+	erased, err := d.Flash.UpdateRegions([]gice.Region{{Addr: addr, Data: data}})
+	if err != nil {
+		fatalf("poke: %v", err)
+	}
+	slog.Info("poked", addrAttr("addr", addr), "size", len(data), "erased_subsectors", erased)
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"maps"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gentam/gice"
+	"github.com/gentam/gice/board"
+)
+
+func powerCommand(args []string) {
+	fs := flag.NewFlagSet("power", flag.ExitOnError)
+	var (
+		boardName string
+		pinName   string
+		activeLow bool
+		off       time.Duration
+		wait      time.Duration
+	)
+	fs.StringVar(&boardName, "board", "", "board profile: "+strings.Join(board.Names(), ", "))
+	fs.StringVar(&pinName, "pin", "", "FTDI pin enabling the board power (default: \""+gice.SignalPower+"\" of the board profile)")
+	fs.BoolVar(&activeLow, "active-low", false, "the power enable pin given with -pin is active low")
+	fs.DurationVar(&off, "off", 500*time.Millisecond, "how long to keep the power off for cycle")
+	fs.DurationVar(&wait, "wait", 0, "wait up to the duration for CDONE after cycle (0: don't wait)")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, `Usage:
+	power [flags] on|off|cycle
+
+`)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		fatalUsage("invalid arguments: %v", err)
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(exitUsage)
+	}
+
+	d := openDevice(gice.WithBoard(lookupBoard(boardName)))
+	if pinName != "" {
+		p, err := board.ParsePin(pinName)
+		if err != nil {
+			fatalUsage("-pin: %v", err)
+		}
+		b := *d.Board
+		b.Pins = maps.Clone(b.Pins)
+		if b.Pins == nil {
+			b.Pins = map[string]gice.Pin{}
+		}
+		b.Pins[gice.SignalPower] = p
+		b.PowerActiveLow = activeLow
+		d.Board = &b
+	}
+
+	switch fs.Arg(0) {
+	case "on":
+		if err := d.SetPower(true); err != nil {
+			fatalf("power on: %v", err)
+		}
+	case "off":
+		if err := d.SetPower(false); err != nil {
+			fatalf("power off: %v", err)
+		}
+	case "cycle":
+		if err := d.PowerCycle(off); err != nil {
+			fatalf("power cycle: %v", err)
+		}
+		if wait > 0 {
+			elapsed, err := d.FinishConfiguration(wait)
+			if err != nil {
+				fatalf("%v", err)
+			}
+			fmt.Printf("configured in %v\n", elapsed.Round(time.Microsecond))
+		}
+	default:
+		fatalUsage("unknown power command %q", fs.Arg(0))
+	}
+}
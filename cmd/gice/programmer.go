@@ -0,0 +1,201 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gentam/gice"
+	"github.com/gentam/gice/flash/flashtest"
+	"github.com/gentam/gice/transport"
+	"periph.io/x/d2xx"
+)
+
+// programmerOptions returns the device options for the -programmer flag:
+//
+//	ftdi                                          FT2232H (default); usb in builds without the FTDI driver
+//	d2xx[:INDEX[,latency=MS]]                     MPSSE over the FTDI D2XX library
+//	usb[:latency=MS]                              MPSSE over Linux usbfs, selected with -d and -channel, also of the FT2232D
+//	spidev:PORT,cs=GPIO,reset=GPIO,cdone=GPIO     Linux spidev and GPIO lines
+//	rpi-gpio[:clk=GPIO,mosi=GPIO,...]             bit-banged Raspberry Pi GPIOs
+//	serprog:/dev/ttyACM0|COM3[,baud=N]            serprog over a serial port
+//	serprog:HOST:PORT                             serprog over TCP
+//	replay:FILE                                   a session recorded with -record
+//	virtual:FILE[,model=w25q128|n25q32][,timing=typical|none]
+//	                                              a simulated board whose flash is FILE
+func programmerOptions(spec string) ([]gice.Option, error) {
+	kind, arg, _ := strings.Cut(spec, ":")
+	switch kind {
+	case "", "ftdi":
+		if !d2xx.Available && transport.USBAvailable && remote == "" {
+			// Builds without cgo lack the D2XX library of the FTDI driver
+			return []gice.Option{gice.WithUSB(time.Millisecond)}, nil
+		}
+		return nil, nil
+	case "d2xx":
+		index, rest, _ := strings.Cut(arg, ",")
+		i := 0
+		if index != "" {
+			var err error
+			if i, err = strconv.Atoi(index); err != nil || i < 0 {
+				return nil, fmt.Errorf("invalid D2XX interface index %q", index)
+			}
+		}
+		params, err := parseParams(rest)
+		if err != nil {
+			return nil, err
+		}
+		latency, err := latencyParam(params)
+		if err != nil {
+			return nil, err
+		}
+		return []gice.Option{gice.WithD2XX(i, latency)}, nil
+	case "usb":
+		params, err := parseParams(arg)
+		if err != nil {
+			return nil, err
+		}
+		latency, err := latencyParam(params)
+		if err != nil {
+			return nil, err
+		}
+		return []gice.Option{gice.WithUSB(latency)}, nil
+	case "spidev":
+		port, params, err := programmerParams(arg, "cs", "reset", "cdone")
+		if err != nil {
+			return nil, err
+		}
+		pins := gice.SPIDevPins{CS: params["cs"], Reset: params["reset"], CDone: params["cdone"]}
+		return []gice.Option{gice.WithSPIDev(port, pins)}, nil
+	case "rpi-gpio":
+		params, err := parseParams(arg)
+		if err != nil {
+			return nil, err
+		}
+		// SPI0 pins used as GPIOs, and the pins next to them for reset and CDONE
+		param := func(k, def string) string {
+			if v := params[k]; v != "" {
+				return v
+			}
+			return def
+		}
+		pins := gice.BitbangPins{
+			CLK:  param("clk", "GPIO11"),
+			MOSI: param("mosi", "GPIO10"),
+			MISO: param("miso", "GPIO9"),
+			SPIDevPins: gice.SPIDevPins{
+				CS:    param("cs", "GPIO8"),
+				Reset: param("reset", "GPIO25"),
+				CDone: param("cdone", "GPIO24"),
+			},
+		}
+		return []gice.Option{gice.WithBitbang(pins)}, nil
+	case "serprog":
+		rw, err := dialSerprog(arg)
+		if err != nil {
+			return nil, err
+		}
+		return []gice.Option{gice.WithSerprog(rw)}, nil
+	case "replay":
+		f, err := os.Open(arg)
+		if err != nil {
+			return nil, err
+		}
+		return []gice.Option{gice.WithReplay(f)}, nil
+	case "virtual":
+		path, params, err := programmerParams(arg)
+		if err != nil {
+			return nil, err
+		}
+		m, t := flashtest.W25Q128, flashtest.W25Q128Timing
+		switch params["model"] {
+		case "", "w25q128":
+		case "n25q32":
+			m, t = flashtest.N25Q32, flashtest.N25Q32Timing
+		default:
+			return nil, fmt.Errorf("unknown flash model %q", params["model"])
+		}
+		switch params["timing"] {
+		case "", "typical":
+		case "none":
+			t = flashtest.Timing{}
+		default:
+			return nil, fmt.Errorf("invalid timing %q", params["timing"])
+		}
+		return []gice.Option{gice.WithVirtual(path, m, t)}, nil
+	}
+	return nil, fmt.Errorf("unknown programmer %q", kind)
+}
+
+// latencyParam returns the USB latency timer of the latency= parameter, in
+// milliseconds; 1ms by default.
+func latencyParam(params map[string]string) (time.Duration, error) {
+	v := params["latency"]
+	if v == "" {
+		return time.Millisecond, nil
+	}
+	ms, err := strconv.Atoi(v)
+	if err != nil || ms < 1 || ms > 255 {
+		return 0, fmt.Errorf("invalid latency %q: want 1 to 255 milliseconds", v)
+	}
+	return time.Duration(ms) * time.Millisecond, nil
+}
+
+// dialSerprog opens the serial port or TCP address of a serprog programmer.
+func dialSerprog(arg string) (io.ReadWriter, error) {
+	// Serial ports such as /dev/ttyACM0 and COM3 have no port number
+	if path, _, _ := strings.Cut(arg, ","); strings.Contains(path, ":") {
+		return net.Dial("tcp", arg)
+	}
+	path, params, err := programmerParams(arg)
+	if err != nil {
+		return nil, err
+	}
+	// USB CDC programmers ignore the baud rate
+	baud := 115200
+	if v := params["baud"]; v != "" {
+		if baud, err = strconv.Atoi(v); err != nil {
+			return nil, fmt.Errorf("invalid baud rate %q", v)
+		}
+	}
+	return openSerial(path, baud)
+}
+
+// programmerParams splits "PATH,key=value,..." and checks that all the keys
+// are given.
+func programmerParams(arg string, keys ...string) (string, map[string]string, error) {
+	path, rest, _ := strings.Cut(arg, ",")
+	if path == "" {
+		return "", nil, fmt.Errorf("missing path in %q", arg)
+	}
+	params, err := parseParams(rest)
+	if err != nil {
+		return "", nil, err
+	}
+	for _, k := range keys {
+		if params[k] == "" {
+			return "", nil, fmt.Errorf("missing %s= in %q", k, arg)
+		}
+	}
+	return path, params, nil
+}
+
+// parseParams parses a comma separated list of key=value.
+func parseParams(s string) (map[string]string, error) {
+	params := map[string]string{}
+	if s == "" {
+		return params, nil
+	}
+	for _, kv := range strings.Split(s, ",") {
+		k, v, ok := strings.Cut(kv, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid parameter %q", kv)
+		}
+		params[k] = v
+	}
+	return params, nil
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/gentam/gice"
+	"github.com/gentam/gice/flash"
+)
+
+func protectCommand(args []string) {
+	fs := flag.NewFlagSet("protect", flag.ExitOnError)
+	var (
+		upper int
+		lower int
+		all   bool
+	)
+	sizeVar(fs, &upper, "upper", 0, "protect the upper N bytes of the flash")
+	sizeVar(fs, &lower, "lower", 0, "protect the lower N bytes of the flash")
+	fs.BoolVar(&all, "all", false, "protect the entire flash")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, `Usage:
+	protect                         print the protected range and the ranges available
+	protect -upper N|-lower N|-all  set the block protect bits
+
+The range must be one of the ranges available, as the block protect bits of
+the status register select fixed fractions of the flash.
+
+`)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		fatalUsage("invalid arguments: %v", err)
+	}
+	n := 0
+	for _, set := range []bool{upper > 0, lower > 0, all} {
+		if set {
+			n++
+		}
+	}
+	if n > 1 {
+		fatalUsage("-upper, -lower and -all are mutually exclusive")
+	}
+
+	d := openProtectDevice()
+	defer closeFlash(d)
+
+	size := d.Flash.Size()
+	var p flash.Protection
+	switch {
+	case upper > 0:
+		p = flash.Protection{Start: size - upper, End: size}
+	case lower > 0:
+		p = flash.Protection{Start: 0, End: lower}
+	case all:
+		p = flash.Protection{Start: 0, End: size}
+	default:
+		regs, err := d.Flash.ReadStatusRegisters()
+		if err != nil {
+			fatalf("read flash status registers: %v", err)
+		}
+		fmt.Printf("Protected:       %s\n", d.Flash.Protection(regs))
+		if regs.SR.StatusRegisterProtect() {
+			fmt.Println("Status register: protected by SRP while /WP is low")
+		}
+		fmt.Println("Available:")
+		for _, p := range d.Flash.Protections() {
+			fmt.Printf("  %s\n", p)
+		}
+		return
+	}
+	setProtection(d, p)
+}
+
+func unprotectCommand(args []string) {
+	fs := flag.NewFlagSet("unprotect", flag.ExitOnError)
+	if err := fs.Parse(args); err != nil {
+		fatalUsage("invalid arguments: %v", err)
+	}
+
+	d := openProtectDevice()
+	defer closeFlash(d)
+
+	setProtection(d, flash.Protection{})
+}
+
+// openProtectDevice opens the device and identifies the flash, as the meaning
+// of the block protect bits depends on it.
+func openProtectDevice() *gice.Device {
+	d := openDevice()
+	holdFlash(d)
+	flashID, name, err := d.Flash.ReadID()
+	if err != nil {
+		fatalf("read flash ID: %v", err)
+	}
+	if name == "" {
+		slog.Warn("unknown flash; assuming the common block protect layout", "id", fmt.Sprintf("%X", flashID))
+	}
+	return d
+}
+
+func setProtection(d *gice.Device, p flash.Protection) {
+	if err := d.Flash.SetProtection(p); err != nil {
+		fatalf("set protection: %v", err)
+	}
+	slog.Info("protected", "range", p.String())
+}
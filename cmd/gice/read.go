@@ -1,52 +1,81 @@
 package main
 
 import (
-	"encoding/hex"
 	"flag"
 	"fmt"
+	"log/slog"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/gentam/gice"
+	"github.com/gentam/gice/bitstream"
 )
 
 func readCommand(args []string) {
 	fs := flag.NewFlagSet("read", flag.ExitOnError)
 	var (
-		nread      int
-		idOnly     bool
-		statusOnly bool
+		nread         int
+		offset        int
+		idOnly        bool
+		statusOnly    bool
+		bitstreamOnly bool
+		all           bool
+		jsonOut       bool
+		format        string
+		family        uint
+		outPath       string
+		base          int
 	)
-	fs.IntVar(&nread, "n", 256, "number of bytes to read")
+	sizeVar(fs, &nread, "n", 256, "number of bytes to read")
+	sizeVar(fs, &offset, "a", 0, "start address")
+	sizeVar(fs, &offset, "offset", 0, "alias for -a")
 	fs.BoolVar(&idOnly, "id", false, "just print flash ID")
+	fs.BoolVar(&jsonOut, "json", false, "print -id as JSON")
 	fs.BoolVar(&statusOnly, "s", false, "just print flash status register")
+	fs.BoolVar(&bitstreamOnly, "bitstream", false, "find the first bitstream from -a and read exactly its length (ignores -n)")
+	fs.BoolVar(&all, "all", false, "read from -a to the end of the flash, as detected from its ID or SFDP table (ignores -n)")
+	fs.StringVar(&format, "format", "bin", "output format: bin, hex (Intel HEX), uf2")
+	fs.UintVar(&family, "uf2-family", 0, "family ID for -format uf2 (0: none)")
+	sizeVar(fs, &base, "base", 0, "address of the first byte in the hexdump (default: the start address)")
+	fs.StringVar(&outPath, "o", "", `output file ("-": raw bytes to stdout; default: hexdump if stdout is a terminal)`)
 	if err := fs.Parse(args); err != nil {
 		fatalUsage("invalid arguments: %v", err)
 	}
+	if jsonOut && !idOnly {
+		fatalUsage("-json requires -id")
+	}
+	if all && bitstreamOnly {
+		fatalUsage("-all and -bitstream are mutually exclusive")
+	}
+	if offset < 0 {
+		fatalUsage("negative address %d", offset)
+	}
+	switch format {
+	case "bin", "hex", "uf2":
+	default:
+		fatalUsage("unknown format %q", format)
+	}
 
 	stdoutTTY, err := isTTY(os.Stdout)
 	if err != nil {
 		fatalf("stdout: %v", err)
 	}
+	if outPath == "" {
+		outPath = fs.Arg(0)
+	}
+	hexdump := outPath == "" && stdoutTTY
 	outFile := os.Stdout
-	if filename := fs.Arg(0); filename != "" {
-		if outFile, err = os.Create(filename); err != nil {
+	if outPath != "" && outPath != "-" {
+		if outFile, err = os.Create(outPath); err != nil {
 			fatalf("create file: %v", err)
 		}
 		defer outFile.Close()
 	}
 
-	d, err := gice.NewDevice()
-	if err != nil {
-		fatalf("%v", err)
-	}
-
-	d.HoldFPGAReset()
-	defer d.ReleaseFPGAReset()
-
-	if err := d.Flash.PowerUp(); err != nil {
-		fatalf("flash power up: %v", err)
-	}
-	defer d.Flash.PowerDown()
+	d := openDevice()
+	holdFlash(d)
+	defer closeFlash(d)
 
 	if statusOnly {
 		sr, err := d.Flash.ReadStatusRegister()
@@ -61,24 +90,98 @@ func readCommand(args []string) {
 	if err != nil {
 		fatalf("read flash ID: %v", err)
 	}
+	if idOnly && jsonOut {
+		printJSON(struct {
+			ID   string `json:"id"`
+			Name string `json:"name"`
+			Size int    `json:"size,omitempty"`
+		}{fmt.Sprintf("%X", flashID), name, knownSize(d.Flash, name)})
+		return
+	}
 	if idOnly {
 		fmt.Printf("%X\t%s\n", flashID, name)
 		return
 	}
 	if name == "" {
-		fmt.Fprintf(os.Stderr, "unknown flash ID (%X)\n", flashID)
+		slog.Warn("unknown flash", "id", fmt.Sprintf("%X", flashID))
 	}
 
-	data, err := d.Flash.Read(0, nread)
-	if err != nil {
-		fatalf("read flash: %v", err)
+	var data []byte
+	addr := offset
+	size := d.Flash.Size()
+	if name == "" {
+		// Fall back to the density of the SFDP table for unknown flash
+		if size, err = sfdpSize(d.Flash); err == nil {
+			slog.Info("flash size from SFDP", "size", size)
+		} else if all {
+			exitf(exitUnknownFlash, "flash size unknown (SFDP: %v); use -n", err)
+		} else {
+			size = d.Flash.Size()
+		}
+	}
+	if addr >= size {
+		fatalf("address 0x%X exceeds the flash size 0x%X", addr, size)
+	}
+	if all {
+		nread = size - addr
+	}
+	if !bitstreamOnly && addr+nread > size {
+		fatalf("0x%06X-0x%06X exceeds the flash size 0x%X", addr, addr+nread, size)
+	}
+	if bitstreamOnly {
+		var info *bitstream.Info
+		info, data, err = d.Flash.FindBitstream(addr, size-addr)
+		if err != nil {
+			fatalf("find bitstream: %v", err)
+		}
+		addr = info.Offset
+		slog.Info("bitstream", addrAttr("addr", info.Offset), "size", info.Size, "comment", strings.TrimRight(info.Comment, "\n"))
+	} else {
+		start := time.Now()
+		if data, err = d.Flash.Read(addr, nread); err != nil {
+			fatalf("read flash: %v", err)
+		}
+		slog.Debug("read", addrAttr("addr", addr), "size", nread, "duration", time.Since(start).Round(time.Millisecond))
 	}
 
-	if outFile == os.Stdout && stdoutTTY {
-		fmt.Println(hex.Dump(data))
+	if format == "hex" {
+		if err := gice.WriteIntelHex(outFile, addr, data); err != nil {
+			fatalf("write: %v", err)
+		}
+		return
+	}
+	if format == "uf2" {
+		if err := gice.WriteUF2(outFile, addr, data, uint32(family)); err != nil {
+			fatalf("write: %v", err)
+		}
+		return
+	}
+	if hexdump {
+		// Show flash addresses unless another base is given
+		if !isFlagSet(fs, "base") {
+			base = addr
+		}
+		hexDump(os.Stdout, base, data)
 		return
 	}
 	if _, err := outFile.Write(data); err != nil {
 		fatalf("write: %v", err)
 	}
 }
+
+// sfdpSize returns the flash size given by the SFDP table.
+func sfdpSize(f *gice.Flash) (int, error) {
+	s, err := f.ReadSFDPHeader()
+	if err != nil {
+		return 0, err
+	}
+	return f.SFDPDensity(s)
+}
+
+// knownSize returns the flash size, or 0 if the flash is unknown.
+func knownSize(f *gice.Flash, name string) int {
+	if name == "" {
+		return 0
+	}
+	return f.Size()
+}
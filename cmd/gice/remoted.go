@@ -0,0 +1,37 @@
+package main
+
+import (
+	"flag"
+	"log/slog"
+	"net"
+)
+
+func remotedCommand(args []string) {
+	fs := flag.NewFlagSet("remoted", flag.ExitOnError)
+	var listen string
+	fs.StringVar(&listen, "listen", ":4242", "TCP address to serve on; there is no authentication")
+	if err := fs.Parse(args); err != nil {
+		fatalUsage("invalid arguments: %v", err)
+	}
+
+	d := openDevice()
+
+	l, err := net.Listen("tcp", listen)
+	if err != nil {
+		fatalf("listen: %v", err)
+	}
+	slog.Info("serving", "board", d.Board.Name, "addr", l.Addr())
+	for {
+		c, err := l.Accept()
+		if err != nil {
+			fatalf("accept: %v", err)
+		}
+		slog.Info("connected", "client", c.RemoteAddr())
+		// One client at a time, as they share the device
+		if err := d.ServeRemote(c); err != nil {
+			slog.Error("serve", "client", c.RemoteAddr(), "err", err)
+		}
+		c.Close()
+		slog.Info("disconnected", "client", c.RemoteAddr())
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gentam/gice"
+	"github.com/gentam/gice/board"
+)
+
+func resetCommand(args []string) {
+	fs := flag.NewFlagSet("reset", flag.ExitOnError)
+	var (
+		wait      time.Duration
+		cbsel     int
+		boardName string
+	)
+	fs.DurationVar(&wait, "wait", 0, "wait up to the duration for CDONE (0: don't wait)")
+	fs.IntVar(&cbsel, "cbsel", -1, "drive the CBSEL pins to select cold boot image N (0-3) before reset")
+	fs.StringVar(&boardName, "board", "", "board profile: "+strings.Join(board.Names(), ", "))
+	if err := fs.Parse(args); err != nil {
+		fatalUsage("invalid arguments: %v", err)
+	}
+
+	d := openDevice(gice.WithBoard(lookupBoard(boardName)))
+	defer closeFlash(d)
+
+	if cbsel >= 0 {
+		warnGenericBoard(d, boardName)
+		if err := d.SetColdBootSelect(cbsel); err != nil {
+			fatalf("cold boot select: %v", err)
+		}
+	}
+
+	if err := d.ResetFPGA(); err != nil {
+		fatalf("reset FPGA: %v", err)
+	}
+	if wait > 0 {
+		elapsed, err := d.FinishConfiguration(wait)
+		if err != nil {
+			fatalf("%v", err)
+		}
+		fmt.Printf("configured in %v\n", elapsed.Round(time.Microsecond))
+	}
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+)
+
+func resetAdapterCommand(args []string) {
+	fs := flag.NewFlagSet("reset-adapter", flag.ExitOnError)
+	if err := fs.Parse(args); err != nil {
+		fatalUsage("invalid arguments: %v", err)
+	}
+
+	d := openDevice()
+
+	if err := d.Reinit(); err != nil {
+		fatalf("reinitialize programmer: %v", err)
+	}
+	// Check that the flash answers over the new connection
+	holdFlash(d)
+	defer closeFlash(d)
+	flashID, name, err := d.Flash.ReadID()
+	if err != nil {
+		fatalf("read flash ID: %v", err)
+	}
+	slog.Info("programmer reinitialized", "flash_id", fmt.Sprintf("%X", flashID), "flash", name)
+}
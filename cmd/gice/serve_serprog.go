@@ -0,0 +1,55 @@
+package main
+
+import (
+	"flag"
+	"log/slog"
+	"net"
+)
+
+func serveSerprogCommand(args []string) {
+	fs := flag.NewFlagSet("serve-serprog", flag.ExitOnError)
+	var (
+		listen string
+		pty    bool
+	)
+	fs.StringVar(&listen, "listen", "", "serve on the TCP address (flashrom -p serprog:ip=HOST:PORT)")
+	fs.BoolVar(&pty, "pty", false, "serve on a new pseudo terminal (flashrom -p serprog:dev=PATH)")
+	if err := fs.Parse(args); err != nil {
+		fatalUsage("invalid arguments: %v", err)
+	}
+	if (listen == "") == !pty {
+		fatalUsage("exactly one of -listen and -pty is required")
+	}
+
+	d := openDevice()
+
+	if pty {
+		master, path, err := openPTY()
+		if err != nil {
+			fatalf("open pty: %v", err)
+		}
+		defer master.Close()
+		slog.Info("serving serprog", "pty", path)
+		if err := d.ServeSerprog(master); err != nil {
+			fatalf("serprog: %v", err)
+		}
+		return
+	}
+
+	l, err := net.Listen("tcp", listen)
+	if err != nil {
+		fatalf("listen: %v", err)
+	}
+	slog.Info("serving serprog", "addr", l.Addr())
+	for {
+		c, err := l.Accept()
+		if err != nil {
+			fatalf("accept: %v", err)
+		}
+		// One client at a time, as they share the flash
+		if err := d.ServeSerprog(c); err != nil {
+			slog.Error("serprog", "client", c.RemoteAddr(), "err", err)
+		}
+		c.Close()
+	}
+}
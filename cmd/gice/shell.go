@@ -0,0 +1,221 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gentam/gice"
+)
+
+const shellHelp = `Commands:
+	id			read the flash ID
+	sr			read the flash status registers
+	read ADDR LEN		dump LEN bytes from ADDR
+	write ADDR BYTE...	program bytes at ADDR (erase first)
+	erase4k ADDR		erase the 4KB subsector at ADDR
+	erase64k ADDR		erase the 64KB sector at ADDR
+	cdone			read CDONE
+	reset			reset the FPGA to reconfigure it from flash
+	help			print this help
+	quit			release the flash and exit
+
+Numbers are decimal or prefixed with 0x, optionally followed by k or M. The FPGA is held in reset and the
+flash kept powered up between commands, or in deep power-down with -sleep;
+after reset, the next flash command takes it back.
+`
+
+func shellCommand(args []string) {
+	fs := flag.NewFlagSet("shell", flag.ExitOnError)
+	if err := fs.Parse(args); err != nil {
+		fatalUsage("invalid arguments: %v", err)
+	}
+	stdinTTY, err := isTTY(os.Stdin)
+	if err != nil {
+		fatalf("stdin: %v", err)
+	}
+
+	sh := &shell{d: openDevice()}
+	if err := sh.take(); err != nil {
+		fatalf("%v", err)
+	}
+	defer sh.release()
+
+	sc := bufio.NewScanner(os.Stdin)
+	for {
+		if stdinTTY {
+			fmt.Print("gice> ")
+		}
+		if !sc.Scan() {
+			break
+		}
+		line, _, _ := strings.Cut(sc.Text(), "#")
+		args := strings.Fields(line)
+		if len(args) == 0 {
+			continue
+		}
+		if args[0] == "quit" || args[0] == "exit" {
+			break
+		}
+		if err := sh.exec(args); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", args[0], err)
+		}
+		if sleep && sh.held {
+			// Idle at the prompt; the next command wakes the flash
+			sh.d.Flash.PowerDown()
+		}
+	}
+	if err := sc.Err(); err != nil {
+		fatalf("read stdin: %v", err)
+	}
+}
+
+// shell keeps the device open between the commands of "gice shell".
+type shell struct {
+	d    *gice.Device
+	held bool // the FPGA is held in reset and the flash is powered up
+}
+
+// take holds the FPGA in reset and powers up the flash, if not done already.
+func (sh *shell) take() error {
+	if sh.held {
+		return nil
+	}
+	sh.d.HoldFPGAReset()
+	if err := sh.d.Flash.PowerUp(); err != nil {
+		return fmt.Errorf("flash power up: %w", err)
+	}
+	// Reading the ID selects the timing parameters of the flash
+	if _, _, err := sh.d.Flash.ReadID(); err != nil {
+		return fmt.Errorf("read flash ID: %w", err)
+	}
+	sh.held = true
+	return nil
+}
+
+// release powers down the flash and hands it over to the FPGA.
+func (sh *shell) release() {
+	if !sh.held {
+		return
+	}
+	sh.d.Flash.PowerDown()
+	sh.d.ReleaseFlash()
+	sh.held = false
+}
+
+var errShellUsage = errors.New("invalid arguments; see help")
+
+func (sh *shell) exec(args []string) error {
+	cmd, args := args[0], args[1:]
+	nums := make([]int, len(args))
+	for i, a := range args {
+		n, err := parseSize(a)
+		if err != nil {
+			return fmt.Errorf("invalid number %q", a)
+		}
+		nums[i] = n
+	}
+	want := func(n int) error {
+		if len(nums) != n {
+			return errShellUsage
+		}
+		return sh.take()
+	}
+
+	switch cmd {
+	case "help":
+		fmt.Print(shellHelp)
+	case "id":
+		if err := want(0); err != nil {
+			return err
+		}
+		id, name, err := sh.d.Flash.ReadID()
+		if err != nil {
+			return err
+		}
+		if name == "" {
+			name = "unknown"
+		}
+		fmt.Printf("%X %s\n", id, name)
+	case "sr":
+		if err := want(0); err != nil {
+			return err
+		}
+		regs, err := sh.d.Flash.ReadStatusRegisters()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("status:   %s\n", regs.SR)
+		if regs.HasSR2 {
+			fmt.Printf("status 2: %s\n", regs.SR2)
+			fmt.Printf("status 3: %s\n", regs.SR3)
+		}
+		if regs.HasFlag {
+			fmt.Printf("flag:     %s\n", regs.Flag)
+		}
+	case "read":
+		if err := want(2); err != nil {
+			return err
+		}
+		if nums[1] < 0 {
+			return errShellUsage
+		}
+		data, err := sh.d.Flash.Read(nums[0], nums[1])
+		if err != nil {
+			return err
+		}
+		hexDump(os.Stdout, nums[0], data)
+	case "write":
+		if len(nums) < 2 {
+			return errShellUsage
+		}
+		if err := sh.take(); err != nil {
+			return err
+		}
+		data := make([]byte, len(nums)-1)
+		for i, n := range nums[1:] {
+			if n < 0 || n > 0xFF {
+				return fmt.Errorf("invalid byte %q", args[1+i])
+			}
+			data[i] = byte(n)
+		}
+		return sh.d.Flash.WriteAt(bytes.NewReader(data), nums[0])
+	case "erase4k":
+		if err := want(1); err != nil {
+			return err
+		}
+		return sh.d.Flash.Erase4KB(nums[0])
+	case "erase64k":
+		if err := want(1); err != nil {
+			return err
+		}
+		return sh.d.Flash.Erase64KB(nums[0])
+	case "cdone":
+		done, err := sh.d.CDone()
+		if err != nil {
+			return err
+		}
+		fmt.Println(done)
+	case "reset":
+		if sh.held {
+			sh.d.Flash.PowerDown()
+			sh.held = false
+		}
+		if err := sh.d.ResetFPGA(); err != nil {
+			return err
+		}
+		elapsed, err := sh.d.FinishConfiguration(configTimeout)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("configured in %v\n", elapsed.Round(time.Microsecond))
+	default:
+		return errors.New("unknown command; see help")
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/gentam/gice"
+)
+
+// sizeSuffixes are the multipliers accepted by parseSize, matched case
+// insensitively; sizes are binary like in flash datasheets.
+var sizeSuffixes = []struct {
+	suffix string
+	mult   int
+}{
+	{"kib", 1 << 10}, {"kb", 1 << 10}, {"k", 1 << 10},
+	{"mib", 1 << 20}, {"mb", 1 << 20}, {"m", 1 << 20},
+}
+
+// parseSize parses a size or address given in decimal, or in hexadecimal,
+// octal or binary with a 0x, 0o or 0b prefix, optionally followed by a k or M
+// suffix: "4096", "4k", "1M", "0x20000". Negative sizes are rejected.
+func parseSize(s string) (int, error) {
+	num, mult := s, 1
+	lower := strings.ToLower(s)
+	for _, sx := range sizeSuffixes {
+		// There is no bare b suffix, as in "0x1b" it is a hexadecimal digit
+		if strings.HasSuffix(lower, sx.suffix) && len(s) > len(sx.suffix) {
+			num, mult = s[:len(s)-len(sx.suffix)], sx.mult
+			break
+		}
+	}
+	n, err := strconv.ParseInt(num, 0, 64)
+	if err != nil || n > (1<<31-1)/int64(mult) {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	if n < 0 {
+		return 0, fmt.Errorf("negative size %q", s)
+	}
+	return int(n) * mult, nil
+}
+
+// sizeFlag is an int flag parsed with parseSize.
+type sizeFlag int
+
+func (f *sizeFlag) String() string { return strconv.Itoa(int(*f)) }
+
+func (f *sizeFlag) Set(s string) error {
+	n, err := parseSize(s)
+	if err != nil {
+		return err
+	}
+	*f = sizeFlag(n)
+	return nil
+}
+
+// sizeVar defines an int flag accepting sizes such as 4k, 1M or 0x20000.
+func sizeVar(fs *flag.FlagSet, p *int, name string, value int, usage string) {
+	*p = value
+	fs.Var((*sizeFlag)(p), name, usage)
+}
+
+// reserveFlag collects flash ranges given as start-end or start+size.
+type reserveFlag []gice.ReservedRange
+
+func (f *reserveFlag) String() string { return "" }
+
+func (f *reserveFlag) Set(s string) error {
+	start, end, ok := strings.Cut(s, "-")
+	start, size, plus := strings.Cut(start, "+")
+	if ok == plus {
+		return fmt.Errorf("invalid range %q; use start-end or start+size", s)
+	}
+	r := gice.ReservedRange{Name: "-reserve"}
+	var err error
+	if r.Start, err = parseSize(start); err != nil {
+		return err
+	}
+	if plus {
+		end = size
+	}
+	if r.End, err = parseSize(end); err != nil {
+		return err
+	}
+	if plus {
+		r.End += r.Start
+	}
+	if r.End <= r.Start {
+		return fmt.Errorf("empty range %q", s)
+	}
+	*f = append(*f, r)
+	return nil
+}
@@ -0,0 +1,44 @@
+package main
+
+import "testing"
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		s    string
+		want int
+		ok   bool
+	}{
+		{"4096", 4096, true},
+		{"0", 0, true},
+		{"4k", 4 << 10, true},
+		{"4K", 4 << 10, true},
+		{"4kb", 4 << 10, true},
+		{"4KiB", 4 << 10, true},
+		{"1M", 1 << 20, true},
+		{"16MB", 16 << 20, true},
+		{"2mib", 2 << 20, true},
+		{"0x20000", 0x20000, true},
+		{"0X1b", 0x1B, true}, // b is a digit, not a suffix
+		{"0x10k", 16 << 10, true},
+		{"0o17", 15, true},
+		{"0b101", 5, true},
+		{"2047M", 2047 << 20, true},
+		{"0x7FFFFFFF", 1<<31 - 1, true},
+		{"2048M", 0, false},
+		{"0x80000000", 0, false},
+		{"99999999999999999999", 0, false},
+		{"-1", 0, false},
+		{"-4k", 0, false},
+		{"", 0, false},
+		{"k", 0, false},
+		{"4G", 0, false},
+		{"1.5M", 0, false},
+		{"0x", 0, false},
+	}
+	for _, tt := range tests {
+		got, err := parseSize(tt.s)
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("parseSize(%q) = %d, %v; want %d, ok %v", tt.s, got, err, tt.want, tt.ok)
+		}
+	}
+}
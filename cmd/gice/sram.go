@@ -0,0 +1,62 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/gentam/gice/bitstream"
+)
+
+func sramCommand(args []string) {
+	fs := flag.NewFlagSet("sram", flag.ExitOnError)
+	var (
+		timeout time.Duration
+		force   bool
+	)
+	fs.DurationVar(&timeout, "t", configTimeout, "timeout waiting for CDONE")
+	fs.BoolVar(&force, "force", false, "load even if the bitstream fails the consistency check")
+	if err := fs.Parse(args); err != nil {
+		fatalUsage("invalid arguments: %v", err)
+	}
+
+	stdinTTY, err := isTTY(os.Stdin)
+	if err != nil {
+		fatalf("stdin: %v", err)
+	}
+	inFilePath := fs.Arg(0)
+	if inFilePath == "" && stdinTTY {
+		fatalUsage("missing input")
+	}
+	inFile := os.Stdin
+	if inFilePath != "" && inFilePath != "-" {
+		inFile, err = os.Open(inFilePath)
+		if err != nil {
+			fatalf("open %q: %v", inFilePath, err)
+		}
+		defer inFile.Close()
+	}
+	data, err := io.ReadAll(inFile)
+	if err != nil {
+		fatalf("read input: %v", err)
+	}
+	if !force {
+		if err := bitstream.Check(data); err != nil {
+			fatalf("invalid bitstream %v; use -force to load anyway", err)
+		}
+	}
+
+	d := openDevice()
+	defer closeFlash(d)
+
+	if err := d.ProgramSRAM(data); err != nil {
+		fatalf("program SRAM: %v", err)
+	}
+	elapsed, err := d.FinishConfiguration(timeout)
+	if err != nil {
+		fatalf("SRAM configuration failed: %v", err)
+	}
+	slog.Info("configured", "size", len(data), "duration", elapsed.Round(time.Microsecond))
+}
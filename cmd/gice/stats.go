@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/gentam/gice"
+)
+
+var (
+	// statsFlash is the flash of the last opened device, summarized by
+	// printStats with -stats.
+	statsFlash *gice.Flash
+	startTime  = time.Now()
+)
+
+// printStats prints the operation counts of the command to stderr if -stats
+// is set: bytes and time per phase, throughput, and busy waits that timed out.
+func printStats() {
+	if !stats || statsFlash == nil {
+		return
+	}
+	s := statsFlash.Stats
+	w := os.Stderr
+	fmt.Fprintf(w, "stats: wall time %s\n", time.Since(startTime).Round(time.Millisecond))
+	fmt.Fprintf(w, "  read     %9d bytes  %10s  %s\n", s.BytesRead, s.ReadTime.Round(time.Millisecond), throughput(s.BytesRead, s.ReadTime))
+	fmt.Fprintf(w, "  program  %9d bytes  %10s  %s\n", s.BytesProgrammed, s.ProgramTime.Round(time.Millisecond), throughput(s.BytesProgrammed, s.ProgramTime))
+	erased := s.BytesErased(statsFlash.Size())
+	fmt.Fprintf(w, "  erase    %9d bytes  %10s  %s (%d x 64KB, %d x 4KB, %d chip)\n", erased, s.EraseTime.Round(time.Millisecond), throughput(erased, s.EraseTime), s.Erased64KB, s.Erased4KB, s.ErasedChip)
+	fmt.Fprintf(w, "  busy     %d polls, %d timeouts\n", s.BusyPolls, s.BusyTimeouts)
+}
+
+func throughput(n int, d time.Duration) string {
+	if n == 0 || d <= 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.0f KB/s", float64(n)/1024/d.Seconds())
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/gentam/gice"
+
+	"periph.io/x/conn/v3/gpio"
+)
+
+// statusJSON is the output of "status -json".
+type statusJSON struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Size      int    `json:"size,omitempty"` // omitted if the flash is unknown
+	SR        byte   `json:"sr"`
+	SR2       *byte  `json:"sr2,omitempty"`
+	SR3       *byte  `json:"sr3,omitempty"`
+	Flag      *byte  `json:"flag_status,omitempty"`
+	Protected [2]int `json:"protected"` // [start, end)
+	CDone     *bool  `json:"cdone,omitempty"`
+
+	Wear *wearRecord `json:"wear,omitempty"` // with -wear, if recorded
+}
+
+func statusCommand(args []string) {
+	fs := flag.NewFlagSet("status", flag.ExitOnError)
+	var (
+		jsonOut bool
+		watch   time.Duration
+	)
+	fs.BoolVar(&jsonOut, "json", false, "print JSON")
+	fs.DurationVar(&watch, "watch", 0, "poll the status registers at this `interval` until interrupted, printing each change")
+	if err := fs.Parse(args); err != nil {
+		fatalUsage("invalid arguments: %v", err)
+	}
+	if jsonOut && watch > 0 {
+		fatalUsage("-json and -watch are mutually exclusive")
+	}
+
+	d := openDevice()
+
+	// CDONE is read before the flash is taken over, which resets the FPGA
+	var cdone *bool
+	if done, err := d.CDone(); err == nil {
+		cdone = &done
+	}
+
+	holdFlash(d)
+	defer closeFlash(d)
+
+	flashID, name, err := d.Flash.ReadID()
+	if err != nil {
+		fatalf("read flash ID: %v", err)
+	}
+	if watch > 0 {
+		watchStatus(d.Flash, watch)
+		return
+	}
+	regs, err := d.Flash.ReadStatusRegisters()
+	if err != nil {
+		fatalf("read flash status registers: %v", err)
+	}
+	prot := d.Flash.Protection(regs)
+	var erased *wearRecord
+	if wearFile != "" {
+		records, err := loadWear()
+		if err != nil {
+			fatalf("wear: %v", err)
+		}
+		key, _ := wearKey(d.Flash)
+		if r, ok := records[key]; ok {
+			erased = &r
+		}
+	}
+
+	if jsonOut {
+		out := statusJSON{
+			ID:        fmt.Sprintf("%X", flashID),
+			Name:      name,
+			Size:      knownSize(d.Flash, name),
+			SR:        byte(regs.SR),
+			Protected: [2]int{prot.Start, prot.End},
+			CDone:     cdone,
+			Wear:      erased,
+		}
+		if regs.HasSR2 {
+			sr2, sr3 := byte(regs.SR2), byte(regs.SR3)
+			out.SR2, out.SR3 = &sr2, &sr3
+		}
+		if regs.HasFlag {
+			flag := byte(regs.Flag)
+			out.Flag = &flag
+		}
+		printJSON(out)
+		return
+	}
+
+	if name == "" {
+		fmt.Printf("Flash:           %X (unknown)\n", flashID)
+	} else {
+		fmt.Printf("Flash:           %X %s, %d bytes\n", flashID, name, d.Flash.Size())
+	}
+	fmt.Printf("Status:          %s\n", regs.SR)
+	if regs.HasSR2 {
+		fmt.Printf("Status 2:        %s\n", regs.SR2)
+		fmt.Printf("Status 3:        %s\n", regs.SR3)
+	}
+	if regs.HasFlag {
+		fmt.Printf("Flag status:     %s\n", regs.Flag)
+	}
+	fmt.Printf("Protected:       %s\n", prot)
+	switch {
+	case erased != nil:
+		fmt.Printf("Erased:          %d x 4KB, %d x 64KB, %d x chip since %s\n",
+			erased.Erased4KB, erased.Erased64KB, erased.ErasedChip, erased.Since.Local().Format(time.DateOnly))
+	case wearFile != "":
+		fmt.Printf("Erased:          not recorded\n")
+	}
+	if cdone != nil {
+		fmt.Printf("CDONE:           %s\n", gpio.Level(*cdone))
+	}
+}
+
+// watchStatus prints the status registers with a timestamp whenever they
+// change, polling them every interval until interrupted.
+func watchStatus(f *gice.Flash, interval time.Duration) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var last string
+	polls := 0
+	for {
+		regs, err := f.ReadStatusRegisters()
+		if err != nil {
+			fatalf("read flash status registers: %v", err)
+		}
+		polls++
+		line := fmt.Sprintf("SR %s", regs.SR)
+		if regs.HasSR2 {
+			line += fmt.Sprintf("  SR2 %s  SR3 %s", regs.SR2, regs.SR3)
+		}
+		if regs.HasFlag {
+			line += fmt.Sprintf("  FSR %s", regs.Flag)
+		}
+		if line != last {
+			fmt.Printf("%s  %s\n", time.Now().Format("15:04:05.000"), line)
+			last = line
+		}
+		select {
+		case <-ctx.Done():
+			fmt.Printf("%d polls\n", polls)
+			return
+		case <-ticker.C:
+		}
+	}
+}
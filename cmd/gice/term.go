@@ -0,0 +1,96 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/gentam/gice"
+	"periph.io/x/host/v3/ftdi"
+)
+
+func termCommand(args []string) {
+	fs := flag.NewFlagSet("term", flag.ExitOnError)
+	var (
+		port string
+		baud int
+	)
+	fs.StringVar(&port, "port", "", "serial port (default: channel B of the device)")
+	fs.IntVar(&baud, "baud", 115200, "baud rate")
+	if err := fs.Parse(args); err != nil {
+		fatalUsage("invalid arguments: %v", err)
+	}
+
+	if port == "" {
+		d := openDevice()
+		var err error
+		if port, err = uartPath(d); err != nil {
+			fatalf("%v", err)
+		}
+	}
+	if err := terminal(port, baud); err != nil {
+		fatalf("terminal: %v", err)
+	}
+}
+
+// uartPath returns the serial port of the UART (channel B) of the FT2232H used
+// by d.
+func uartPath(d *gice.Device) (string, error) {
+	if d.FTDI == nil {
+		return "", errors.New("no FTDI UART; use -port")
+	}
+	ee := ftdi.EEPROM{}
+	if err := d.FTDI.EEPROM(&ee); err != nil {
+		return "", fmt.Errorf("read EEPROM: %w", err)
+	}
+	if ee.Serial == "" {
+		return "", fmt.Errorf("device has no serial number; specify the serial port")
+	}
+	return findUART(ee.Serial)
+}
+
+// terminal connects stdin and stdout to the serial port at path until
+// interrupted or either side is closed.
+func terminal(path string, baud int) error {
+	port, err := openSerial(path, baud)
+	if err != nil {
+		return err
+	}
+	defer port.Close()
+
+	// Set stdin to raw mode if it is a terminal, keeping signals so that
+	// interrupt exits the terminal
+	restore, err := rawStdin()
+	if err != nil {
+		return fmt.Errorf("set stdin attributes: %w", err)
+	}
+	defer restore()
+
+	slog.Info("connected; press Ctrl-C to exit", "port", path, "baud", baud)
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sig)
+
+	errc := make(chan error, 2)
+	go func() {
+		_, err := io.Copy(port, os.Stdin)
+		errc <- err
+	}()
+	go func() {
+		_, err := io.Copy(os.Stdout, port)
+		errc <- err
+	}()
+
+	select {
+	case <-sig:
+		return nil
+	case err := <-errc:
+		return err
+	}
+}
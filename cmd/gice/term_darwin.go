@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	ioctlGetTermios = syscall.TIOCGETA
+	ioctlSetTermios = syscall.TIOCSETA
+)
+
+func ioctl(fd int, req uintptr, term *syscall.Termios) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), req, uintptr(unsafe.Pointer(term)))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// setSpeed sets the baud rate. Darwin accepts arbitrary rates.
+func setSpeed(t *syscall.Termios, baud int) error {
+	t.Ispeed = uint64(baud)
+	t.Ospeed = uint64(baud)
+	return nil
+}
+
+// findUART returns /dev/cu.usbserial-<serial>1, the second interface of the
+// FT2232H with the given serial number.
+func findUART(serial string) (string, error) {
+	matches, _ := filepath.Glob("/dev/cu.usbserial-" + serial + "1")
+	if len(matches) == 0 {
+		return "", fmt.Errorf("no serial port found for device %q", serial)
+	}
+	return matches[0], nil
+}
+
+// unlockPTY grants and unlocks the pseudo terminal master fd and returns the
+// path of its slave side.
+func unlockPTY(fd int) (string, error) {
+	for _, req := range []uintptr{syscall.TIOCPTYGRANT, syscall.TIOCPTYUNLK} {
+		if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), req, 0); errno != 0 {
+			return "", errno
+		}
+	}
+	name := make([]byte, 128)
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), syscall.TIOCPTYGNAME, uintptr(unsafe.Pointer(&name[0]))); errno != 0 {
+		return "", errno
+	}
+	name, _, _ = bytes.Cut(name, []byte{0})
+	return string(name), nil
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	ioctlGetTermios = syscall.TCGETS
+	ioctlSetTermios = syscall.TCSETS
+
+	cbaud = 0o10017 // CBAUD | CBAUDEX
+)
+
+func ioctl(fd int, req uintptr, term *syscall.Termios) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), req, uintptr(unsafe.Pointer(term)))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+var baudRates = map[int]uint32{
+	9600:    syscall.B9600,
+	19200:   syscall.B19200,
+	38400:   syscall.B38400,
+	57600:   syscall.B57600,
+	115200:  syscall.B115200,
+	230400:  syscall.B230400,
+	460800:  syscall.B460800,
+	921600:  syscall.B921600,
+	1000000: syscall.B1000000,
+	2000000: syscall.B2000000,
+	3000000: syscall.B3000000,
+}
+
+func setSpeed(t *syscall.Termios, baud int) error {
+	b, ok := baudRates[baud]
+	if !ok {
+		return fmt.Errorf("unsupported baud rate %d", baud)
+	}
+	t.Cflag = t.Cflag&^cbaud | b
+	t.Ispeed = b
+	t.Ospeed = b
+	return nil
+}
+
+// findUART returns the udev link of the second interface of the FT2232H with
+// the given serial number.
+func findUART(serial string) (string, error) {
+	matches, _ := filepath.Glob("/dev/serial/by-id/usb-*_" + serial + "-if01-port0")
+	if len(matches) == 0 {
+		return "", fmt.Errorf("no serial port found for device %q", serial)
+	}
+	return filepath.EvalSymlinks(matches[0])
+}
+
+// unlockPTY unlocks the pseudo terminal master fd and returns the path of its
+// slave side.
+func unlockPTY(fd int) (string, error) {
+	var n uint32
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), syscall.TIOCSPTLCK, uintptr(unsafe.Pointer(&n))); errno != 0 {
+		return "", errno
+	}
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), syscall.TIOCGPTN, uintptr(unsafe.Pointer(&n))); errno != 0 {
+		return "", errno
+	}
+	return "/dev/pts/" + strconv.Itoa(int(n)), nil
+}
@@ -0,0 +1,93 @@
+//go:build darwin || linux
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// openSerial opens the serial port at path in raw mode.
+func openSerial(path string, baud int) (*os.File, error) {
+	fd, err := syscall.Open(path, syscall.O_RDWR|syscall.O_NOCTTY|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, fmt.Errorf("open %q: %w", path, err)
+	}
+	port := os.NewFile(uintptr(fd), path)
+
+	term, err := getTerm(fd)
+	if err != nil {
+		port.Close()
+		return nil, fmt.Errorf("get serial port attributes: %w", err)
+	}
+	if err := setSpeed(&term, baud); err != nil {
+		port.Close()
+		return nil, err
+	}
+	makeRaw(&term)
+	if err := setTerm(fd, term); err != nil {
+		port.Close()
+		return nil, fmt.Errorf("set serial port attributes: %w", err)
+	}
+	return port, nil
+}
+
+// openPTY creates a pseudo terminal and returns its master side and the path of
+// the slave side. The slave is set to raw mode and kept open, so that clients
+// can close and reopen it without ending the session.
+func openPTY() (*os.File, string, error) {
+	fd, err := syscall.Open("/dev/ptmx", syscall.O_RDWR|syscall.O_NOCTTY|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, "", err
+	}
+	master := os.NewFile(uintptr(fd), "/dev/ptmx")
+	path, err := unlockPTY(fd)
+	if err != nil {
+		master.Close()
+		return nil, "", err
+	}
+	if _, err := openSerial(path, 115200); err != nil {
+		master.Close()
+		return nil, "", err
+	}
+	return master, path, nil
+}
+
+// rawStdin disables line buffering and echo of stdin if it is a terminal, and
+// returns a function restoring the previous mode.
+func rawStdin() (func(), error) {
+	stdin, err := getTerm(syscall.Stdin)
+	if err != nil {
+		return func() {}, nil
+	}
+	raw := stdin
+	raw.Lflag &^= syscall.ICANON | syscall.ECHO
+	raw.Cc[syscall.VMIN] = 1
+	raw.Cc[syscall.VTIME] = 0
+	if err := setTerm(syscall.Stdin, raw); err != nil {
+		return nil, err
+	}
+	return func() { setTerm(syscall.Stdin, stdin) }, nil
+}
+
+func makeRaw(t *syscall.Termios) {
+	t.Iflag &^= syscall.IGNBRK | syscall.BRKINT | syscall.PARMRK | syscall.ISTRIP |
+		syscall.INLCR | syscall.IGNCR | syscall.ICRNL | syscall.IXON
+	t.Oflag &^= syscall.OPOST
+	t.Lflag &^= syscall.ECHO | syscall.ECHONL | syscall.ICANON | syscall.ISIG | syscall.IEXTEN
+	t.Cflag &^= syscall.CSIZE | syscall.PARENB
+	t.Cflag |= syscall.CS8 | syscall.CREAD | syscall.CLOCAL
+	t.Cc[syscall.VMIN] = 1
+	t.Cc[syscall.VTIME] = 0
+}
+
+func getTerm(fd int) (syscall.Termios, error) {
+	term := syscall.Termios{}
+	err := ioctl(fd, ioctlGetTermios, &term)
+	return term, err
+}
+
+func setTerm(fd int, term syscall.Termios) error {
+	return ioctl(fd, ioctlSetTermios, &term)
+}
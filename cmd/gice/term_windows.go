@@ -0,0 +1,193 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	kernel32            = syscall.NewLazyDLL("kernel32.dll")
+	procSetConsoleMode  = kernel32.NewProc("SetConsoleMode")
+	procGetCommState    = kernel32.NewProc("GetCommState")
+	procSetCommState    = kernel32.NewProc("SetCommState")
+	procSetCommTimeouts = kernel32.NewProc("SetCommTimeouts")
+)
+
+// Console modes of SetConsoleMode
+const (
+	enableLineInput            = 0x0002
+	enableEchoInput            = 0x0004
+	enableVirtualTerminalInput = 0x0200
+)
+
+// dcb is the DCB structure of the Windows communications API.
+type dcb struct {
+	DCBlength  uint32
+	BaudRate   uint32
+	Flags      uint32 // fBinary, fParity, ..., fDtrControl, ..., fRtsControl
+	wReserved  uint16
+	XonLim     uint16
+	XoffLim    uint16
+	ByteSize   byte
+	Parity     byte
+	StopBits   byte
+	XonChar    byte
+	XoffChar   byte
+	ErrorChar  byte
+	EofChar    byte
+	EvtChar    byte
+	wReserved1 uint16
+}
+
+const (
+	dcbBinary     = 1 << 0
+	dcbDTREnable  = 1 << 4 // DTR_CONTROL_ENABLE
+	dcbRTSEnable  = 1 << 12
+	dcbOneStopBit = 0
+	dcbNoParity   = 0
+)
+
+type commTimeouts struct {
+	ReadIntervalTimeout         uint32
+	ReadTotalTimeoutMultiplier  uint32
+	ReadTotalTimeoutConstant    uint32
+	WriteTotalTimeoutMultiplier uint32
+	WriteTotalTimeoutConstant   uint32
+}
+
+// openSerial opens the serial port (e.g. "COM3") at path in raw mode, 8N1
+// without flow control.
+func openSerial(path string, baud int) (*os.File, error) {
+	name := path
+	if !strings.HasPrefix(name, `\\.\`) {
+		name = `\\.\` + name // required for COM10 and above
+	}
+	p, err := syscall.UTF16PtrFromString(name)
+	if err != nil {
+		return nil, err
+	}
+	h, err := syscall.CreateFile(p, syscall.GENERIC_READ|syscall.GENERIC_WRITE, 0, nil, syscall.OPEN_EXISTING, 0, 0)
+	if err != nil {
+		return nil, fmt.Errorf("open %q: %w", path, err)
+	}
+	port := os.NewFile(uintptr(h), path)
+
+	state := dcb{}
+	state.DCBlength = uint32(unsafe.Sizeof(state))
+	if r, _, err := procGetCommState.Call(uintptr(h), uintptr(unsafe.Pointer(&state))); r == 0 {
+		port.Close()
+		return nil, fmt.Errorf("get serial port state: %w", err)
+	}
+	state.BaudRate = uint32(baud)
+	state.Flags = dcbBinary | dcbDTREnable | dcbRTSEnable
+	state.ByteSize = 8
+	state.Parity = dcbNoParity
+	state.StopBits = dcbOneStopBit
+	if r, _, err := procSetCommState.Call(uintptr(h), uintptr(unsafe.Pointer(&state))); r == 0 {
+		port.Close()
+		return nil, fmt.Errorf("set serial port state: %w", err)
+	}
+
+	// Return as soon as a byte is available, and block until then: a read of
+	// zero bytes is taken as the end of file
+	timeouts := commTimeouts{
+		ReadIntervalTimeout:        math.MaxUint32,
+		ReadTotalTimeoutMultiplier: math.MaxUint32,
+		ReadTotalTimeoutConstant:   math.MaxUint32 - 1,
+	}
+	if r, _, err := procSetCommTimeouts.Call(uintptr(h), uintptr(unsafe.Pointer(&timeouts))); r == 0 {
+		port.Close()
+		return nil, fmt.Errorf("set serial port timeouts: %w", err)
+	}
+	return port, nil
+}
+
+// openPTY is not available, as Windows has no pseudo terminals that flashrom
+// could open as a serial port.
+func openPTY() (*os.File, string, error) {
+	return nil, "", errors.New("pseudo terminals are not supported on Windows; use -listen")
+}
+
+// rawStdin disables line input and echo of the console, keeping Ctrl-C as an
+// interrupt, and returns a function restoring the previous mode.
+func rawStdin() (func(), error) {
+	stdin, err := syscall.GetStdHandle(syscall.STD_INPUT_HANDLE)
+	if err != nil {
+		return nil, err
+	}
+	var mode uint32
+	if err := syscall.GetConsoleMode(stdin, &mode); err != nil {
+		return func() {}, nil // not a console
+	}
+	raw := mode&^(enableLineInput|enableEchoInput) | enableVirtualTerminalInput
+	if r, _, err := procSetConsoleMode.Call(uintptr(stdin), uintptr(raw)); r == 0 {
+		return nil, err
+	}
+	return func() { procSetConsoleMode.Call(uintptr(stdin), uintptr(mode)) }, nil
+}
+
+// findUART returns the COM port that the FTDI VCP driver assigned to the second
+// interface of the FT2232H with the given serial number, as recorded in
+// HKLM\SYSTEM\CurrentControlSet\Enum\FTDIBUS\VID_0403+PID_xxxx+<serial>B.
+func findUART(serial string) (string, error) {
+	const enum = `SYSTEM\CurrentControlSet\Enum\FTDIBUS`
+	bus, err := openKey(syscall.HKEY_LOCAL_MACHINE, enum)
+	if err != nil {
+		return "", fmt.Errorf("no serial port found for device %q: %w", serial, err)
+	}
+	defer syscall.RegCloseKey(bus)
+
+	name := make([]uint16, 256)
+	for i := uint32(0); ; i++ {
+		n := uint32(len(name))
+		if err := syscall.RegEnumKeyEx(bus, i, &name[0], &n, nil, nil, nil, nil); err != nil {
+			break
+		}
+		dev := syscall.UTF16ToString(name[:n])
+		if !strings.HasSuffix(dev, "+"+serial+"B") {
+			continue
+		}
+		params, err := openKey(bus, dev+`\0000\Device Parameters`)
+		if err != nil {
+			continue
+		}
+		port, err := queryString(params, "PortName")
+		syscall.RegCloseKey(params)
+		if err == nil && port != "" {
+			return port, nil
+		}
+	}
+	return "", fmt.Errorf("no serial port found for device %q; is the VCP driver enabled for channel B?", serial)
+}
+
+func openKey(parent syscall.Handle, path string) (syscall.Handle, error) {
+	p, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return 0, err
+	}
+	var k syscall.Handle
+	err = syscall.RegOpenKeyEx(parent, p, 0, syscall.KEY_READ, &k)
+	return k, err
+}
+
+func queryString(k syscall.Handle, name string) (string, error) {
+	p, err := syscall.UTF16PtrFromString(name)
+	if err != nil {
+		return "", err
+	}
+	buf := make([]uint16, 64)
+	n := uint32(len(buf) * 2)
+	var typ uint32
+	if err := syscall.RegQueryValueEx(k, p, nil, &typ, (*byte)(unsafe.Pointer(&buf[0])), &n); err != nil {
+		return "", err
+	}
+	if typ != syscall.REG_SZ {
+		return "", fmt.Errorf("%s is not a string", name)
+	}
+	return syscall.UTF16ToString(buf[:n/2]), nil
+}
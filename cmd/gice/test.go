@@ -0,0 +1,357 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"flag"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"os"
+	"time"
+
+	"github.com/gentam/gice"
+	"github.com/gentam/gice/flash"
+	"periph.io/x/conn/v3/physic"
+)
+
+const testUsage = `Usage:
+	test pattern -n SIZE [-a ADDR] [-seed N]  write, read back and verify pseudo-random data
+	test all [-a ADDR]                        run the self-test suite and report each check
+
+The pattern test overwrites the flash range it uses; the suite restores the
+scratch subsector and the protection bits it changes.
+
+Run "test <command> -h" for the flags.
+`
+
+func testCommand(args []string) {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, testUsage)
+		os.Exit(exitUsage)
+	}
+	switch args[0] {
+	case "pattern":
+		testPatternCommand(args[1:])
+	case "all":
+		testAllCommand(args[1:])
+	default:
+		fmt.Fprint(os.Stderr, testUsage)
+		os.Exit(exitUsage)
+	}
+}
+
+func testPatternCommand(args []string) {
+	fs := flag.NewFlagSet("test pattern", flag.ExitOnError)
+	var (
+		addr     int
+		size     int
+		seed     uint64
+		maxLines int
+	)
+	sizeVar(fs, &addr, "a", 0, "start address, a multiple of 4KB")
+	sizeVar(fs, &size, "n", 0, "number of bytes to test, a multiple of 4KB")
+	fs.Uint64Var(&seed, "seed", 0, "seed of the pseudo-random data (default: random, printed for reruns)")
+	fs.IntVar(&maxLines, "max", 32, "maximum number of error addresses to print (0: all)")
+	if err := fs.Parse(args); err != nil {
+		fatalUsage("invalid arguments: %v", err)
+	}
+	const subsectorSize = 4 << 10
+	switch {
+	case size <= 0:
+		fatalUsage("missing -n")
+	case addr < 0 || addr%subsectorSize != 0 || size%subsectorSize != 0:
+		fatalUsage("-a and -n must be multiples of 4KB")
+	}
+	if !isFlagSet(fs, "seed") {
+		seed = rand.Uint64()
+	}
+
+	d := openFlash()
+	defer closeFlash(d)
+	if addr+size > d.Flash.Size() {
+		fatalf("0x%06X-0x%06X exceeds the flash size 0x%X", addr, addr+size, d.Flash.Size())
+	}
+
+	want := patternData(seed, size)
+	slog.Info("testing", addrAttr("addr", addr), "size", size, "seed", seed)
+	start := time.Now()
+	if err := d.Flash.WriteRegions([]gice.Region{{Addr: addr, Data: want}}); err != nil {
+		fatalf("write flash: %v", err)
+	}
+	written := time.Since(start)
+	got, err := d.Flash.Read(addr, size)
+	if err != nil {
+		fatalf("read flash: %v", err)
+	}
+	read := time.Since(start) - written
+
+	errs := 0
+	for i := range want {
+		if want[i] == got[i] {
+			continue
+		}
+		errs++
+		if maxLines == 0 || errs <= maxLines {
+			fmt.Printf("0x%06X: wrote %02x, read %02x (bits %08b)\n", addr+i, want[i], got[i], want[i]^got[i])
+		}
+	}
+	if maxLines > 0 && errs > maxLines {
+		fmt.Printf("... %d more errors\n", errs-maxLines)
+	}
+	slog.Info("tested", "errors", errs, "write", written.Round(time.Millisecond), "read", read.Round(time.Millisecond))
+	if errs > 0 {
+		exitf(exitVerifyMismatch, "test failed: %d of %d bytes differ (seed %d)", errs, size, seed)
+	}
+	fmt.Println("OK")
+}
+
+// patternData returns size pseudo-random bytes, the same for the same seed.
+func patternData(seed uint64, size int) []byte {
+	r := rand.New(rand.NewPCG(seed, 0))
+	data := make([]byte, (size+7)/8*8)
+	for i := 0; i < len(data); i += 8 {
+		binary.LittleEndian.PutUint64(data[i:], r.Uint64())
+	}
+	return data[:size]
+}
+
+func testAllCommand(args []string) {
+	fs := flag.NewFlagSet("test all", flag.ExitOnError)
+	var (
+		scratch int
+	)
+	sizeVar(fs, &scratch, "a", -1, "scratch 4KB subsector for the write tests (default: the last one)")
+	if err := fs.Parse(args); err != nil {
+		fatalUsage("invalid arguments: %v", err)
+	}
+
+	d := openDevice()
+	holdFlash(d)
+	defer closeFlash(d)
+
+	const subsectorSize = 4 << 10
+	t := &selfTest{doctor: &doctor{}, d: d}
+	if t.id() {
+		if scratch < 0 {
+			scratch = d.Flash.Size() - subsectorSize
+		}
+		if scratch%subsectorSize != 0 || scratch+subsectorSize > d.Flash.Size() {
+			fatalUsage("-a 0x%X is not a 4KB subsector of the flash", scratch)
+		}
+		t.scratch = scratch
+		t.sfdp()
+		if t.write() {
+			t.speed()
+			t.protection()
+		}
+	}
+	if t.failed {
+		fmt.Println("FAIL")
+		exit(exitError)
+	}
+	fmt.Println("PASS")
+}
+
+// selfTest runs the checks of "test all", reporting them like doctor.
+type selfTest struct {
+	*doctor
+	d       *gice.Device
+	name    string // of the flash, if known
+	scratch int    // address of the scratch subsector
+	saved   []byte // original content of the scratch subsector
+}
+
+// id checks that the flash answers with an ID.
+func (t *selfTest) id() bool {
+	id, name, err := t.d.Flash.ReadID()
+	switch {
+	case err != nil:
+		t.fail("read ID: %v", err)
+		return false
+	case id == [3]byte{} || id == [3]byte{0xFF, 0xFF, 0xFF}:
+		t.fail("read ID: no answer (ID %X)", id)
+		return false
+	case name == "":
+		t.warn("read ID: unknown flash %X", id)
+	default:
+		t.ok("read ID: %X %s, %d bytes", id, name, t.d.Flash.Size())
+	}
+	t.name = name
+	return true
+}
+
+// sfdp dumps the SFDP header and checks the density against the ID.
+func (t *selfTest) sfdp() {
+	s, err := t.d.Flash.ReadSFDPHeader()
+	if err != nil {
+		t.warn("SFDP: %v", err)
+		return
+	}
+	t.ok("SFDP: revision %d.%d, %d parameter tables", s.Major, s.Minor, len(s.Params))
+	for _, p := range s.Params {
+		t.hint("table 0x%04X revision %d.%d at 0x%06X, %d bytes", p.ID, p.Major, p.Minor, p.Addr, p.Size)
+	}
+	size, err := t.d.Flash.SFDPDensity(s)
+	switch {
+	case err != nil:
+		t.warn("SFDP density: %v", err)
+	case t.name != "" && size != t.d.Flash.Size():
+		t.fail("SFDP density: %d bytes, but the ID says %d", size, t.d.Flash.Size())
+	default:
+		t.ok("SFDP density: %d bytes", size)
+	}
+}
+
+// write erases, programs and verifies the scratch subsector, and restores its
+// content.
+func (t *selfTest) write() bool {
+	const subsectorSize = 4 << 10
+	f := t.d.Flash
+	var err error
+	if t.saved, err = f.Read(t.scratch, subsectorSize); err != nil {
+		t.fail("read scratch 0x%06X: %v", t.scratch, err)
+		return false
+	}
+	restore := func() {
+		if bytes.Equal(t.saved, mustRead(f, t.scratch, subsectorSize)) {
+			return
+		}
+		if err := f.WriteRegions([]gice.Region{{Addr: t.scratch, Data: t.saved}}); err != nil {
+			t.fail("restore scratch 0x%06X: %v", t.scratch, err)
+		}
+	}
+	defer restore()
+
+	if err := f.Erase4KB(t.scratch); err != nil {
+		t.fail("erase 0x%06X: %v", t.scratch, err)
+		return false
+	}
+	if got := mustRead(f, t.scratch, subsectorSize); !bytes.Equal(got, bytes.Repeat([]byte{0xFF}, subsectorSize)) {
+		t.fail("erase 0x%06X: not blank after erasing", t.scratch)
+		return false
+	}
+	t.ok("erase 0x%06X", t.scratch)
+
+	want := patternData(rand.Uint64(), subsectorSize)
+	if err := f.WriteAt(bytes.NewReader(want), t.scratch); err != nil {
+		t.fail("program 0x%06X: %v", t.scratch, err)
+		return false
+	}
+	if got := mustRead(f, t.scratch, subsectorSize); !bytes.Equal(got, want) {
+		t.fail("program 0x%06X: %d bytes differ", t.scratch, countDiff(got, want))
+		return false
+	}
+	t.ok("program and verify 0x%06X", t.scratch)
+	return true
+}
+
+// speed reads 64KB around the scratch subsector at decreasing SPI clocks,
+// comparing each read with the first one, and reports the throughput.
+func (t *selfTest) speed() {
+	const subsectorSize = 4 << 10
+	clocks := []physic.Frequency{30 * physic.MegaHertz, 15 * physic.MegaHertz, 10 * physic.MegaHertz, 5 * physic.MegaHertz, physic.MegaHertz}
+	defer t.d.SetClock(clocks[0])
+	const size = 16 * subsectorSize
+	addr := min(t.scratch, t.d.Flash.Size()-size)
+	var ref []byte
+	for _, c := range clocks {
+		if err := t.d.SetClock(c); err != nil {
+			t.fail("speed %s: %v", c, err)
+			return
+		}
+		start := time.Now()
+		got, err := t.d.Flash.Read(addr, size)
+		elapsed := time.Since(start)
+		switch {
+		case err != nil:
+			t.fail("speed %s: %v", c, err)
+		case ref != nil && !bytes.Equal(got, ref):
+			t.fail("speed %s: read differs from %s", c, clocks[0])
+		default:
+			t.ok("speed %s: %.0f KB/s", c, float64(size)/1024/elapsed.Seconds())
+		}
+		if ref == nil {
+			ref = got
+		}
+	}
+}
+
+// protection protects the scratch subsector, checks that erasing it has no
+// effect, and restores the status registers.
+func (t *selfTest) protection() {
+	const subsectorSize = 4 << 10
+	f := t.d.Flash
+	if t.name == "" {
+		t.warn("protection: skipped for an unknown flash")
+		return
+	}
+	regs, err := f.ReadStatusRegisters()
+	if err != nil {
+		t.fail("protection: %v", err)
+		return
+	}
+	if regs.SR.StatusRegisterProtect() {
+		t.warn("protection: skipped, the status register is protected (SRP)")
+		return
+	}
+	var p flash.Protection
+	for _, q := range f.Protections() {
+		if q.Start <= t.scratch && t.scratch+subsectorSize <= q.End {
+			p = q
+			break
+		}
+	}
+	if p.Size() == 0 {
+		t.warn("protection: no range covers 0x%06X", t.scratch)
+		return
+	}
+	defer func() {
+		if regs.HasSR2 {
+			if err := f.WriteStatusRegister2(regs.SR2); err != nil {
+				t.fail("restore status register 2: %v", err)
+			}
+		}
+		if err := f.WriteStatusRegister(regs.SR); err != nil {
+			t.fail("restore status register: %v", err)
+		}
+	}()
+
+	if err := f.SetProtection(p); err != nil {
+		t.fail("protect %s: %v", p, err)
+		return
+	}
+	// Bypass the reserved ranges, as the flash itself must refuse the erase
+	reserved := f.Reserved
+	f.Reserved = nil
+	err = f.Erase4KB(t.scratch)
+	f.Reserved = reserved
+	if err != nil {
+		t.fail("erase while protected: %v", err)
+		return
+	}
+	if got := mustRead(f, t.scratch, subsectorSize); !bytes.Equal(got, t.saved) {
+		t.fail("protect %s: the protected subsector was erased", p)
+		return
+	}
+	t.ok("protect %s: erase ignored", p)
+}
+
+// mustRead reads the flash, returning nil on error so that comparisons fail.
+func mustRead(f *gice.Flash, addr, n int) []byte {
+	data, err := f.Read(addr, n)
+	if err != nil {
+		return nil
+	}
+	return data
+}
+
+func countDiff(a, b []byte) int {
+	n := 0
+	for i := range a {
+		if a[i] != b[i] {
+			n++
+		}
+	}
+	return n
+}
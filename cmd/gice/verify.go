@@ -0,0 +1,241 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gentam/gice"
+	"github.com/gentam/gice/board"
+)
+
+func verifyCommand(args []string) {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	var (
+		format    string
+		family    uint
+		maxLines  int
+		jsonOut   bool
+		golden    string
+		boardName string
+	)
+	fs.StringVar(&format, "format", "auto", "input format: "+formatNames())
+	fs.UintVar(&family, "uf2-family", 0, "only verify UF2 blocks with the family ID (0: any)")
+	fs.IntVar(&maxLines, "max", 32, "maximum number of differing lines to print (0: all)")
+	fs.BoolVar(&jsonOut, "json", false, "print the result as JSON instead of the differences")
+	fs.StringVar(&golden, "golden", "", "compare the flash with the expected images of the board profile in `dir`, see below")
+	fs.StringVar(&boardName, "board", "", "board profile for -golden: "+strings.Join(board.Names(), ", "))
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage:\n\tverify [flags] FILE|-\n\tverify [flags] -golden DIR")
+		fs.PrintDefaults()
+		fmt.Fprint(os.Stderr, goldenUsage)
+	}
+	if err := fs.Parse(args); err != nil {
+		fatalUsage("invalid arguments: %v", err)
+	}
+
+	if golden != "" {
+		if fs.NArg() > 0 {
+			fatalUsage("-golden takes no input file")
+		}
+		verifyGolden(golden, boardName, format, uint32(family), maxLines, jsonOut)
+		return
+	}
+	if boardName != "" {
+		fatalUsage("-board requires -golden")
+	}
+	inFilePath := fs.Arg(0)
+	if inFilePath == "" {
+		fatalUsage("missing input")
+	}
+	inFile := os.Stdin
+	if inFilePath != "-" {
+		f, err := os.Open(inFilePath)
+		if err != nil {
+			fatalf("open %q: %v", inFilePath, err)
+		}
+		defer f.Close()
+		inFile = f
+	}
+	data, err := io.ReadAll(inFile)
+	if err != nil {
+		fatalf("read input: %v", err)
+	}
+	regions, err := gice.DecodeImage(data, gice.Format(format), uint32(family))
+	if err != nil {
+		fatalf("decode input: %v", err)
+	}
+
+	d := openDevice()
+
+	holdFlash(d)
+	defer closeFlash(d)
+
+	diffOut := io.Writer(os.Stdout)
+	if jsonOut {
+		diffOut = io.Discard
+	}
+	result := compareRegions(d, regions, diffOut, maxLines)
+	if jsonOut {
+		printJSON(result)
+	}
+	if !result.OK {
+		exitf(exitVerifyMismatch, "verify failed: %d bytes differ", result.Mismatches)
+	}
+	if !jsonOut {
+		fmt.Println("OK")
+	}
+}
+
+// compareRegions reads the regions back from the flash, printing the
+// differences to w.
+func compareRegions(d *gice.Device, regions []gice.Region, w io.Writer, maxLines int) verifyJSON {
+	color, _ := isTTY(os.Stdout)
+	result := verifyJSON{Regions: []verifyRegionJSON{}}
+	for _, r := range regions {
+		got, err := d.Flash.Read(r.Addr, len(r.Data))
+		if err != nil {
+			fatalf("read flash: %v", err)
+		}
+		n := hexDiff(w, r.Addr, r.Data, got, maxLines, color)
+		result.Regions = append(result.Regions, verifyRegionJSON{Addr: r.Addr, Size: len(r.Data), Mismatches: n})
+		result.Mismatches += n
+	}
+	result.OK = result.Mismatches == 0
+	return result
+}
+
+// verifyJSON is the output of "verify -json".
+type verifyJSON struct {
+	OK         bool               `json:"ok"`
+	Mismatches int                `json:"mismatches"` // number of differing bytes
+	Regions    []verifyRegionJSON `json:"regions"`
+}
+
+type verifyRegionJSON struct {
+	Addr       int `json:"addr"`
+	Size       int `json:"size"`
+	Mismatches int `json:"mismatches"`
+}
+
+const goldenUsage = `
+With -golden, the flash is compared with every image in DIR/BOARD, BOARD
+being the board profile (detected, or given with -board):
+
+	DIR/icebreaker/flash.bin    compared at the addresses it carries, 0 for a binary
+	DIR/icebreaker/slot0.bin    compared at warm boot slot 0 of the board, and so on
+
+An image that cannot be decoded or does not fit fails like a mismatch. The
+report lists each image with PASS or FAIL, and ends with PASS if they all
+match; -json prints it as JSON. Exits with status 5 unless every image matches.
+`
+
+// goldenJSON is the output of "verify -golden -json".
+type goldenJSON struct {
+	OK     bool              `json:"ok"`
+	Board  string            `json:"board"`
+	Dir    string            `json:"dir"` // of the board profile
+	Images []goldenImageJSON `json:"images"`
+}
+
+type goldenImageJSON struct {
+	File string `json:"file"`           // relative to Dir
+	Slot *int   `json:"slot,omitempty"` // warm boot slot of slotN files
+	verifyJSON
+	Error string `json:"error,omitempty"` // why the image was not compared
+}
+
+// verifyGolden compares the flash with the golden images of the board, see
+// goldenUsage.
+func verifyGolden(dir, boardName, format string, family uint32, maxLines int, jsonOut bool) {
+	d := openDevice(gice.WithBoard(lookupBoard(boardName)))
+	warnGenericBoard(d, boardName)
+	dir = filepath.Join(dir, d.Board.Name)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		fatalf("golden images of board %s: %v", d.Board.Name, err)
+	}
+
+	holdFlash(d)
+	defer closeFlash(d)
+
+	diffOut := io.Writer(os.Stdout)
+	if jsonOut {
+		diffOut = io.Discard
+	}
+	report := goldenJSON{OK: true, Board: d.Board.Name, Dir: dir, Images: []goldenImageJSON{}}
+	for _, e := range entries {
+		if !e.Type().IsRegular() || strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+		img := goldenImageJSON{File: e.Name(), verifyJSON: verifyJSON{Regions: []verifyRegionJSON{}}}
+		regions, err := goldenRegions(d, filepath.Join(dir, e.Name()), format, family, &img)
+		if err != nil {
+			img.Error = err.Error()
+		} else {
+			img.verifyJSON = compareRegions(d, regions, diffOut, maxLines)
+		}
+		switch {
+		case img.Error != "":
+			fmt.Fprintf(diffOut, "FAIL %s: %s\n", img.File, img.Error)
+		case !img.OK:
+			fmt.Fprintf(diffOut, "FAIL %s: %d bytes differ\n", img.File, img.Mismatches)
+		default:
+			fmt.Fprintf(diffOut, "PASS %s\n", img.File)
+		}
+		report.OK = report.OK && img.OK
+		report.Images = append(report.Images, img)
+	}
+	if len(report.Images) == 0 {
+		fatalf("no golden images in %s", dir)
+	}
+	if jsonOut {
+		printJSON(report)
+	}
+	if !report.OK {
+		exitf(exitVerifyMismatch, "verify failed: %d of %d golden images differ", countFailed(report.Images), len(report.Images))
+	}
+	if !jsonOut {
+		fmt.Println("PASS")
+	}
+}
+
+// goldenRegions decodes the golden image at path, placing slotN images at
+// their slot.
+func goldenRegions(d *gice.Device, path, format string, family uint32, img *goldenImageJSON) ([]gice.Region, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	regions, err := gice.DecodeImage(data, gice.Format(format), family)
+	if err != nil {
+		return nil, fmt.Errorf("decode: %w", err)
+	}
+	base, _, _ := strings.Cut(img.File, ".")
+	if n, ok := strings.CutPrefix(base, "slot"); ok && len(n) == 1 && '0' <= n[0] && n[0] <= '3' {
+		slot := int(n[0] - '0')
+		img.Slot = &slot
+		if len(regions) != 1 || regions[0].Addr != 0 {
+			return nil, errors.New("slot image carries its own addresses")
+		}
+		regions[0].Addr = d.Board.SlotAddr(slot)
+	}
+	if err := d.Flash.CheckFits(regions); err != nil {
+		return nil, err
+	}
+	return regions, nil
+}
+
+func countFailed(images []goldenImageJSON) int {
+	n := 0
+	for _, img := range images {
+		if !img.OK {
+			n++
+		}
+	}
+	return n
+}
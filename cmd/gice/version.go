@@ -0,0 +1,86 @@
+package main
+
+import (
+	"crypto/sha256"
+	"flag"
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"strings"
+
+	"github.com/gentam/gice/board"
+	"github.com/gentam/gice/flash"
+)
+
+// buildDate is set at link time with -ldflags "-X main.buildDate=...", as the
+// Go toolchain only records the commit time.
+var buildDate string
+
+// versionJSON is the output of "version -json".
+type versionJSON struct {
+	Version    string   `json:"version"`
+	Revision   string   `json:"revision,omitempty"`
+	Modified   bool     `json:"modified,omitempty"` // built from a dirty tree
+	CommitTime string   `json:"commit_time,omitempty"`
+	BuildDate  string   `json:"build_date,omitempty"`
+	Go         string   `json:"go"`
+	Flashes    []string `json:"flashes"`
+	FlashHash  string   `json:"flashes_digest"` // SHA-256 prefix of the flash list
+	Boards     []string `json:"boards"`
+}
+
+func versionCommand(args []string) {
+	fs := flag.NewFlagSet("version", flag.ExitOnError)
+	var (
+		jsonOut bool
+	)
+	fs.BoolVar(&jsonOut, "json", false, "print JSON")
+	if err := fs.Parse(args); err != nil {
+		fatalUsage("invalid arguments: %v", err)
+	}
+
+	v := versionJSON{
+		Version:   "(unknown)",
+		BuildDate: buildDate,
+		Go:        runtime.Version(),
+		Flashes:   flash.KnownFlashes(),
+		Boards:    board.Names(),
+	}
+	sum := sha256.Sum256([]byte(strings.Join(v.Flashes, "\n")))
+	v.FlashHash = fmt.Sprintf("%x", sum[:4])
+	if info, ok := debug.ReadBuildInfo(); ok {
+		v.Version = info.Main.Version
+		for _, s := range info.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				v.Revision = s.Value
+			case "vcs.time":
+				v.CommitTime = s.Value
+			case "vcs.modified":
+				v.Modified = s.Value == "true"
+			}
+		}
+	}
+
+	if jsonOut {
+		printJSON(v)
+		return
+	}
+	fmt.Printf("gice %s\n", v.Version)
+	if v.Revision != "" {
+		modified := ""
+		if v.Modified {
+			modified = " (modified)"
+		}
+		fmt.Printf("Revision:        %s%s, committed %s\n", v.Revision, modified, v.CommitTime)
+	}
+	if v.BuildDate != "" {
+		fmt.Printf("Built:           %s\n", v.BuildDate)
+	}
+	fmt.Printf("Go:              %s %s/%s\n", v.Go, runtime.GOOS, runtime.GOARCH)
+	fmt.Printf("Flash database:  %d chips, %s\n", len(v.Flashes), v.FlashHash)
+	for _, f := range v.Flashes {
+		fmt.Printf("                 %s\n", f)
+	}
+	fmt.Printf("Board profiles:  %s\n", strings.Join(v.Boards, ", "))
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/gentam/gice"
+)
+
+// wearRecord counts the erase commands sent to one flash chip, stored in the
+// -wear file keyed by wearKey.
+type wearRecord struct {
+	Flash      string    `json:"flash,omitempty"`
+	Erased4KB  int       `json:"erased_4kb"`
+	Erased64KB int       `json:"erased_64kb"`
+	ErasedChip int       `json:"erased_chip"`
+	Since      time.Time `json:"since"`
+	Last       time.Time `json:"last"`
+}
+
+// wear holds the erases of the current command until recordWear adds them to
+// the -wear file.
+var wear struct {
+	key    string
+	record wearRecord
+}
+
+// trackWear counts the erases of d.Flash if -wear is set. The chip is
+// identified on its first erase, while the flash is powered up.
+func trackWear(d *gice.Device) {
+	if wearFile == "" {
+		return
+	}
+	f := d.Flash
+	f.OnErase = func(addr, size int) {
+		if wear.key == "" {
+			wear.key, wear.record.Flash = wearKey(f)
+		}
+		switch size {
+		case 4 << 10:
+			wear.record.Erased4KB++
+		case 64 << 10:
+			wear.record.Erased64KB++
+		default:
+			wear.record.ErasedChip++
+		}
+	}
+}
+
+// wearKey returns the key of the flash in the -wear file, its JEDEC ID and
+// unique ID in hex, and its name.
+func wearKey(f *gice.Flash) (key, name string) {
+	id, name, err := f.ReadID()
+	if err != nil {
+		slog.Warn("wear: read flash ID", "err", err)
+	}
+	key = fmt.Sprintf("%X", id)
+	if uid, err := f.UniqueID(); err == nil {
+		key += fmt.Sprintf("-%X", uid)
+	} else {
+		slog.Warn("wear: no unique ID; counting all chips of the model together", "err", err)
+	}
+	return key, name
+}
+
+// recordWear adds the erases of the command to the -wear file.
+func recordWear() {
+	if wear.key == "" {
+		return
+	}
+	records, err := loadWear()
+	if err != nil {
+		slog.Error("wear", "err", err)
+		return
+	}
+	now := time.Now().UTC()
+	r, ok := records[wear.key]
+	if !ok {
+		r.Since = now
+	}
+	r.Flash = wear.record.Flash
+	r.Erased4KB += wear.record.Erased4KB
+	r.Erased64KB += wear.record.Erased64KB
+	r.ErasedChip += wear.record.ErasedChip
+	r.Last = now
+	records[wear.key] = r
+
+	data, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		slog.Error("wear", "err", err)
+		return
+	}
+	if err := os.WriteFile(wearFile, append(data, '\n'), 0o644); err != nil {
+		slog.Error("wear", "err", err)
+	}
+	wear.key = ""
+}
+
+// loadWear reads the -wear file, which may not exist yet.
+func loadWear() (map[string]wearRecord, error) {
+	records := map[string]wearRecord{}
+	data, err := os.ReadFile(wearFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return records, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &records); err != nil {
+		return nil, fmt.Errorf("%s: %w", wearFile, err)
+	}
+	return records, nil
+}
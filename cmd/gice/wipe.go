@@ -0,0 +1,81 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"time"
+)
+
+func wipeCommand(args []string) {
+	fs := flag.NewFlagSet("wipe", flag.ExitOnError)
+	var (
+		sample   int
+		maxLines int
+	)
+	fs.IntVar(&sample, "sample", 0, "only blank-check N random pages of 256 bytes (0: the whole flash)")
+	fs.IntVar(&maxLines, "max", 32, "maximum number of stuck bytes to print (0: all)")
+	if err := fs.Parse(args); err != nil {
+		fatalUsage("invalid arguments: %v", err)
+	}
+	if sample < 0 {
+		fatalUsage("-sample must not be negative")
+	}
+
+	d := openFlash()
+	defer closeFlash(d)
+
+	start := time.Now()
+	if err := d.Flash.EraseChip(); err != nil {
+		fatalf("erase chip: %v", err)
+	}
+	erased := time.Since(start)
+
+	// Pages to check: all of them, or a random sample
+	const pageSize = 256
+	pages := d.Flash.Size() / pageSize
+	var check []int
+	if sample == 0 || sample >= pages {
+		for p := range pages {
+			check = append(check, p)
+		}
+	} else {
+		check = rand.Perm(pages)[:sample]
+	}
+
+	const chunkPages = 256 // read 64KB at a time when checking every page
+	stuck := 0
+	report := func(addr int, b byte) {
+		stuck++
+		if maxLines == 0 || stuck <= maxLines {
+			fmt.Printf("0x%06X: %02x (bits stuck at 0: %08b)\n", addr, b, ^b)
+		}
+	}
+	for i := 0; i < len(check); {
+		n := 1
+		if sample == 0 {
+			n = min(chunkPages, len(check)-i)
+		}
+		addr := check[i] * pageSize
+		data, err := d.Flash.Read(addr, n*pageSize)
+		if err != nil {
+			fatalf("read flash: %v", err)
+		}
+		for j, b := range data {
+			if b != 0xFF {
+				report(addr+j, b)
+			}
+		}
+		i += n
+	}
+	if maxLines > 0 && stuck > maxLines {
+		fmt.Printf("... %d more stuck bytes\n", stuck-maxLines)
+	}
+	checked := len(check) * pageSize
+	slog.Info("wiped", "checked", checked, "stuck", stuck, "erase", erased.Round(time.Millisecond), "check", (time.Since(start) - erased).Round(time.Millisecond))
+	if stuck > 0 {
+		exitf(exitVerifyMismatch, "blank check failed: %d of %d bytes not erased", stuck, checked)
+	}
+	fmt.Println("OK")
+}
@@ -1,22 +1,81 @@
 package main
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"flag"
 	"fmt"
+	"io"
+	"log/slog"
 	"os"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/gentam/gice"
+	"github.com/gentam/gice/bitstream"
+	"github.com/gentam/gice/board"
+	"periph.io/x/host/v3/ftdi"
 )
 
 func writeCommand(args []string) {
 	fs := flag.NewFlagSet("write", flag.ExitOnError)
 	var (
 		bulkErase bool
+		slot      int
+		offset    int
+		boardName string
+		term      bool
+		port      string
+		baud      int
+		comment   string
+		noRelease bool
+		extra     dataFlag
+		family    uint
+		force     bool
+		format    string
+		onSuccess string
+		onFailure string
+		all       bool
+		resume    bool
 	)
 	fs.BoolVar(&bulkErase, "e", false, "bulk erase entire flash")
+	fs.IntVar(&slot, "slot", -1, "write to warm boot slot N (0-3) of a multiboot image")
+	sizeVar(fs, &offset, "offset", 0, "write the image at this flash address, preserving the data around it")
+	fs.StringVar(&boardName, "board", "", "board profile: "+strings.Join(board.Names(), ", "))
+	fs.BoolVar(&term, "term", false, "attach a serial terminal to the board's UART after a successful write")
+	fs.StringVar(&port, "port", "", "serial port for -term (default: channel B of the device)")
+	fs.IntVar(&baud, "baud", 115200, "baud rate for -term")
+	fs.StringVar(&comment, "comment", "", "replace the bitstream comment (e.g. build time, git hash)")
+	fs.BoolVar(&noRelease, "no-release", false, "keep the FPGA in reset after writing")
+	fs.Var(&extra, "data", "also write `file@offset` (repeatable)")
+	fs.UintVar(&family, "uf2-family", 0, "only write UF2 blocks with the family ID (0: any)")
+	fs.StringVar(&format, "format", "auto", "input format: "+formatNames())
+	fs.BoolVar(&force, "force", false, "write even if a bitstream fails the consistency check (regions of HEX, SREC and UF2 input are only warned about)")
+	fs.StringVar(&onSuccess, "on-success", "", "run the shell command after a successful write (env: GICE_SERIAL, GICE_IMAGE_SHA256, GICE_CDONE)")
+	fs.StringVar(&onFailure, "on-failure", "", "run the shell command after a failed write (env: GICE_SERIAL, GICE_IMAGE_SHA256, GICE_ERROR)")
+	fs.BoolVar(&all, "all", false, "write to every attached FT2232H in turn and report the result of each")
+	fs.BoolVar(&resume, "resume", false, "continue an interrupted write, skipping the subsectors that already match the image")
 	if err := fs.Parse(args); err != nil {
 		fatalUsage("invalid arguments: %v", err)
 	}
+	if all && (term || deviceSelector != "" || remote != "" || programmer != "ftdi") {
+		fatalUsage("-all is incompatible with -term, -d, -remote and -programmer")
+	}
+	if bulkErase && slot >= 0 {
+		fatalUsage("-e and -slot are mutually exclusive")
+	}
+	if resume && bulkErase {
+		fatalUsage("-resume and -e are mutually exclusive")
+	}
+	if offset != 0 && (slot >= 0 || bulkErase) {
+		fatalUsage("-offset is incompatible with -slot and -e")
+	}
+	if noRelease && term {
+		fatalUsage("-no-release and -term are mutually exclusive")
+	}
+	profile := lookupBoard(boardName)
 
 	stdinTTY, err := isTTY(os.Stdin)
 	if err != nil {
@@ -27,53 +86,309 @@ func writeCommand(args []string) {
 		fatalUsage("missing input")
 	}
 
+	// The whole input is buffered before erasing, as erase planning needs
+	// the total size, so stdin ("-") works like a regular file
 	inFile := os.Stdin
-	if inFilePath != "" {
+	if inFilePath != "" && inFilePath != "-" {
 		inFile, err = os.Open(inFilePath)
 		if err != nil {
 			fatalf("open %q: %v", inFilePath, err)
 		}
 		defer inFile.Close()
 	}
+	data, err := io.ReadAll(inFile)
+	if err != nil {
+		fatalf("read input: %v", err)
+	}
+	sum := sha256.Sum256(data)
+	h := hooks{onSuccess: onSuccess, onFailure: onFailure}
+	h.setenv("GICE_IMAGE_SHA256", hex.EncodeToString(sum[:]))
 
-	d, err := gice.NewDevice()
+	regions, err := gice.DecodeImage(data, gice.Format(format), uint32(family))
 	if err != nil {
-		fatalf("%v", err)
+		h.fatalf("decode input: %v", err)
+	}
+	single := len(regions) == 1 && regions[0].Addr == 0
+	if (slot >= 0 || offset != 0) && !single {
+		fatalUsage("input carries its own addresses; -slot and -offset are not supported")
+	}
+	if comment != "" {
+		if !single {
+			fatalUsage("-comment requires a single bitstream")
+		}
+		if regions[0].Data, err = bitstream.SetComment(regions[0].Data, comment); err != nil {
+			h.fatalf("set comment: %v", err)
+		}
+	}
+	if !force {
+		// Check covers every image of the input, e.g. all the slots of a
+		// multiboot layout. The regions of HEX, SREC and UF2 input may hold
+		// user data that happens to look like a bitstream, so their failures
+		// are only warned about
+		for _, r := range regions {
+			err := bitstream.Check(r.Data)
+			switch {
+			case err == nil:
+			case single:
+				h.fatalf("invalid bitstream %v; use -force to write anyway", err)
+			default:
+				slog.Warn("region holds an invalid bitstream", addrAttr("addr", r.Addr), "err", err)
+			}
+		}
+	}
+
+	if offset != 0 {
+		regions[0].Addr = offset
+	}
+
+	job := &writeJob{
+		regions:   append(regions, extra...),
+		board:     profile,
+		boardName: boardName,
+		bulkErase: bulkErase,
+		slot:      slot,
+		noRelease: noRelease,
+		strict:    term,
+		resume:    resume,
+		placed:    offset != 0 || len(extra) > 0,
+	}
+	if all {
+		writeAll(job, h)
+		return
+	}
+
+	d, err := job.run(&h)
+	if err != nil {
+		h.fatalf("%v", err)
+	}
+	h.success()
+
+	if term {
+		if port == "" {
+			if port, err = uartPath(d); err != nil {
+				fatalf("%v", err)
+			}
+		}
+		if err := terminal(port, baud); err != nil {
+			fatalf("terminal: %v", err)
+		}
+	}
+}
+
+// writeJob writes decoded regions to a device.
+type writeJob struct {
+	regions   []gice.Region
+	board     *gice.Board
+	boardName string
+	bulkErase bool
+	slot      int
+	noRelease bool
+	strict    bool // fail if the FPGA does not configure
+	resume    bool // only write what differs from the flash
+	placed    bool // -offset or -data places regions among other data
+}
+
+// run opens the device with opts in addition to the global flags and writes
+// the regions, setting the GICE_SERIAL and GICE_CDONE variables of h. The
+// device is closed on return; its FTDI handle stays open, e.g. for uartPath.
+func (j *writeJob) run(h *hooks, opts ...gice.Option) (*gice.Device, error) {
+	opts = append(opts, gice.WithBoard(j.board))
+	if j.noRelease {
+		opts = append(opts, gice.WithKeepReset())
+	}
+	d, err := newDevice(opts...)
+	if err != nil {
+		return nil, err
+	}
+	defer closeFlash(d)
+	ee := ftdi.EEPROM{}
+	if d.FTDI != nil && d.FTDI.EEPROM(&ee) == nil {
+		h.setenv("GICE_SERIAL", ee.Serial)
+	}
+	if j.slot >= 0 {
+		warnGenericBoard(d, j.boardName)
 	}
 
 	d.HoldFPGAReset()
-	defer d.ReleaseFPGAReset()
 
 	if err := d.Flash.PowerUp(); err != nil {
-		fatalf("flash power up: %v", err)
+		return nil, fmt.Errorf("flash power up: %w", err)
 	}
-	defer d.Flash.PowerDown()
 
 	flashID, name, err := d.Flash.ReadID()
 	if err != nil {
-		fatalf("read flash ID: %v", err)
+		return nil, fmt.Errorf("read flash ID: %w", err)
 	}
 	if name == "" {
-		fmt.Fprintf(os.Stderr, "unknown flash ID (%X)\n", flashID)
+		slog.Warn("unknown flash", "id", fmt.Sprintf("%X", flashID))
+	}
+
+	// The slot address depends on the board, so every device gets a copy
+	regions := slices.Clone(j.regions)
+	var after []gice.Region // multiboot header, written once the image is
+	if j.slot >= 0 {
+		addr, a, err := d.Flash.PlanSlot(d.Board, j.slot)
+		if err != nil {
+			return nil, fmt.Errorf("slot %d: %w", j.slot, err)
+		}
+		slog.Info("slot", "slot", j.slot, addrAttr("addr", addr))
+		regions[0].Addr = addr
+		after = a
 	}
 
-	if bulkErase {
+	if err := d.Flash.CheckWritable(append(slices.Clone(regions), after...)); err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	if j.bulkErase {
 		if err := d.Flash.EraseChip(); err != nil {
-			fatalf("erase chip: %v", err)
+			return nil, fmt.Errorf("erase chip: %w", err)
 		}
-	} else {
-		stat, err := inFile.Stat()
+		for _, r := range regions {
+			if err := d.Flash.WriteAt(bytes.NewReader(r.Data), r.Addr); err != nil {
+				return nil, fmt.Errorf("write flash: %w", err)
+			}
+		}
+	} else if j.resume {
+		done, err := d.Flash.ResumeRegions(regions)
+		if err != nil {
+			return nil, fmt.Errorf("write flash: %w", err)
+		}
+		slog.Info("resumed", "already_written_subsectors", done)
+	} else if preserve, err := j.preserveNeighbors(d.Flash, regions); err != nil {
+		return nil, err
+	} else if preserve {
+		// Keep the neighboring images and data partitions intact
+		erased, err := d.Flash.UpdateRegions(regions)
 		if err != nil {
-			fatalf("file stat: %v", err)
+			return nil, fmt.Errorf("write flash: %w", err)
+		}
+		slog.Debug("preserved neighbors", "erased_subsectors", erased)
+	} else if err := d.Flash.WriteRegions(regions); err != nil {
+		return nil, fmt.Errorf("write flash: %w", err)
+	}
+	for _, r := range after {
+		// One at a time, so that the header is only updated last
+		if _, err := d.Flash.UpdateRegions([]gice.Region{r}); err != nil {
+			return nil, fmt.Errorf("write multiboot layout: %w", err)
+		}
+	}
+	for _, r := range regions {
+		slog.Debug("region", addrAttr("addr", r.Addr), "size", len(r.Data))
+	}
+	slog.Info("written", "regions", len(regions), "bulk_erase", j.bulkErase, "duration", time.Since(start).Round(time.Millisecond))
+
+	if err := d.Flash.PowerDown(); err != nil {
+		return nil, fmt.Errorf("flash power down: %w", err)
+	}
+	if err := d.ReleaseFlash(); err != nil {
+		return nil, fmt.Errorf("release flash: %w", err)
+	}
+	if j.noRelease {
+		return d, nil
+	}
+	if elapsed, err := d.FinishConfiguration(configTimeout); err != nil {
+		if j.strict {
+			return nil, err
+		}
+		slog.Warn("FPGA not configured", "err", err)
+		h.setenv("GICE_CDONE", "0")
+	} else {
+		slog.Info("configured", "duration", elapsed.Round(time.Microsecond))
+		h.setenv("GICE_CDONE", "1")
+	}
+	return d, nil
+}
+
+// writeAll runs the job on every attached FT2232H in turn, running the hooks
+// for each of them, and exits with an error if any failed.
+func writeAll(job *writeJob, h hooks) {
+	devs, err := gice.Devices()
+	if err != nil {
+		fatalf("%v", err)
+	}
+	if len(devs) == 0 {
+		fatalf("%v", gice.ErrDeviceNotFound)
+	}
+	results := make([]error, len(devs))
+	for i, dev := range devs {
+		slog.Info("device", "index", i, "serial", dev.Serial, "desc", dev.Desc)
+		dh := h
+		dh.env = slices.Clip(h.env)
+		if _, err := job.run(&dh, gice.WithIndex(i)); err != nil {
+			slog.Error("write failed", "index", i, "serial", dev.Serial, "err", err)
+			dh.run(dh.onFailure, "GICE_ERROR="+err.Error())
+			results[i] = err
+			continue
 		}
-		if err := d.Flash.Erase(0, int(stat.Size())); err != nil {
-			fatalf("erase flash: %v", err)
+		dh.success()
+	}
+
+	failed := []any{}
+	for i, err := range results {
+		status := "ok"
+		if err != nil {
+			status = "FAILED: " + err.Error()
+			failed = append(failed, err)
 		}
+		fmt.Printf("#%d\t%s\t%s\n", i, devs[i].Serial, status)
 	}
+	if len(failed) > 0 {
+		// Exit with the first known cause among the failures
+		exitf(errorCode(failed), "%d of %d devices failed", len(failed), len(devs))
+	}
+}
 
-	if inFile != nil {
-		if err := d.Flash.Write(inFile); err != nil {
-			fatalf("write flash: %v", err)
+// preserveNeighbors reports whether the regions must be written keeping the
+// rest of the 4KB subsectors they start or end in: when they are placed among
+// other data with -offset, -data or -slot, or when those bytes are not blank.
+// Otherwise the sectors are simply erased and programmed, which is faster.
+func (j *writeJob) preserveNeighbors(f *gice.Flash, regions []gice.Region) (bool, error) {
+	const subsectorSize = 4 << 10
+	for _, r := range regions {
+		end := r.Addr + len(r.Data)
+		// The bytes before the start and after the end in their subsectors
+		for _, n := range [][2]int{
+			{r.Addr &^ (subsectorSize - 1), r.Addr % subsectorSize},
+			{end, (subsectorSize - end%subsectorSize) % subsectorSize},
+		} {
+			if n[1] == 0 {
+				continue
+			}
+			if j.placed || j.slot >= 0 {
+				return true, nil
+			}
+			got, err := f.Read(n[0], n[1])
+			if err != nil {
+				return false, fmt.Errorf("read flash: %w", err)
+			}
+			if !bytes.Equal(got, bytes.Repeat([]byte{0xFF}, len(got))) {
+				return true, nil
+			}
 		}
 	}
+	return false, nil
+}
+
+// dataFlag collects additional regions given as file@offset.
+type dataFlag []gice.Region
+
+func (f *dataFlag) String() string { return "" }
+
+func (f *dataFlag) Set(s string) error {
+	path, offset, ok := strings.Cut(s, "@")
+	if !ok {
+		return fmt.Errorf("missing @offset in %q", s)
+	}
+	addr, err := parseSize(offset)
+	if err != nil {
+		return fmt.Errorf("invalid offset %q", offset)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	*f = append(*f, gice.Region{Addr: addr, Data: data})
+	return nil
 }
@@ -3,42 +3,241 @@ package gice
 import (
 	"errors"
 	"fmt"
+	"io"
+	"log/slog"
+	"slices"
 	"sync/atomic"
+	"time"
 
+	"github.com/gentam/gice/board"
+	"github.com/gentam/gice/flash"
+	"github.com/gentam/gice/transport"
 	"periph.io/x/conn/v3/gpio"
 	"periph.io/x/conn/v3/physic"
 	"periph.io/x/conn/v3/spi"
+	"periph.io/x/d2xx"
 	"periph.io/x/host/v3"
 	"periph.io/x/host/v3/ftdi"
 )
 
 type Device struct {
-	FTDI  *ftdi.FT232H
+	FTDI  *ftdi.FT232H // nil with other programmers such as WithSPIDev
 	Flash *Flash
+	Board *Board // board profile; board.Generic if not recognized
 
 	cs    gpio.PinIO // ADBUS4 Chip Select
 	reset gpio.PinIO // ADBUS7 Reset
 	cdone gpio.PinIO // ADBUS6 Done
 
-	clock physic.Frequency
-	conn  spi.Conn
+	clock   physic.Frequency
+	conn    spi.Conn
+	port    spi.PortCloser // port of conn, closed by Reinit; nil if not closable
+	release func() error   // stops driving the bus without a reset line; see transport.Bus
+
+	released      time.Time // when the FPGA reset was last released
+	held          bool      // the FPGA reset is held by holdReset
+	keepReset     bool
+	autoPowerDown bool // sets Flash.AutoWake
+
+	serial  string  // select the device with the serial number, if set
+	index   int     // select the n-th matching device, if non-negative
+	channel Channel // FT2232H channel, if non-negative; Board.Channel otherwise
+
+	open   func(*Device) error // opens the programmer; openFTDI by default
+	noHost bool                // open does not use the drivers of host.Init
+	trace  io.Writer           // log of the SPI transactions, if set
+	record io.Writer           // recording of the SPI transactions, if set
+	vcdOut io.Writer           // dump of the SPI transactions, if set
+	vcd    *flash.VCDWriter    // writing to vcdOut
+	log    *slog.Logger        // receives the debug events, if set
+}
+
+// Option configures a Device.
+type Option func(*Device)
+
+// WithKeepReset makes ReleaseFlash keep the FPGA in reset, for setups where
+// something else decides when the FPGA boots. ResetFPGA still releases it.
+func WithKeepReset() Option {
+	return func(d *Device) { d.keepReset = true }
+}
+
+// WithAutoPowerDown lets the flash stay in deep power-down whenever it is idle:
+// Flash.AutoWake is set, so callers can call Flash.PowerDown after each
+// operation and the next command wakes the flash transparently.
+func WithAutoPowerDown() Option {
+	return func(d *Device) { d.autoPowerDown = true }
+}
+
+// WithBoard sets the board profile describing optional wiring such as the cold
+// boot selection pins. Without it, the board is detected from the FTDI EEPROM.
+func WithBoard(b *Board) Option {
+	return func(d *Device) { d.Board = b }
+}
+
+// WithSerial selects the FT2232H with the given EEPROM serial number when
+// several devices are attached.
+func WithSerial(serial string) Option {
+	return func(d *Device) { d.serial = serial }
+}
+
+// WithIndex selects the n-th (from 0) matching FT2232H when several devices
+// are attached.
+func WithIndex(n int) Option {
+	return func(d *Device) { d.index = n }
+}
+
+// WithChannel selects the FT2232H channel wired to the flash, overriding the
+// board profile.
+func WithChannel(c Channel) Option {
+	return func(d *Device) { d.channel = c }
 }
 
 var hostInitialized atomic.Bool
 
-// NewDevice finds FT2232H device and opens MPSSE/SPI connection.
-func NewDevice() (*Device, error) {
-	if hostInitialized.CompareAndSwap(false, true) {
-		if _, err := host.Init(); err != nil {
-			return nil, fmt.Errorf("host initialization failed: %w", err)
+// NewDevice opens the programmer, by default the first FT2232H device with an
+// MPSSE/SPI connection.
+func NewDevice(opts ...Option) (*Device, error) {
+	d, err := newDevice(opts)
+	if err != nil {
+		return nil, err
+	}
+	if d.open == nil {
+		d.open = (*Device).openFTDI
+	}
+	if err := d.open(d); err != nil {
+		return nil, err
+	}
+	d.wrapTrace()
+	if d.Board == nil {
+		d.Board = board.Generic
+	}
+
+	fopts := []flash.Option{flash.WithReserved(d.Board.Reserved...)}
+	if d.autoPowerDown {
+		fopts = append(fopts, flash.WithAutoWake())
+	}
+	if d.log != nil {
+		fopts = append(fopts, flash.WithLogger(d.log))
+	}
+	d.Flash = flash.New(d.conn, d.cs, fopts...)
+	d.debug("device opened", "board", d.Board.Name, "clock", d.clock)
+
+	return d, nil
+}
+
+// Reinit closes the SPI port and opens the programmer again, keeping the
+// selected device and board, to recover from a wedged state without
+// restarting. For FTDI devices it reprograms the MPSSE clock and pin
+// directions; the USB handle itself stays open, as the FTDI driver keeps it
+// for the life of the process. Serial programmers are resynchronized, which
+// discards pending input.
+func (d *Device) Reinit() error {
+	d.Flash.Lock()
+	defer d.Flash.Unlock()
+	d.debug("reinitialize programmer")
+	if d.port != nil {
+		if err := d.port.Close(); err != nil {
+			return fmt.Errorf("close SPI port: %w", err)
+		}
+		d.port = nil
+	}
+	if err := d.open(d); err != nil {
+		return err
+	}
+	d.wrapTrace()
+	d.Flash.Reconnect(d.conn, d.cs)
+	return nil
+}
+
+// Close leaves the board in a defined state for whatever uses it next: if the
+// FPGA is held in reset, or the programmer has no reset line, the flash is put
+// into deep power-down and handed over like with ReleaseFlash so that the FPGA
+// configures itself from the flash. A flash already handed over, e.g. by
+// ResetFPGA, is left alone. The FTDI pins are then returned to inputs, and the
+// SPI port is closed. With WithKeepReset, the FPGA is left in reset. The FTDI
+// driver keeps the USB handle for the life of the process, so the device can
+// be opened again with NewDevice. The Device must not be used after Close.
+func (d *Device) Close() error {
+	var errs []error
+	d.Flash.Lock()
+	owned := d.held || d.reset == nil
+	d.Flash.Unlock()
+	if owned {
+		if err := d.Flash.PowerDown(); err != nil {
+			errs = append(errs, fmt.Errorf("flash power down: %w", err))
+		}
+		if err := d.ReleaseFlash(); err != nil {
+			errs = append(errs, fmt.Errorf("release flash: %w", err))
+		}
+	}
+
+	d.Flash.Lock()
+	defer d.Flash.Unlock()
+	if d.FTDI != nil {
+		var dir byte
+		if d.keepReset {
+			dir = 1 << 7 // ADBUS7 keeps driving the reset low
+		}
+		if err := d.FTDI.DBus(dir, 0); err != nil {
+			errs = append(errs, fmt.Errorf("release ADBUS pins: %w", err))
+		}
+		if err := d.FTDI.CBus(0, 0); err != nil {
+			errs = append(errs, fmt.Errorf("release ACBUS pins: %w", err))
 		}
 	}
+	if d.port != nil {
+		if err := d.port.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("close SPI port: %w", err))
+		}
+		d.port = nil
+	}
+	if d.vcd != nil {
+		if err := d.vcd.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("close VCD dump: %w", err))
+		}
+	}
+	d.debug("device closed")
+	return errors.Join(errs...)
+}
 
+// SetClock changes the SPI clock frequency, reopening the connection with
+// Reinit. The default is 30MHz, the maximum of the FT2232H.
+func (d *Device) SetClock(f physic.Frequency) error {
+	d.clock = f
+	return d.Reinit()
+}
+
+func newDevice(opts []Option) (*Device, error) {
 	d := &Device{
-		clock: 30 * physic.MegaHertz, // [FTDI-AN_135|3.2.1 Divisors]
+		clock:   30 * physic.MegaHertz, // [FTDI-AN_135|3.2.1 Divisors]
+		index:   -1,
+		channel: -1,
+	}
+	for _, opt := range opts {
+		opt(d)
+	}
+	if !d.noHost {
+		if err := initHost(); err != nil {
+			return nil, err
+		}
+	}
+	return d, nil
+}
+
+func initHost() error {
+	if hostInitialized.CompareAndSwap(false, true) {
+		if _, err := host.Init(); err != nil {
+			return fmt.Errorf("host initialization failed: %w", err)
+		}
 	}
+	return nil
+}
+
+// openFTDI finds the FT2232H and opens the MPSSE/SPI connection on the selected
+// channel.
+func (d *Device) openFTDI() error {
 	if err := d.findFT2232H(); err != nil {
-		return nil, err
+		return err
 	}
 
 	// [Lattice-EB82|Appendix A. Sheet 2 of 5 (USB to SPI/RS232)] / [iCEBreaker]
@@ -55,45 +254,450 @@ func NewDevice() (*Device, error) {
 	// [FTDI-AN_114|1.2]> FTDI device can only support mode 0 and mode 2 due to the limitation of MPSSE engine
 	// [N25Q32|Table 7: SPI Modes] mode 0 and mode 3 are supported
 	mode := spi.Mode0
-	if err := d.connectSPI(mode); err != nil {
-		return nil, err
-	}
+	return d.connectSPI(mode)
+}
 
-	d.Flash = NewFlash(d)
+var (
+	errNoReset = errors.New("programmer has no FPGA reset line")
+	errNoCDone = errors.New("programmer has no CDONE line")
+)
 
-	return d, nil
-}
+// Errors that callers can test for with errors.Is.
+var (
+	ErrDeviceNotFound = errors.New("FT2232H device not found")
+	ErrCDoneTimeout   = errors.New("CDONE not asserted")
+)
 
 // HoldFPGAReset asserts (low) the FPGA reset line.
-func (d *Device) HoldFPGAReset() error { return d.reset.Out(gpio.Low) }
+func (d *Device) HoldFPGAReset() error {
+	d.Flash.Lock()
+	defer d.Flash.Unlock()
+	return d.holdReset()
+}
 
 // ReleaseFPGAReset deasserts (high) the FPGA reset line.
-func (d *Device) ReleaseFPGAReset() error { return d.reset.Out(gpio.High) }
+func (d *Device) ReleaseFPGAReset() error {
+	d.Flash.Lock()
+	defer d.Flash.Unlock()
+	return d.releaseReset()
+}
+
+// holdReset is HoldFPGAReset with Flash.Lock held. The methods of Device
+// driving the bus, chip select or the reset line hold it, so that they do not
+// interleave with the flash commands of other goroutines.
+func (d *Device) holdReset() error {
+	if d.reset == nil {
+		return errNoReset
+	}
+	if err := d.reset.Out(gpio.Low); err != nil {
+		return err
+	}
+	d.held = true
+	return nil
+}
+
+func (d *Device) releaseReset() error {
+	if d.reset == nil {
+		return errNoReset
+	}
+	if err := d.reset.Out(gpio.High); err != nil {
+		return err
+	}
+	d.held = false
+	return nil
+}
+
+// [Lattice-TN1248] configuration timing
+const (
+	tCRESETLow = 200 * time.Nanosecond // Minimum CRESET_B low pulse width
+
+	// The iCE40 requires at least 49 SPI clocks after configuration to
+	// complete its startup sequence and activate the user I/O.
+	startupClocks = 49
+)
+
+// ResetFPGA pulses the FPGA reset line so that the FPGA reconfigures itself
+// from the flash.
+func (d *Device) ResetFPGA() error {
+	if d.reset == nil {
+		return errNoReset
+	}
+	d.Flash.Lock()
+	defer d.Flash.Unlock()
+	d.debug("reset FPGA")
+	if err := d.cs.Out(gpio.High); err != nil {
+		return err
+	}
+	if err := d.holdReset(); err != nil {
+		return err
+	}
+	time.Sleep(tCRESETLow)
+	return d.releaseFlash()
+}
+
+// ReleaseFlash hands the flash over to the FPGA. Chip select is kept high while
+// the reset is released to select SPI master mode, and is then released so the
+// FPGA can drive it. Call FinishConfiguration to wait for the FPGA to boot.
+//
+// With WithKeepReset, the FPGA is left in reset.
+func (d *Device) ReleaseFlash() error {
+	if d.keepReset {
+		return nil
+	}
+	d.Flash.Lock()
+	defer d.Flash.Unlock()
+	return d.releaseFlash()
+}
+
+func (d *Device) releaseFlash() error {
+	if d.reset == nil {
+		if d.release != nil {
+			return d.release()
+		}
+		return nil
+	}
+	if err := d.cs.Out(gpio.High); err != nil {
+		return err
+	}
+	if err := d.releaseReset(); err != nil {
+		return err
+	}
+	d.released = time.Now()
+	d.debug("flash released to the FPGA")
+	return d.cs.In(gpio.PullNoChange, gpio.NoEdge)
+}
 
+// FinishConfiguration waits for CDONE up to timeout and then sends the dummy
+// clocks required to complete the startup sequence. It returns the
+// configuration time measured from the release of the FPGA reset.
+func (d *Device) FinishConfiguration(timeout time.Duration) (time.Duration, error) {
+	if err := d.WaitCDone(timeout); err != nil {
+		return 0, err
+	}
+	elapsed := time.Since(d.released)
+	d.debug("FPGA configured", "elapsed", elapsed)
+	return elapsed, d.SendStartupClocks()
+}
+
+// SendStartupClocks sends at least 49 dummy SPI clocks with chip select
+// deasserted.
+func (d *Device) SendStartupClocks() error {
+	d.Flash.Lock()
+	defer d.Flash.Unlock()
+	buf := make([]byte, (startupClocks+7)/8)
+	return d.conn.Tx(buf, buf)
+}
+
+// SetColdBootSelect drives the CBSEL pins of the board to select image n (0-3)
+// on the next reset, when the power-on entry of the multiboot header has the
+// cold boot flag set.
+func (d *Device) SetColdBootSelect(n int) error {
+	if d.Board == nil || len(d.Board.CBSel) != 2 {
+		return errors.New("board has no CBSEL pins wired to the FTDI")
+	}
+	if d.FTDI == nil {
+		return errors.New("CBSEL pins require an FTDI programmer")
+	}
+	if n < 0 || n > 3 {
+		return fmt.Errorf("cold boot image %d out of range [0, 3]", n)
+	}
+	for i, p := range d.Board.CBSel {
+		if err := d.pin(p).Out(gpio.Level(n>>i&1 != 0)); err != nil {
+			return fmt.Errorf("%s: %w", p, err)
+		}
+	}
+	return nil
+}
+
+// SetPower switches the board power with the SignalPower pin of the board
+// profile.
+func (d *Device) SetPower(on bool) error {
+	if d.Board == nil {
+		return errNoPower
+	}
+	p, ok := d.Board.Pins[SignalPower]
+	if !ok {
+		return errNoPower
+	}
+	pin, err := d.Pin(p)
+	if err != nil {
+		return err
+	}
+	if err := pin.Out(gpio.Level(on != d.Board.PowerActiveLow)); err != nil {
+		return fmt.Errorf("%s: %w", p, err)
+	}
+	return nil
+}
+
+var errNoPower = errors.New("board has no power enable pin wired to the FTDI")
+
+// PowerCycle switches the board power off for the duration and on again. The
+// FPGA is kept in reset while the power comes up, and then released like with
+// ReleaseFlash so that it configures itself from the flash; call
+// FinishConfiguration to wait for it.
+func (d *Device) PowerCycle(off time.Duration) error {
+	if err := d.SetPower(false); err != nil {
+		return err
+	}
+	if err := d.HoldFPGAReset(); err != nil && !errors.Is(err, errNoReset) {
+		return err
+	}
+	time.Sleep(off)
+	if err := d.SetPower(true); err != nil {
+		return err
+	}
+	return d.ReleaseFlash()
+}
+
+func (d *Device) pin(p Pin) gpio.PinIO { return d.FTDI.Header()[p] }
+
+// configPins are the FTDI pins used for the flash and the FPGA configuration.
+var configPins = []Pin{0, 1, 2, 4, 6, 7}
+
+// GPIO returns the spare FTDI pin p for general purpose use, e.g. to drive
+// status LEDs or auxiliary signals. The pins used for SPI and FPGA
+// configuration (ADBUS0-2, 4, 6 and 7) are refused; see Pin.
+func (d *Device) GPIO(p Pin) (gpio.PinIO, error) {
+	if slices.Contains(configPins, p) {
+		return nil, fmt.Errorf("%s is used for configuration", p)
+	}
+	return d.Pin(p)
+}
+
+// Pin returns any FTDI pin, including the configuration pins. Changing those
+// interferes with flash access and the FPGA configuration.
+func (d *Device) Pin(p Pin) (gpio.PinIO, error) {
+	if d.FTDI == nil {
+		return nil, errors.New("GPIOs require an FTDI programmer")
+	}
+	if p < 0 || int(p) >= len(d.FTDI.Header()) {
+		return nil, fmt.Errorf("pin %d out of range", p)
+	}
+	return d.pin(p), nil
+}
+
+// ReadPins returns the levels of ADBUS0-7 (low) and ACBUS0-7 (high), read
+// with the MPSSE Read Data Bits Low/High commands. [FTDI-AN_108|3.6 Set / Read
+// Data Bits High / Low Bytes]
+func (d *Device) ReadPins() (low, high byte, err error) {
+	if d.FTDI == nil {
+		return 0, 0, errors.New("GPIOs require an FTDI programmer")
+	}
+	if low, err = d.FTDI.DBusRead(); err != nil {
+		return 0, 0, err
+	}
+	high, err = d.FTDI.CBusRead()
+	return low, high, err
+}
+
+// CDone reports whether the FPGA asserts CDONE, i.e. it is configured.
+func (d *Device) CDone() (bool, error) {
+	if d.cdone == nil {
+		return false, errNoCDone
+	}
+	if err := d.cdone.In(gpio.PullNoChange, gpio.NoEdge); err != nil {
+		return false, err
+	}
+	return d.cdone.Read() == gpio.High, nil
+}
+
+// FPGAStatus is a snapshot of the FPGA configuration pins.
+type FPGAStatus struct {
+	CDone      gpio.Level
+	CReset     gpio.Level
+	CResetFunc string // pin function of CRESET_B as seen by the FTDI, e.g. "Out/Low"
+}
+
+// State summarizes the status as "in reset", "configured", or "not configured".
+func (s FPGAStatus) State() string {
+	switch {
+	case s.CReset == gpio.Low:
+		return "in reset"
+	case s.CDone == gpio.High:
+		return "configured"
+	}
+	return "not configured"
+}
+
+// FPGAStatus reads the live levels of CDONE and CRESET_B without changing
+// the direction of CRESET_B. It fails if the programmer has no CDONE or no
+// CRESET_B line.
+func (d *Device) FPGAStatus() (FPGAStatus, error) {
+	if d.reset == nil {
+		return FPGAStatus{}, errNoReset
+	}
+	done, err := d.CDone()
+	if err != nil {
+		return FPGAStatus{}, err
+	}
+	s := FPGAStatus{
+		CDone:      gpio.Low,
+		CReset:     d.reset.Read(),
+		CResetFunc: d.reset.Function(),
+	}
+	if done {
+		s.CDone = gpio.High
+	}
+	return s, nil
+}
+
+// WaitCDone polls CDONE until the FPGA is configured or the timeout expires.
+func (d *Device) WaitCDone(timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		done, err := d.CDone()
+		if err != nil {
+			return err
+		}
+		if done {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("%w within %v", ErrCDoneTimeout, timeout)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// ftdiChip is a chip with the interfaces opened by the driver, in channel
+// order.
+type ftdiChip struct {
+	ee         ftdi.EEPROM
+	typ        transport.FTDIChip
+	interfaces []*ftdi.FT232H
+}
+
+// findFT2232H selects the chip by index or serial number, and its interface by
+// channel. It also detects the board from the EEPROM if needed, as the board
+// profile may choose the channel.
 func (d *Device) findFT2232H() error {
-	const (
-		vendorID  = 0x0403 // FTDI
-		productID = 0x6010 // FT2232H
-	)
+	chips := ft2232hChips()
+	var chip *ftdiChip
+	switch {
+	case d.serial != "":
+		for _, c := range chips {
+			if c.ee.Serial == d.serial {
+				chip = c
+				break
+			}
+		}
+		if chip == nil {
+			return fmt.Errorf("%w with serial %q", ErrDeviceNotFound, d.serial)
+		}
+	case d.index >= 0:
+		if d.index >= len(chips) {
+			return fmt.Errorf("%w: no device #%d (%d attached)", ErrDeviceNotFound, d.index, len(chips))
+		}
+		chip = chips[d.index]
+	case len(chips) > 0:
+		chip = chips[0]
+	default:
+		return errFT2232HNotFound()
+	}
+
+	if d.Board == nil {
+		d.Board = board.Detect(chip.ee.Desc)
+	}
+	ch := d.channel
+	if ch < 0 {
+		ch = ChannelA
+		if d.Board != nil {
+			ch = d.Board.Channel
+		}
+	}
+	if int(ch) >= len(chip.interfaces) {
+		return fmt.Errorf("channel %s of the %s is not available; is it claimed by another driver?", ch, chip.typ.Name)
+	}
+	d.FTDI = chip.interfaces[ch]
+	return nil
+}
 
+// errFT2232HNotFound explains a missing FT2232H, pointing out chips which the
+// FTDI driver opens without MPSSE support, such as the full-speed FT2232C/D/L
+// sharing the product ID of the FT2232H, or builds without the driver.
+func errFT2232HNotFound() error {
+	if !d2xx.Available {
+		// The D2XX library is linked with cgo except on Windows
+		return fmt.Errorf("%w; this build lacks the FTDI driver, which requires cgo on this platform", ErrDeviceNotFound)
+	}
 	info := ftdi.Info{}
 	for _, dev := range ftdi.All() {
 		dev.Info(&info)
-		if info.VenID != vendorID || info.DevID != productID {
+		if _, ok := dev.(*ftdi.FT232H); ok {
 			continue
 		}
-		if ft, ok := dev.(*ftdi.FT232H); ok {
-			d.FTDI = ft
-			return nil
+		if t, ok := transport.LookupFTDIChip(info.DevID); ok && info.VenID == ftdiVendorID {
+			name := t.Name
+			if info.Type == ftdi.DevTypeFT2232C.String() {
+				name = "FT2232C/D/L"
+			}
+			return fmt.Errorf("%w; %s (%s) is not supported by the FTDI driver; drive its MPSSE with WithUSB", ErrDeviceNotFound, dev, name)
 		}
 	}
+	return ErrDeviceNotFound
+}
+
+const ftdiVendorID = 0x0403
+
+// DeviceInfo describes an attached FT2232H.
+type DeviceInfo struct {
+	Type   string // chip type, e.g. "FT2232H" or "FT4232H"
+	Desc   string // EEPROM description
+	Serial string // EEPROM serial number
+	Board  *Board // board detected from the description; nil if unknown
+}
+
+// Devices lists the attached FT2232H devices, in the order selected by
+// WithIndex.
+func Devices() ([]DeviceInfo, error) {
+	if err := initHost(); err != nil {
+		return nil, err
+	}
+	var devs []DeviceInfo
+	for _, c := range ft2232hChips() {
+		devs = append(devs, DeviceInfo{
+			Type:   c.typ.Name,
+			Desc:   c.ee.Desc,
+			Serial: c.ee.Serial,
+			Board:  board.Detect(c.ee.Desc),
+		})
+	}
+	return devs, nil
+}
 
-	return errors.New("FT2232H device not found")
+// ft2232hChips groups the interfaces of the supported chips opened by the
+// driver by chip. The interfaces of a chip are enumerated in a row and share
+// the EEPROM.
+func ft2232hChips() []*ftdiChip {
+	var chips []*ftdiChip
+	info := ftdi.Info{}
+	for _, dev := range ftdi.All() {
+		dev.Info(&info)
+		t, ok := transport.LookupFTDIChip(info.DevID)
+		if !ok || info.VenID != ftdiVendorID {
+			continue
+		}
+		ft, ok := dev.(*ftdi.FT232H)
+		if !ok {
+			continue
+		}
+		ee := ftdi.EEPROM{}
+		ft.EEPROM(&ee)
+		if n := len(chips); n > 0 {
+			last := chips[n-1]
+			if len(last.interfaces) < last.typ.Channels && last.typ == t && last.ee.Serial == ee.Serial {
+				last.interfaces = append(last.interfaces, ft)
+				continue
+			}
+		}
+		chips = append(chips, &ftdiChip{ee: ee, typ: t, interfaces: []*ftdi.FT232H{ft}})
+	}
+	return chips
 }
 
 func (d *Device) connectSPI(mode spi.Mode) error {
 	if d.FTDI == nil {
-		return errors.New("FT2232H device not found")
+		return ErrDeviceNotFound
 	}
 
 	port, err := d.FTDI.SPI()
@@ -101,6 +705,9 @@ func (d *Device) connectSPI(mode spi.Mode) error {
 		return fmt.Errorf("failed to get SPI port: %w", err)
 	}
 
-	d.conn, err = port.Connect(d.clock, mode, 8)
-	return err
+	if d.conn, err = port.Connect(d.clock, mode, 8); err != nil {
+		return err
+	}
+	d.port = port
+	return nil
 }
@@ -1,3 +1,16 @@
+// # Not supported
+//
+// Programming the Nonvolatile Configuration Memory of the iCE40 UltraPlus: the
+// sequence is not documented by Lattice [Lattice-TN1248], only by reverse
+// engineering, and the memory is one-time programmable, so a mistake cannot be
+// undone. Configure the FPGA from the flash or through SRAM instead.
+//
+// Sniffing the SPI bus while the FPGA boots from the flash: the MPSSE is only
+// an SPI master and cannot follow the clock of the FPGA, and sampling the pins
+// in bit-bang mode falls short of the megahertz clock of the configuration.
+// Capture the boot with a logic analyzer, and compare it with the transactions
+// of gice dumped by WithVCD.
+//
 // # References:
 //
 // FTDI (https://ftdichip.com/document/application-notes/)
@@ -9,10 +22,18 @@
 // SPI Flash
 //   - [N25Q32]: N25Q032A Micron Serial NOR Flash Memory datasheet (could not find the official public URL)
 //   - [W25Q128]: W25Q128JV-DTR Winbond Serial Flash Memory (https://www.winbond.com/resource-files/W25Q128JV_DTR%20RevD%2012232024%20Plus.pdf)
+//   - [JESD216]: JEDEC Serial Flash Discoverable Parameters (SFDP) (https://www.jedec.org/standards-documents/docs/jesd216b)
 //
 // FPGA
+//   - [Lattice-TN1248]: iCE40 Programming and Configuration (https://www.latticesemi.com/view_document?document_id=46502)
 //   - [Lattice-EB82]: iCEstick User Manual (https://www.latticesemi.com/view_document?document_id=50701)
 //   - [iCEBreaker]: iCEBreaker FPGA (https://github.com/icebreaker-fpga/icebreaker/blob/master/hardware/v1.0e/icebreaker-sch.pdf)
 //   - [bitstream-format]: Bitstream File Format Documentation (https://github.com/YosysHQ/icestorm/blob/master/docs/source/format.rst)
 //   - [icpack]: icepack.cc (https://github.com/YosysHQ/icestorm/blob/master/icepack/icepack.cc)
+//
+// Programmers
+//   - [serprog]: Serial Flasher Protocol Specification (https://www.flashrom.org/supported_hw/supported_prog/serprog/serprog-protocol.html)
+//
+// File formats
+//   - [UF2]: USB Flashing Format (https://github.com/microsoft/uf2)
 package gice
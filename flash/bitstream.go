@@ -0,0 +1,123 @@
+package flash
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/gentam/gice/bitstream"
+	"github.com/gentam/gice/board"
+)
+
+// FindBitstream scans the flash from addr for at most limit bytes and returns
+// the first bitstream found along with its content. Info.Offset is the flash
+// address of the image.
+func (f *Flash) FindBitstream(addr, limit int) (*bitstream.Info, []byte, error) {
+	const chunkSize = 64 << 10
+	buf := []byte{}
+	for {
+		n := min(chunkSize, limit-len(buf))
+		if n <= 0 {
+			return nil, nil, bitstream.ErrNoPreamble
+		}
+		data, err := f.Read(addr+len(buf), n)
+		if err != nil {
+			return nil, nil, err
+		}
+		buf = append(buf, data...)
+
+		info, err := bitstream.Parse(buf)
+		if errors.Is(err, bitstream.ErrNoPreamble) || errors.Is(err, bitstream.ErrTruncated) {
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		img := buf[info.Offset : info.Offset+info.Size]
+		info.Offset += addr
+		return info, img, nil
+	}
+}
+
+// ReadMultibootHeader reads the multiboot header at address 0. It returns
+// a nil header without error if the first bytes of the flash are blank.
+func (f *Flash) ReadMultibootHeader() (*bitstream.MultibootHeader, error) {
+	buf, err := f.Read(0, bitstream.MultibootHeaderSize)
+	if err != nil {
+		return nil, err
+	}
+	if isBlank(buf) {
+		return nil, nil
+	}
+	return bitstream.ParseMultibootHeader(buf)
+}
+
+// WriteMultibootHeader writes the header at address 0, preserving the rest of
+// the first 4KB subsector.
+func (f *Flash) WriteMultibootHeader(h *bitstream.MultibootHeader) error {
+	const subsectorSize = 4 << 10
+	buf, err := f.Read(0, subsectorSize)
+	if err != nil {
+		return err
+	}
+	copy(buf, h.Bytes())
+	if err := f.Erase4KB(0); err != nil {
+		return err
+	}
+	return f.WriteAt(bytes.NewReader(buf), 0)
+}
+
+// PlanSlot returns the flash address of warm boot slot n without changing the
+// flash. The address is taken from the multiboot header at address 0 when it
+// holds a dedicated vector for the slot; otherwise the slot is placed as
+// described by the board profile, and PlanSlot returns the regions to write
+// once the image is in place, in order: if the flash starts with a plain
+// bitstream rather than a header, that bitstream copied to slot 0 so that it
+// remains the power-on image, then the new or updated header.
+func (f *Flash) PlanSlot(b *board.Board, slot int) (addr int, after []Region, err error) {
+	if slot < 0 || slot >= bitstream.MultibootSlots {
+		return 0, nil, fmt.Errorf("slot %d out of range [0, %d]", slot, bitstream.MultibootSlots-1)
+	}
+
+	h, err := f.ReadMultibootHeader()
+	if err == nil && h != nil && h.Dedicated(slot) {
+		return h.Slots[slot].Addr, nil, nil
+	}
+	if b == nil {
+		return 0, nil, fmt.Errorf("no boot vector for slot %d; board profile required", slot)
+	}
+	var plain []byte
+	if err != nil {
+		// A single image at 0 is converted to a multiboot layout
+		info, img, findErr := f.FindBitstream(0, min(2*b.SlotSize, f.Size()))
+		if findErr != nil || info.Offset != 0 {
+			return 0, nil, fmt.Errorf("flash does not start with a multiboot header or a bitstream: %w", err)
+		}
+		plain = img
+	}
+	if h == nil {
+		h = bitstream.NewMultibootHeader(b)
+	}
+	if err := h.Retarget(slot, b.SlotAddr(slot)); err != nil {
+		return 0, nil, err
+	}
+	if plain != nil && slot != 0 {
+		if len(plain) > b.SlotSize {
+			return 0, nil, fmt.Errorf("bitstream at 0 is %d bytes, too large for slot 0 of %s (%d bytes); "+
+				"erase the first subsector to start a multiboot layout", len(plain), b.Name, b.SlotSize)
+		}
+		f.debug("convert bitstream at 0 to slot 0", "size", len(plain))
+		after = append(after, Region{Addr: h.Slots[0].Addr, Data: plain})
+	}
+	after = append(after, Region{Addr: 0, Data: h.Bytes()})
+	return h.Slots[slot].Addr, after, nil
+}
+
+func isBlank(buf []byte) bool {
+	for _, b := range buf {
+		if b != 0xFF {
+			return false
+		}
+	}
+	return true
+}
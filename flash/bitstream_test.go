@@ -0,0 +1,193 @@
+package flash_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/gentam/gice/bitstream"
+	"github.com/gentam/gice/board"
+	"github.com/gentam/gice/flash"
+	"github.com/gentam/gice/flash/flashtest"
+)
+
+// packed returns the bitstream of the configuration in ASCII format src.
+func packed(t testing.TB, src string) []byte {
+	t.Helper()
+	var out bytes.Buffer
+	p := bitstream.Packer{}
+	if err := p.Pack(&out, strings.NewReader(src)); err != nil {
+		t.Fatal(err)
+	}
+	return out.Bytes()
+}
+
+// header returns the multiboot header of b with its warm boot slots at addrs.
+func header(t testing.TB, b *board.Board, addrs ...int) *bitstream.MultibootHeader {
+	t.Helper()
+	h := bitstream.NewMultibootHeader(b)
+	for i, addr := range addrs {
+		if err := h.Retarget(i, addr); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return h
+}
+
+func TestPlanSlot(t *testing.T) {
+	img := packed(t, ".comment plan\n.device 1k\n")
+	b := board.ICEBreaker
+	tests := []struct {
+		name  string
+		old   []byte // content at address 0
+		board *board.Board
+		slot  int
+		addr  int
+		after []flash.Region
+		ok    bool
+	}{
+		{
+			name:  "blank flash",
+			board: b,
+			slot:  1,
+			addr:  0x40000,
+			after: []flash.Region{{Addr: 0, Data: header(t, b).Bytes()}},
+			ok:    true,
+		},
+		{
+			name:  "dedicated vector",
+			old:   header(t, b, 0x20000, 0x31000, 0x60000, 0x80000).Bytes(),
+			board: b,
+			slot:  1,
+			addr:  0x31000,
+			ok:    true,
+		},
+		{
+			name: "dedicated vector without board",
+			old:  header(t, b, 0x20000, 0x31000, 0x60000, 0x80000).Bytes(),
+			slot: 1,
+			addr: 0x31000,
+			ok:   true,
+		},
+		{
+			name:  "shared vector",
+			old:   header(t, b, 0x20000, 0x20000, 0x20000, 0x20000).Bytes(),
+			board: b,
+			slot:  3,
+			addr:  0x80000,
+			after: []flash.Region{{Addr: 0, Data: header(t, b, 0x20000, 0x20000, 0x20000, 0x80000).Bytes()}},
+			ok:    true,
+		},
+		{
+			name:  "plain bitstream",
+			old:   img,
+			board: b,
+			slot:  2,
+			addr:  0x60000,
+			after: []flash.Region{{Addr: 0x20000, Data: img}, {Addr: 0, Data: header(t, b).Bytes()}},
+			ok:    true,
+		},
+		{
+			name:  "plain bitstream replaced by slot 0",
+			old:   img,
+			board: b,
+			slot:  0,
+			addr:  0x20000,
+			after: []flash.Region{{Addr: 0, Data: header(t, b).Bytes()}},
+			ok:    true,
+		},
+		{
+			name: "shared vector without board",
+			old:  header(t, b, 0x20000, 0x20000, 0x20000, 0x20000).Bytes(),
+			slot: 3,
+		},
+		{
+			name:  "plain bitstream too large for slot 0",
+			old:   img,
+			board: &board.Board{Name: "tiny", SlotSize: len(img) - 1},
+			slot:  1,
+		},
+		{name: "negative slot", board: b, slot: -1},
+		{name: "slot past the last", board: b, slot: bitstream.MultibootSlots},
+		{name: "unknown content", old: pattern(0x1000, 0), board: b, slot: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, chip := newFlash(t, flashtest.W25Q128)
+			chip.Load(0, tt.old)
+			before := bytes.Clone(chip.Bytes())
+			addr, after, err := f.PlanSlot(tt.board, tt.slot)
+			if (err == nil) != tt.ok {
+				t.Fatalf("PlanSlot(%d) error %v, want ok %v", tt.slot, err, tt.ok)
+			}
+			if !bytes.Equal(chip.Bytes(), before) {
+				t.Errorf("flash changed")
+			}
+			if !tt.ok {
+				return
+			}
+			if addr != tt.addr {
+				t.Errorf("slot %d at 0x%X, want 0x%X", tt.slot, addr, tt.addr)
+			}
+			if len(after) != len(tt.after) {
+				t.Fatalf("%d regions to write after the image, want %d", len(after), len(tt.after))
+			}
+			for i, r := range after {
+				if r.Addr != tt.after[i].Addr || !bytes.Equal(r.Data, tt.after[i].Data) {
+					t.Errorf("region %d: %d bytes at 0x%X, want %d bytes at 0x%X", i, len(r.Data), r.Addr, len(tt.after[i].Data), tt.after[i].Addr)
+				}
+			}
+		})
+	}
+}
+
+// TestWriteSlot writes images to warm boot slots like gice write -slot: the
+// image at the planned address, then the regions returned by PlanSlot one at
+// a time.
+func TestWriteSlot(t *testing.T) {
+	b := board.ICEBreaker
+	f, chip := newFlash(t, flashtest.W25Q128)
+	old := packed(t, ".comment power-on\n.device 1k\n")
+	chip.Load(0, old)
+
+	write := func(slot int, img []byte) int {
+		t.Helper()
+		addr, after, err := f.PlanSlot(b, slot)
+		if err != nil {
+			t.Fatal(err)
+		}
+		regions := append([]flash.Region{{Addr: addr, Data: img}}, after...)
+		for _, r := range regions {
+			if _, err := f.UpdateRegions([]flash.Region{r}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return addr
+	}
+	img1 := packed(t, ".comment slot 1\n.device 1k\n")
+	img2 := packed(t, ".comment slot 2\n.device 1k\n")
+	// The first write converts the plain bitstream to slot 0
+	if addr := write(2, img2); addr != 0x60000 {
+		t.Errorf("slot 2 written at 0x%X, want 0x60000", addr)
+	}
+	if addr := write(1, img1); addr != 0x40000 {
+		t.Errorf("slot 1 written at 0x%X, want 0x40000", addr)
+	}
+
+	h, err := f.ReadMultibootHeader()
+	if err != nil || h == nil {
+		t.Fatalf("multiboot header %v: %v", h, err)
+	}
+	if want := bitstream.NewMultibootHeader(b); *h != *want {
+		t.Errorf("header %v, want %v", h, want)
+	}
+	for addr, want := range map[int][]byte{0x20000: old, 0x40000: img1, 0x60000: img2} {
+		info, img, err := f.FindBitstream(addr, b.SlotSize)
+		if err != nil {
+			t.Fatalf("0x%X: %v", addr, err)
+		}
+		if info.Offset != addr || !bytes.Equal(img, want) {
+			t.Errorf("0x%X: %d bytes at 0x%X, want the %d bytes written", addr, len(img), info.Offset, len(want))
+		}
+	}
+}
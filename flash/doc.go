@@ -0,0 +1,15 @@
+// Package flash drives the SPI NOR flash holding the iCE40 configuration over
+// any periph.io spi.Conn: reading, erasing and programming, the status and
+// protection registers, OTP and SFDP. It has no dependency on a particular
+// programmer.
+//
+// # References:
+//
+// SPI Flash
+//   - [N25Q32]: N25Q032A Micron Serial NOR Flash Memory datasheet (could not find the official public URL)
+//   - [W25Q128]: W25Q128JV-DTR Winbond Serial Flash Memory (https://www.winbond.com/resource-files/W25Q128JV_DTR%20RevD%2012232024%20Plus.pdf)
+//   - [JESD216]: JEDEC Serial Flash Discoverable Parameters (SFDP) (https://www.jedec.org/standards-documents/docs/jesd216b)
+//
+// FTDI
+//   - [FTDI-AN_108]: Command Processor for MPSSE and MCU Host Bus Emulation Modes (https://ftdichip.com/wp-content/uploads/2020/08/AN_108_Command_Processor_for_MPSSE_and_MCU_Host_Bus_Emulation_Modes.pdf)
+package flash
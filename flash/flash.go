@@ -0,0 +1,591 @@
+package flash
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gentam/gice/board"
+	"periph.io/x/conn/v3/gpio"
+	"periph.io/x/conn/v3/spi"
+)
+
+// Flash is safe for concurrent use: each command holds the lock of the flash
+// while it is on the bus, so that a status poller and a writer sharing it do
+// not corrupt each other's transfers.
+type Flash struct {
+	mu sync.Mutex // held while a command is on the bus; see Lock
+	t  Transport
+	id [3]byte // JEDEC ID of the flash chip
+	pr *flashParams
+
+	// Progress, if set, is called by Erase after each erased sector with the
+	// number of bytes done out of total.
+	Progress func(done, total int)
+
+	// OnErase, if set, is called before each erase command with the range it
+	// erases: a subsector, a sector or the whole chip.
+	OnErase func(addr, size int)
+
+	// Reserved lists the ranges that erase and program operations refuse to
+	// touch with ErrReserved, such as board.Board.Reserved. Clear it to
+	// override the protection.
+	Reserved []board.ReservedRange
+
+	// Stats counts the bytes read, programmed and erased, and the time spent.
+	// Commands update it under the lock, so read it while holding Lock when
+	// the flash is shared between goroutines.
+	Stats Stats
+
+	// AutoWake, if set, makes any command sent after PowerDown release the
+	// flash from deep power-down first, see gice.WithAutoPowerDown.
+	AutoWake bool
+	asleep   bool // PowerDown was called and the flash not woken since
+
+	trace io.Writer    // log of the SPI transactions, if set
+	log   *slog.Logger // receives the debug events, if set
+}
+
+// Option configures a Flash.
+type Option func(*Flash)
+
+// WithReserved sets Flash.Reserved, e.g. to the reserved ranges of a board
+// profile.
+func WithReserved(r ...board.ReservedRange) Option {
+	return func(f *Flash) { f.Reserved = slices.Clone(r) }
+}
+
+// WithAutoWake sets Flash.AutoWake.
+func WithAutoWake() Option {
+	return func(f *Flash) { f.AutoWake = true }
+}
+
+// WithTrace logs every SPI transaction of the flash to w, like TraceConn.
+func WithTrace(w io.Writer) Option {
+	return func(f *Flash) { f.trace = w }
+}
+
+// WithLogger emits the debug events of the flash to l, such as erases, wake-ups
+// and busy timeouts, and every SPI transaction at LevelTrace like LogConn.
+func WithLogger(l *slog.Logger) Option {
+	return func(f *Flash) { f.log = l }
+}
+
+// New returns the flash attached to the SPI connection c, which may be any
+// periph.io SPI bus such as an spidev port or an FTDI MPSSE. Chip select is
+// driven through cs around each command, or left to the connection if cs is
+// nil.
+func New(c spi.Conn, cs gpio.PinIO, opts ...Option) *Flash {
+	f := &Flash{}
+	for _, opt := range opts {
+		opt(f)
+	}
+	f.Reconnect(c, cs)
+	return f
+}
+
+// NewFromTransport returns the flash reached through t, for programmers that
+// carry whole commands rather than SPI transfers. WithTrace has no effect, and
+// WithLogger emits no transactions.
+func NewFromTransport(t Transport, opts ...Option) *Flash {
+	f := &Flash{}
+	for _, opt := range opts {
+		opt(f)
+	}
+	f.t = t
+	return f
+}
+
+// Reconnect replaces the SPI connection and chip select of the flash, e.g.
+// after the programmer was reopened, keeping its identity and settings. Hold
+// Lock meanwhile when the flash is shared between goroutines.
+func (f *Flash) Reconnect(c spi.Conn, cs gpio.PinIO) {
+	if f.trace != nil {
+		c = TraceConn(c, f.trace)
+	}
+	if f.log != nil {
+		c = LogConn(c, f.log)
+	}
+	f.t = SPITransport(c, cs)
+}
+
+// ErrReserved is returned when erasing or programming a range of
+// Flash.Reserved.
+var ErrReserved = errors.New("flash range is reserved")
+
+// checkReserved returns ErrReserved if [addr, addr+n) overlaps a reserved
+// range.
+func (f *Flash) checkReserved(addr, n int) error {
+	for _, r := range f.Reserved {
+		if addr < r.End && r.Start < addr+n {
+			return fmt.Errorf("%w: 0x%06X-0x%06X overlaps %s", ErrReserved, addr, addr+n, r)
+		}
+	}
+	return nil
+}
+
+// Flash commands:
+//   - [N25Q32|Table 16: Command Set]
+//   - [W25Q128|8.1.2 Instruction Set Table 1]
+const (
+	flashCmdPowerUp            = 0xAB // Release Power Down
+	flashCmdPowerDown          = 0xB9
+	flashCmdReadID             = 0x9F
+	flashCmdRead               = 0x03
+	flashCmdWriteEnable        = 0x06
+	flashCmdPageProgram        = 0x02
+	flashCmdErase4KB           = 0x20 // Subsector Erase / Sector Erase (4KB)
+	flashCmdErase64KB          = 0xD8 // Sector Erase / Block Erase (64KB)
+	flashCmdEraseChip          = 0xC7 // Bulk Erase / Chip Erase
+	flashCmdReadStatusRegister = 0x05
+)
+
+// tx wraps SPI transaction with CS assertion.
+func (f *Flash) tx(buf []byte) error { return f.txRead(buf, len(buf)) }
+
+// Tx sends the first n bytes of buf as a raw command and reads the response
+// into the rest, like the built-in commands, e.g. for a programmer server
+// forwarding the commands of a client.
+func (f *Flash) Tx(buf []byte, n int) error { return f.txRead(buf, n) }
+
+// Lock holds off the commands of the flash, from any goroutine, until Unlock,
+// for callers that drive the SPI bus or chip select directly meanwhile. The
+// holder must not send flash commands itself.
+func (f *Flash) Lock() { f.mu.Lock() }
+
+// Unlock releases the bus taken by Lock.
+func (f *Flash) Unlock() { f.mu.Unlock() }
+
+// txRead sends the first n bytes of buf and reads the response into the rest,
+// waking the flash first with AutoWake.
+func (f *Flash) txRead(buf []byte, n int) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.txLocked(buf, n)
+}
+
+// txLocked is txRead with the lock held.
+func (f *Flash) txLocked(buf []byte, n int) error {
+	if f.asleep && f.AutoWake {
+		f.debug("wake flash from deep power-down")
+		if err := f.wake(); err != nil {
+			return fmt.Errorf("wake flash: %w", err)
+		}
+	}
+	return f.t.Tx(buf, n)
+}
+
+// writeTx sends the write enable command followed by the command in buf,
+// without letting a command of another goroutine consume the write enable
+// latch in between.
+func (f *Flash) writeTx(buf []byte) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.txLocked([]byte{flashCmdWriteEnable}, 1); err != nil {
+		return err
+	}
+	return f.txLocked(buf, len(buf))
+}
+
+func (f *Flash) PowerUp() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.wake()
+}
+
+func (f *Flash) wake() error {
+	if err := f.t.Tx([]byte{flashCmdPowerUp}, 1); err != nil {
+		return err
+	}
+	f.asleep = false
+	time.Sleep(f.tRES1())
+	return nil
+}
+
+func (f *Flash) PowerDown() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.sleep()
+}
+
+func (f *Flash) sleep() error {
+	if err := f.t.Tx([]byte{flashCmdPowerDown}, 1); err != nil {
+		return err
+	}
+	f.asleep = true
+	time.Sleep(f.tDP())
+	return nil
+}
+
+// Suspend puts the flash into deep power-down and takes the bus like Lock,
+// e.g. to configure the FPGA over it in slave mode. Resume releases it; with
+// AutoWake, the next command wakes the flash.
+func (f *Flash) Suspend() error {
+	f.mu.Lock()
+	if err := f.sleep(); err != nil {
+		f.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// Resume releases the bus taken by Suspend.
+func (f *Flash) Resume() { f.mu.Unlock() }
+
+// ReadID returns the JEDEC ID of the flash chip and configures its parameters.
+// It returns a non-empty name for known IDs. The extended device string is ignored.
+func (f *Flash) ReadID() (id [3]byte, name string, err error) {
+	buf := make([]byte, 4)
+	buf[0] = flashCmdReadID
+
+	if err = f.txRead(buf, 1); err != nil {
+		return
+	}
+
+	f.id = [3]byte(buf[1:])
+	if params, ok := knownFlash[f.id]; ok {
+		f.pr = &params
+		name = params.name
+	}
+	f.debug("flash identified", "id", fmt.Sprintf("%X", f.id), "name", name)
+	return f.id, name, err
+}
+
+// Size returns the capacity of the flash identified by ReadID, or the maximum
+// size addressable with 24-bit addresses if the flash is unknown.
+func (f *Flash) Size() int {
+	if f.pr == nil {
+		return 1 << 24
+	}
+	return f.pr.size
+}
+
+// Read performs a read operation, splitting it into multiple transactions if needed
+// to stay within the maximum transaction size.
+func (f *Flash) Read(addr, n int) ([]byte, error) {
+	const cmdBytes = 4 // opRead + 24‑bit address
+	maxData := f.MaxTxSize() - cmdBytes
+	defer f.timed(&f.Stats.ReadTime)()
+
+	out := make([]byte, n)
+	off := 0
+	for remaining := n; remaining > 0; {
+		chunk := min(remaining, maxData)
+		buf := make([]byte, cmdBytes+chunk)
+		buf[0] = flashCmdRead
+		buf[1] = byte(addr >> 16)
+		buf[2] = byte(addr >> 8)
+		buf[3] = byte(addr)
+		// buf[4:] dummy bytes
+
+		if err := f.txRead(buf, cmdBytes); err != nil {
+			return nil, err
+		}
+
+		copy(out[off:], buf[cmdBytes:])
+		f.count(func(s *Stats) { s.BytesRead += chunk })
+
+		addr += chunk
+		off += chunk
+		remaining -= chunk
+	}
+	return out, nil
+}
+
+// MaxTxSize returns the maximum size of a single SPI transaction, which is
+// lower than the MPSSE limit with some controllers such as spidev.
+func (f *Flash) MaxTxSize() int {
+	const mpsseMaxTx = 65536 // [FTDI-AN_108]
+	if n := f.t.MaxTxSize(); n > 0 {
+		return min(n, mpsseMaxTx)
+	}
+	return mpsseMaxTx
+}
+
+// addr: 24 bit
+// data: max 256 bytes
+func (f *Flash) pageProgram(addr int, data []byte) error {
+	if err := f.checkReserved(addr, len(data)); err != nil {
+		return err
+	}
+	defer f.timed(&f.Stats.ProgramTime)()
+
+	const max24 = 1<<24 - 1 // 0xFFFFFF
+	if addr < 0 || addr > max24 {
+		return fmt.Errorf("address 0x%X out of 24-bit range", addr)
+	}
+	if len(data) > 256 {
+		return errors.New("data must not exceed 256 bytes")
+	}
+	buf := make([]byte, 4+len(data))
+	buf[0] = flashCmdPageProgram
+	buf[1] = byte(addr >> 16)
+	buf[2] = byte(addr >> 8)
+	buf[3] = byte(addr)
+	copy(buf[4:], data)
+
+	if err := f.writeTx(buf); err != nil {
+		return err
+	}
+	f.count(func(s *Stats) { s.BytesProgrammed += len(data) })
+	return f.BusyWait(100*time.Microsecond, f.tPP())
+}
+
+// Write programs the data read from r starting at address 0.
+func (f *Flash) Write(r io.Reader) error { return f.WriteAt(r, 0) }
+
+// WriteAt programs the data read from r starting at addr, splitting it at page
+// boundaries. Pages consisting only of 0xFF are skipped since programming
+// cannot set bits; the target range must be erased beforehand.
+func (f *Flash) WriteAt(r io.Reader, addr int) error {
+	const pageSize = 256
+	buf := [pageSize]byte{}
+	for {
+		chunk := pageSize - addr%pageSize
+		n, err := io.ReadFull(r, buf[:chunk])
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return err
+		}
+		if n == 0 {
+			break
+		}
+		if !isBlank(buf[:n]) {
+			if err := f.pageProgram(addr, buf[:n]); err != nil {
+				return err
+			}
+		}
+		addr += n
+	}
+	return nil
+}
+
+func (f *Flash) Erase4KB(addr int) error {
+	if err := f.checkReserved(addr&^(4<<10-1), 4<<10); err != nil {
+		return err
+	}
+	defer f.timed(&f.Stats.EraseTime)()
+	f.onErase(addr&^(4<<10-1), 4<<10)
+
+	buf := make([]byte, 4)
+	buf[0] = flashCmdErase4KB
+	buf[1] = byte(addr >> 16)
+	buf[2] = byte(addr >> 8)
+	buf[3] = byte(addr)
+
+	if err := f.writeTx(buf); err != nil {
+		return err
+	}
+	f.count(func(s *Stats) { s.Erased4KB++ })
+	return f.BusyWait(50*time.Millisecond, f.tErase4KB())
+}
+
+// Erase64KB erases a 64KB sector.
+func (f *Flash) Erase64KB(addr int) error {
+	if err := f.checkReserved(addr&^(64<<10-1), 64<<10); err != nil {
+		return err
+	}
+	defer f.timed(&f.Stats.EraseTime)()
+	f.onErase(addr&^(64<<10-1), 64<<10)
+
+	buf := make([]byte, 4)
+	buf[0] = flashCmdErase64KB
+	buf[1] = byte(addr >> 16)
+	buf[2] = byte(addr >> 8)
+	buf[3] = byte(addr)
+
+	if err := f.writeTx(buf); err != nil {
+		return err
+	}
+	f.count(func(s *Stats) { s.Erased64KB++ })
+	return f.BusyWait(100*time.Millisecond, f.tErase64KB())
+}
+
+// EraseChip bulk erase the entire chip.
+func (f *Flash) EraseChip() error {
+	if err := f.checkReserved(0, f.Size()); err != nil {
+		return err
+	}
+	defer f.timed(&f.Stats.EraseTime)()
+	f.onErase(0, f.Size())
+
+	buf := []byte{flashCmdEraseChip}
+	if err := f.writeTx(buf); err != nil {
+		return err
+	}
+	f.count(func(s *Stats) { s.ErasedChip++ })
+	return f.BusyWait(time.Second, f.tEraseChip())
+}
+
+// Erase erases the 4KB subsectors covering the size bytes starting from
+// baseAddr, using Erase64KB for the 64KB sectors fully inside that range and
+// Erase4KB for the rest. An unaligned range thus also erases the bytes sharing
+// its first and last subsectors; use UpdateRegions to preserve them.
+func (f *Flash) Erase(baseAddr, size int) error {
+	const (
+		sectorSize    = 64 << 10 // 64KB
+		subsectorSize = 4 << 10  // 4KB
+	)
+	if size <= 0 {
+		return nil
+	}
+
+	start := baseAddr &^ (subsectorSize - 1)
+	end := (baseAddr + size + subsectorSize - 1) &^ (subsectorSize - 1)
+	total := end - start
+	for addr := start; addr < end; {
+		// Use 64KB sectors wherever a whole aligned one fits
+		if addr%sectorSize == 0 && end-addr >= sectorSize {
+			if err := f.Erase64KB(addr); err != nil {
+				return err
+			}
+			addr += sectorSize
+		} else {
+			if err := f.Erase4KB(addr); err != nil {
+				return err
+			}
+			addr += subsectorSize
+		}
+		f.progress(addr-start, total)
+	}
+	return nil
+}
+
+// timed returns a function adding the time elapsed since the call to d.
+func (f *Flash) timed(d *time.Duration) func() {
+	start := time.Now()
+	return func() { f.count(func(*Stats) { *d += time.Since(start) }) }
+}
+
+// debug emits an event to the logger of WithLogger, if set.
+func (f *Flash) debug(msg string, args ...any) {
+	if f.log != nil {
+		f.log.Debug(msg, args...)
+	}
+}
+
+// count updates Stats under the lock.
+func (f *Flash) count(update func(*Stats)) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	update(&f.Stats)
+}
+
+func (f *Flash) onErase(addr, size int) {
+	f.debug("erase", "addr", fmt.Sprintf("0x%06X", addr), "size", size)
+	if f.OnErase != nil {
+		f.OnErase(addr, size)
+	}
+}
+
+func (f *Flash) progress(done, total int) {
+	if f.Progress != nil {
+		f.Progress(done, total)
+	}
+}
+
+// ErrBusyTimeout is returned when the flash is still busy after the maximum
+// program or erase time, e.g. because it is not powered or the bus is stuck.
+var ErrBusyTimeout = errors.New("flash busy timeout")
+
+// BusyWait waits for the flash to become ready by polling the status register's
+// bit 0 with specified intervals, or returns ErrBusyTimeout when the timeout
+// expires. Set timeout to 0 to wait indefinitely.
+func (f *Flash) BusyWait(interval, timeout time.Duration) error {
+	// Fast path
+	if sr, err := f.ReadStatusRegister(); err == nil && !sr.Busy() {
+		return nil
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	if timeout == 0 {
+		timer.Stop() // disable timer for unconfigured timeout
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-timer.C:
+			f.count(func(s *Stats) { s.BusyTimeouts++ })
+			f.debug("busy timeout", "timeout", timeout)
+			return fmt.Errorf("%w after %v", ErrBusyTimeout, timeout)
+		case <-ticker.C:
+			f.count(func(s *Stats) { s.BusyPolls++ })
+			sr, err := f.ReadStatusRegister()
+			if err != nil {
+				return err
+			}
+			if !sr.Busy() {
+				return nil
+			}
+		}
+	}
+}
+
+// StatusRegister represents the status register of the flash chip.
+//
+//	Bits| [N25Q32|Table 9]                     | [W25Q128|7.1 Status Registers]
+//	----+--------------------------------------+-------------------------------
+//	7   | Status register write enable/disable | SRP: Status Register Protect
+//	6   | Reserved                             | SEC: Sector protect
+//	5   | Top/bottom                           | TB: Top/Bottom protect
+//	4:2 | Block protect 2-0                    | BP2-0: Block Protect bit 2-0
+//	1   | Write enable latch                   | WEL: Write Enable Latch
+//	0   | Write in progress                    | BUSY: Erase/Write in progress
+type StatusRegister byte
+
+func (sr StatusRegister) StatusRegisterProtect() bool { return sr&(1<<7) != 0 }
+func (sr StatusRegister) SectorProtect() bool         { return sr&(1<<6) != 0 }
+func (sr StatusRegister) TopBottom() bool             { return sr&(1<<5) != 0 }
+func (sr StatusRegister) BlockProtect2() bool         { return sr&(1<<4) != 0 }
+func (sr StatusRegister) BlockProtect1() bool         { return sr&(1<<3) != 0 }
+func (sr StatusRegister) BlockProtect0() bool         { return sr&(1<<2) != 0 }
+func (sr StatusRegister) WriteEnabled() bool          { return sr&(1<<1) != 0 }
+func (sr StatusRegister) Busy() bool                  { return sr&(1<<0) != 0 }
+
+func (sr StatusRegister) String() string {
+	b := fmt.Sprintf("%08b", byte(sr))
+	s := []string{}
+	if sr.StatusRegisterProtect() {
+		s = append(s, "SRP")
+	}
+	if sr.SectorProtect() {
+		s = append(s, "SEC")
+	}
+	if sr.TopBottom() {
+		s = append(s, "TB")
+	}
+	if sr.BlockProtect2() {
+		s = append(s, "BP2")
+	}
+	if sr.BlockProtect1() {
+		s = append(s, "BP1")
+	}
+	if sr.BlockProtect0() {
+		s = append(s, "BP0")
+	}
+	if sr.WriteEnabled() {
+		s = append(s, "WEL")
+	}
+	if sr.Busy() {
+		s = append(s, "BUSY")
+	}
+	if len(s) == 0 {
+		return b
+	}
+	return b + " " + strings.Join(s, ",")
+}
+
+func (f *Flash) ReadStatusRegister() (StatusRegister, error) {
+	buf := []byte{flashCmdReadStatusRegister, 0}
+	if err := f.txRead(buf, 1); err != nil {
+		return 0, err
+	}
+	return StatusRegister(buf[1]), nil
+}
@@ -1,9 +1,15 @@
-package gice
+package flash
 
-import "time"
+import (
+	"fmt"
+	"slices"
+	"time"
+)
 
 type flashParams struct {
-	name string
+	name   string
+	size   int // capacity in bytes
+	status statusLayout
 
 	tRES1      time.Duration
 	tDP        time.Duration
@@ -20,7 +26,9 @@ var (
 
 var knownFlash = map[[3]byte]flashParams{
 	flashIDMicronN25Q32: {
-		name: "Micron N25Q 32Mb",
+		name:   "Micron N25Q 32Mb",
+		size:   4 << 20,
+		status: statusMicron,
 
 		// [N25Q32|Table 38: AC Characteristics and Operating Conditions]
 		// tPP: PAGE PROGRAM cycle time (256 bytes)
@@ -34,7 +42,9 @@ var knownFlash = map[[3]byte]flashParams{
 	},
 
 	flashIDWinbondW25Q128: {
-		name: "Winbond W25Q 128Mb",
+		name:   "Winbond W25Q 128Mb",
+		size:   16 << 20,
+		status: statusWinbond,
 
 		// [W25Q128|9.6 AC Electrical Characteristics]:
 		// tRES1: /CS High to Standby Mode without ID Read
@@ -84,3 +94,14 @@ func (f *Flash) tErase64KB() time.Duration {
 func (f *Flash) tEraseChip() time.Duration {
 	return f.paramOrMax(func(p *flashParams) time.Duration { return p.tEraseChip })
 }
+
+// KnownFlashes returns the JEDEC IDs and names of the flash chips with known
+// parameters, sorted by ID, e.g. "EF7018 Winbond W25Q 128Mb".
+func KnownFlashes() []string {
+	names := make([]string, 0, len(knownFlash))
+	for id, p := range knownFlash {
+		names = append(names, fmt.Sprintf("%X %s", id, p.name))
+	}
+	slices.Sort(names)
+	return names
+}
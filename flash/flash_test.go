@@ -0,0 +1,168 @@
+package flash_test
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gentam/gice/flash"
+	"github.com/gentam/gice/flash/flashtest"
+)
+
+// newFlash returns a flash identified on a blank chip of the model.
+func newFlash(t testing.TB, m flashtest.Model) (*flash.Flash, *flashtest.Chip) {
+	t.Helper()
+	chip := flashtest.New(m)
+	f := flash.New(chip, nil)
+	if _, _, err := f.ReadID(); err != nil {
+		t.Fatal(err)
+	}
+	return f, chip
+}
+
+// answers is a flash transport answering the JEDEC ID, the SFDP area and
+// status for every other command, e.g. with fuzzed content.
+type answers struct {
+	id     [3]byte
+	status byte
+	sfdp   []byte
+}
+
+func (a *answers) Tx(buf []byte, n int) error {
+	resp := buf[n:]
+	switch buf[0] {
+	case 0x9F:
+		copy(resp, a.id[:])
+	case 0x5A:
+		addr := int(buf[1])<<16 | int(buf[2])<<8 | int(buf[3])
+		for i := range resp {
+			resp[i] = 0xFF
+			if addr+i < len(a.sfdp) {
+				resp[i] = a.sfdp[addr+i]
+			}
+		}
+	default:
+		for i := range resp {
+			resp[i] = a.status
+		}
+	}
+	return nil
+}
+
+func (a *answers) MaxTxSize() int { return 0 }
+
+func TestEraseUnaligned(t *testing.T) {
+	tests := []struct {
+		name       string
+		addr, size int
+		start, end int // range erased
+		counts     flashtest.Counts
+	}{
+		{"empty", 0x1100, 0, 0, 0, flashtest.Counts{}},
+		{"inside a subsector", 0x1100, 0x10, 0x1000, 0x2000, flashtest.Counts{Erases4KB: 1}},
+		{"across subsectors", 0x0FFF, 2, 0x0000, 0x2000, flashtest.Counts{Erases4KB: 2}},
+		{"aligned sector", 0x10000, 0x10000, 0x10000, 0x20000, flashtest.Counts{Erases64KB: 1}},
+		{"around a sector", 0xF000, 0x11001, 0xF000, 0x21000, flashtest.Counts{Erases4KB: 2, Erases64KB: 1}},
+		{"unaligned start", 0x10800, 0x10000, 0x10000, 0x21000, flashtest.Counts{Erases4KB: 1, Erases64KB: 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, chip := newFlash(t, flashtest.W25Q128)
+			const n = 0x40000
+			chip.Load(0, make([]byte, n))
+
+			if err := f.Erase(tt.addr, tt.size); err != nil {
+				t.Fatal(err)
+			}
+			want := make([]byte, n)
+			copy(want[tt.start:tt.end], bytes.Repeat([]byte{0xFF}, tt.end-tt.start))
+			if got := chip.Bytes()[:n]; !bytes.Equal(got, want) {
+				t.Errorf("erased range differs from 0x%06X-0x%06X", tt.start, tt.end)
+			}
+			if got := chip.Counts(); got != tt.counts {
+				t.Errorf("counts = %+v, want %+v", got, tt.counts)
+			}
+		})
+	}
+}
+
+func TestBusyWait(t *testing.T) {
+	tests := []struct {
+		name    string
+		busy    time.Duration // erase time of the chip
+		timeout time.Duration
+		err     error
+	}{
+		{"ready", 0, time.Millisecond, nil},
+		{"done in time", 10 * time.Millisecond, time.Second, nil},
+		{"no timeout", 10 * time.Millisecond, 0, nil},
+		{"timeout", time.Hour, 20 * time.Millisecond, flash.ErrBusyTimeout},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, chip := newFlash(t, flashtest.W25Q128)
+			chip.Timing = flashtest.Timing{Erase4KB: tt.busy}
+			// Erase without the wait of Erase4KB
+			if err := f.Tx([]byte{0x06}, 1); err != nil {
+				t.Fatal(err)
+			}
+			if err := f.Tx([]byte{0x20, 0, 0, 0}, 4); err != nil {
+				t.Fatal(err)
+			}
+
+			err := f.BusyWait(time.Millisecond, tt.timeout)
+			if !errors.Is(err, tt.err) || (err == nil) != (tt.err == nil) {
+				t.Fatalf("BusyWait = %v, want %v", err, tt.err)
+			}
+			timeouts := 0
+			if tt.err != nil {
+				timeouts = 1
+			}
+			if f.Stats.BusyTimeouts != timeouts {
+				t.Errorf("BusyTimeouts = %d, want %d", f.Stats.BusyTimeouts, timeouts)
+			}
+		})
+	}
+}
+
+func FuzzReadID(f *testing.F) {
+	for _, m := range []flashtest.Model{flashtest.W25Q128, flashtest.N25Q32} {
+		f.Add(m.ID[0], m.ID[1], m.ID[2], byte(0x1C), byte(0x40))
+	}
+	f.Add(byte(0xFF), byte(0xFF), byte(0xFF), byte(0xFF), byte(0xFF))
+	f.Add(byte(0), byte(0), byte(0), byte(0), byte(0))
+	f.Fuzz(func(t *testing.T, id0, id1, id2, sr, sr2 byte) {
+		fl := flash.NewFromTransport(&answers{id: [3]byte{id0, id1, id2}, status: sr})
+		id, _, err := fl.ReadID()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if id != [3]byte{id0, id1, id2} {
+			t.Fatalf("ID %X, want %X", id, [3]byte{id0, id1, id2})
+		}
+		size := fl.Size()
+		if size <= 0 || size > 1<<24 {
+			t.Fatalf("size %d outside 24-bit addressing", size)
+		}
+		inRange := func(p flash.Protection) {
+			t.Helper()
+			if p.Start < 0 || p.Start > p.End || p.End > size {
+				t.Fatalf("protection %v outside the %d bytes of the flash", p, size)
+			}
+		}
+		for _, p := range fl.Protections() {
+			inRange(p)
+		}
+		regs, err := fl.ReadStatusRegisters()
+		if err != nil {
+			t.Fatal(err)
+		}
+		inRange(fl.Protection(regs))
+		regs.HasSR2, regs.SR2 = true, flash.StatusRegister2(sr2)
+		inRange(fl.Protection(regs))
+		if otp, err := fl.OTP(); err == nil && (otp.Count <= 0 || otp.Size <= 0) {
+			t.Fatalf("OTP %+v without regions", otp)
+		}
+	})
+}
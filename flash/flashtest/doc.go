@@ -0,0 +1,18 @@
+// Package flashtest provides an in-memory SPI NOR flash chip, so that code
+// using package flash can be tested without hardware:
+//
+//	chip := flashtest.New(flashtest.W25Q128)
+//	f := flash.New(chip, nil)
+//
+// The chip answers the commands sent by package flash over its spi.Conn:
+// reads, page programs and erases with the rules of NOR flash, the status
+// registers with their block protection, deep power-down, the OTP area, the
+// unique ID and a minimal SFDP table. Operations complete at once unless
+// Chip.Timing makes the chip report busy for a while.
+//
+// # References:
+//
+//   - [N25Q32]: N25Q032A Micron Serial NOR Flash Memory datasheet (could not find the official public URL)
+//   - [W25Q128]: W25Q128JV-DTR Winbond Serial Flash Memory (https://www.winbond.com/resource-files/W25Q128JV_DTR%20RevD%2012232024%20Plus.pdf)
+//   - [JESD216]: JEDEC Serial Flash Discoverable Parameters (SFDP) (https://www.jedec.org/standards-documents/docs/jesd216b)
+package flashtest
@@ -0,0 +1,488 @@
+package flashtest
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"time"
+
+	"periph.io/x/conn/v3"
+	"periph.io/x/conn/v3/spi"
+)
+
+// Model describes the flash chip emulated by a Chip.
+type Model struct {
+	ID   [3]byte // JEDEC ID
+	Size int     // capacity in bytes
+
+	// Micron selects the status layout of Micron chips: a flag status
+	// register and a 64-byte OTP array instead of the status registers 2-3,
+	// the sector protect bit and the security registers of Winbond chips.
+	Micron bool
+}
+
+// Models of the flash chips known to package flash.
+var (
+	W25Q128 = Model{ID: [3]byte{0xEF, 0x70, 0x18}, Size: 16 << 20}
+	N25Q32  = Model{ID: [3]byte{0x20, 0xBA, 0x16}, Size: 4 << 20, Micron: true}
+)
+
+// Timing is how long a Chip reports busy after each operation, during which
+// it only answers status register reads. The zero value completes every
+// operation at once.
+type Timing struct {
+	PageProgram time.Duration
+	Erase4KB    time.Duration
+	Erase64KB   time.Duration
+	EraseChip   time.Duration
+	WriteStatus time.Duration
+}
+
+// Typical program and erase times of the models, to simulate real hardware.
+//   - [N25Q32|Table 38: AC Characteristics and Operating Conditions]
+//   - [W25Q128|9.6 AC Electrical Characteristics]
+var (
+	W25Q128Timing = Timing{
+		PageProgram: 400 * time.Microsecond,
+		Erase4KB:    45 * time.Millisecond,
+		Erase64KB:   150 * time.Millisecond,
+		EraseChip:   40 * time.Second,
+		WriteStatus: 10 * time.Millisecond,
+	}
+	N25Q32Timing = Timing{
+		PageProgram: 500 * time.Microsecond,
+		Erase4KB:    250 * time.Millisecond,
+		Erase64KB:   700 * time.Millisecond,
+		EraseChip:   30 * time.Second,
+		WriteStatus: 1300 * time.Microsecond,
+	}
+)
+
+// Counts counts the operations carried out by a Chip. Commands ignored because
+// the write enable latch was not set or the range is protected are not counted.
+type Counts struct {
+	PagePrograms int
+	Erases4KB    int
+	Erases64KB   int
+	ChipErases   int
+}
+
+// Flash commands:
+//   - [N25Q32|Table 16: Command Set]
+//   - [W25Q128|8.1.2 Instruction Set Table 1]
+const (
+	cmdWriteStatus  = 0x01
+	cmdPageProgram  = 0x02
+	cmdRead         = 0x03
+	cmdReadStatus   = 0x05
+	cmdWriteEnable  = 0x06
+	cmdReadStatus3  = 0x15
+	cmdErase4KB     = 0x20
+	cmdWriteStatus2 = 0x31
+	cmdReadStatus2  = 0x35
+	cmdProgramOTP   = 0x42
+	cmdReadSecurity = 0x48
+	cmdReadUniqueID = 0x4B // Read OTP Array on Micron chips
+	cmdReadSFDP     = 0x5A
+	cmdReadFlag     = 0x70
+	cmdReadID       = 0x9F
+	cmdPowerUp      = 0xAB
+	cmdPowerDown    = 0xB9
+	cmdEraseChip    = 0xC7
+	cmdErase64KB    = 0xD8
+)
+
+// Chip is an in-memory SPI NOR flash chip. It is a full-duplex spi.Conn driving
+// chip select itself: every transaction is a command. It is safe for
+// concurrent use.
+type Chip struct {
+	Model
+	Timing Timing
+
+	// WriteProtect emulates the /WP pin held low: the status registers cannot
+	// be written while their SRP bit is set.
+	WriteProtect bool
+
+	// UniqueID is returned by the Read Unique ID command of Winbond chips, and
+	// as the first bytes of the customized factory data of Micron chips.
+	UniqueID [8]byte
+
+	// OnChange, if set, is called with the range of the content changed by
+	// each program or erase, e.g. to write it through to a file. data is only
+	// valid during the call, which holds the lock of the chip.
+	OnChange func(addr int, data []byte)
+
+	mu        sync.Mutex
+	data      []byte
+	sr        byte // SRP, SEC, TB and BP2-0; BUSY and WEL are added on read
+	sr2, sr3  byte
+	flag      byte // error bits of the Micron flag status register
+	wel       bool
+	busyUntil time.Time
+	asleep    bool
+	otp       []byte // security registers 1-3, or the OTP array and its control byte
+	counts    Counts
+}
+
+// New returns a blank chip of the model.
+func New(m Model) *Chip {
+	c := &Chip{
+		Model:    m,
+		UniqueID: [8]byte{0xD1, 0x6C, 0xE0, 0x00, m.ID[0], m.ID[1], m.ID[2], 0x01},
+		data:     bytes.Repeat([]byte{0xFF}, m.Size),
+	}
+	if m.Micron {
+		c.otp = bytes.Repeat([]byte{0xFF}, 64+1)
+	} else {
+		c.otp = bytes.Repeat([]byte{0xFF}, 3*256)
+	}
+	return c
+}
+
+// Bytes returns a copy of the content of the chip.
+func (c *Chip) Bytes() []byte {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return bytes.Clone(c.data)
+}
+
+// Load sets the content at addr to data, bypassing erase and program rules and
+// protection, e.g. to start a test from a programmed flash.
+func (c *Chip) Load(addr int, data []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	copy(c.data[addr:], data)
+}
+
+// Counts returns the operations carried out so far.
+func (c *Chip) Counts() Counts {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.counts
+}
+
+func (c *Chip) String() string { return fmt.Sprintf("flashtest(%X)", c.ID) }
+
+func (c *Chip) Duplex() conn.Duplex { return conn.Full }
+
+// Tx runs the command shifted out from w and shifts the answer into r, padding
+// w with zeros if r is longer.
+func (c *Chip) Tx(w, r []byte) error {
+	in := make([]byte, max(len(w), len(r)))
+	copy(in, w)
+	copy(r, c.command(in))
+	return nil
+}
+
+func (c *Chip) TxPackets(p []spi.Packet) error {
+	for _, pkt := range p {
+		if err := c.Tx(pkt.W, pkt.R); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// command runs a transaction, in being the bytes shifted in, and returns the
+// bytes shifted out at the same time. Undriven output reads as 0xFF.
+func (c *Chip) command(in []byte) []byte {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	out := bytes.Repeat([]byte{0xFF}, len(in))
+	if len(in) == 0 {
+		return out
+	}
+	if c.asleep {
+		// Only Release Power Down is decoded in deep power-down
+		if in[0] == cmdPowerUp {
+			c.asleep = false
+		}
+		return out
+	}
+
+	busy := time.Now().Before(c.busyUntil)
+	// Status registers are shifted out repeatedly until chip select rises
+	switch in[0] {
+	case cmdReadStatus:
+		sr := c.sr
+		if busy {
+			sr |= 1 << 0
+		}
+		if c.wel {
+			sr |= 1 << 1
+		}
+		fill(out[1:], sr)
+	case cmdReadStatus2:
+		if !c.Micron {
+			fill(out[1:], c.sr2)
+		}
+	case cmdReadStatus3:
+		if !c.Micron {
+			fill(out[1:], c.sr3)
+		}
+	case cmdReadFlag:
+		if c.Micron {
+			flag := c.flag
+			if !busy {
+				flag |= 1 << 7
+			}
+			fill(out[1:], flag)
+		}
+	}
+	if busy {
+		return out
+	}
+
+	switch in[0] {
+	case cmdReadID:
+		id := c.ID[:]
+		if c.Micron {
+			// Length, extended device ID and customized factory data
+			// [N25Q32|READ ID]
+			id = append(id, 0x10)
+			id = append(id, c.UniqueID[:]...)
+		}
+		copy(out[1:], id)
+	case cmdRead:
+		if len(in) > 4 {
+			addr := addr24(in)
+			for i := range out[4:] {
+				out[4+i] = c.data[(addr+i)%c.Size]
+			}
+		}
+	case cmdReadSFDP:
+		if len(in) > 5 {
+			table := sfdp(c.Size)
+			for i, a := 0, addr24(in); 5+i < len(out) && a+i < len(table); i++ {
+				out[5+i] = table[a+i]
+			}
+		}
+	case cmdReadSecurity:
+		if !c.Micron && len(in) > 5 {
+			c.readOTP(out[5:], addr24(in))
+		}
+	case cmdReadUniqueID:
+		switch {
+		case c.Micron && len(in) > 5:
+			c.readOTP(out[5:], addr24(in))
+		case !c.Micron:
+			// [W25Q128|8.2.40 Read Unique ID Number (4Bh)]: 4 dummy bytes
+			if len(out) > 5 {
+				copy(out[5:], c.UniqueID[:])
+			}
+		}
+	case cmdWriteEnable:
+		c.wel = true
+	case cmdPowerDown:
+		c.asleep = true
+	case cmdPageProgram:
+		if len(in) > 4 && c.writeEnabled() {
+			c.program(addr24(in), in[4:])
+		}
+	case cmdErase4KB:
+		if len(in) >= 4 && c.writeEnabled() {
+			c.erase(addr24(in), 4<<10, &c.counts.Erases4KB, c.Timing.Erase4KB)
+		}
+	case cmdErase64KB:
+		if len(in) >= 4 && c.writeEnabled() {
+			c.erase(addr24(in), 64<<10, &c.counts.Erases64KB, c.Timing.Erase64KB)
+		}
+	case cmdEraseChip:
+		if c.writeEnabled() {
+			c.erase(0, c.Size, &c.counts.ChipErases, c.Timing.EraseChip)
+		}
+	case cmdWriteStatus:
+		if len(in) > 1 && c.writeEnabled() && c.statusWritable() {
+			mask := byte(0b1111_1100)
+			if c.Micron {
+				mask = 0b1011_1100 // no SEC bit
+			}
+			c.sr = in[1] & mask
+			if len(in) > 2 && !c.Micron {
+				c.writeStatus2(in[2])
+			}
+			c.busy(c.Timing.WriteStatus)
+		}
+	case cmdWriteStatus2:
+		if len(in) > 1 && !c.Micron && c.writeEnabled() && c.statusWritable() {
+			c.writeStatus2(in[1])
+			c.busy(c.Timing.WriteStatus)
+		}
+	case cmdProgramOTP:
+		if len(in) > 4 && c.writeEnabled() {
+			c.programOTP(addr24(in), in[4:])
+		}
+	}
+	return out
+}
+
+// writeEnabled consumes the write enable latch, which every program, erase and
+// write status command clears whether it succeeds or not.
+func (c *Chip) writeEnabled() bool {
+	ok := c.wel
+	c.wel = false
+	return ok
+}
+
+func (c *Chip) busy(d time.Duration) {
+	c.busyUntil = time.Now().Add(d)
+}
+
+// statusWritable reports whether the status registers can be written, which
+// SRP prevents while /WP is low.
+func (c *Chip) statusWritable() bool {
+	return !c.WriteProtect || c.sr&(1<<7) == 0
+}
+
+// writeStatus2 writes SRL, QE and CMP; the security register lock bits LB1-3
+// can only be set. [W25Q128|7.1.9 Security Register Lock Bits]
+func (c *Chip) writeStatus2(v byte) {
+	const locks = 0b0011_1000
+	c.sr2 = v&0b0100_0011 | (c.sr2|v)&locks
+}
+
+// program ANDs data into the page of addr, wrapping around at its end like the
+// chip. Only the last 256 bytes are kept if data is longer.
+func (c *Chip) program(addr int, data []byte) {
+	const pageSize = 256
+	addr %= c.Size
+	page := addr &^ (pageSize - 1)
+	if c.isProtected(page, pageSize) {
+		c.flag |= 1<<4 | 1<<1 // program and protection errors
+		return
+	}
+	if len(data) > pageSize {
+		data = data[len(data)-pageSize:]
+	}
+	for i, b := range data {
+		c.data[page+(addr-page+i)%pageSize] &= b
+	}
+	c.changed(page, pageSize)
+	c.counts.PagePrograms++
+	c.busy(c.Timing.PageProgram)
+}
+
+// erase sets the size-aligned block holding addr to 0xFF, unless part of it is
+// protected.
+func (c *Chip) erase(addr, size int, count *int, d time.Duration) {
+	addr = addr % c.Size &^ (size - 1)
+	if c.isProtected(addr, size) {
+		c.flag |= 1<<5 | 1<<1 // erase and protection errors
+		return
+	}
+	copy(c.data[addr:addr+size], bytes.Repeat([]byte{0xFF}, size))
+	c.changed(addr, size)
+	*count++
+	c.busy(d)
+}
+
+func (c *Chip) changed(addr, n int) {
+	if c.OnChange != nil {
+		c.OnChange(addr, c.data[addr:addr+n])
+	}
+}
+
+// isProtected reports whether [addr, addr+n) overlaps the range protected by
+// the block protect bits.
+//   - [N25Q32|Protected Area Sizes]
+//   - [W25Q128|7.1 Status Registers]
+func (c *Chip) isProtected(addr, n int) bool {
+	start, end := c.protected()
+	return addr < end && start < addr+n
+}
+
+func (c *Chip) protected() (start, end int) {
+	bp := int(c.sr>>2) & 7
+	var n int // protected bytes
+	switch {
+	case bp == 0:
+	case bp == 7:
+		n = c.Size
+	case c.sr&(1<<6) != 0 && !c.Micron:
+		// SEC: 4KB sectors instead of 64KB blocks
+		n = min(4<<10<<(bp-1), 32<<10)
+	default:
+		n = c.Size >> (7 - bp)
+	}
+	start, end = c.Size-n, c.Size
+	if c.sr&(1<<5) != 0 {
+		start, end = 0, n
+	}
+	if !c.Micron && c.sr2&(1<<6) != 0 {
+		// CMP protects everything but the range
+		if start == 0 {
+			return end, c.Size
+		}
+		return 0, start
+	}
+	return start, end
+}
+
+// readOTP reads the OTP area from addr into out: security register n at
+// n<<12 on Winbond chips, or the OTP array followed by its control byte on
+// Micron chips.
+func (c *Chip) readOTP(out []byte, addr int) {
+	if c.Micron {
+		for i := range out {
+			out[i] = c.otp[(addr+i)%len(c.otp)]
+		}
+		return
+	}
+	n := addr >> 12
+	if n < 1 || n > 3 {
+		return
+	}
+	reg := c.otp[(n-1)*256 : n*256]
+	for i := range out {
+		out[i] = reg[(addr+i)%256]
+	}
+}
+
+// programOTP ANDs data into the OTP area at addr, unless it is locked.
+func (c *Chip) programOTP(addr int, data []byte) {
+	if c.Micron {
+		if c.otp[64]&1 == 0 {
+			c.flag |= 1<<4 | 1<<1
+			return
+		}
+		for i, b := range data {
+			c.otp[(addr+i)%len(c.otp)] &= b
+		}
+	} else {
+		n := addr >> 12
+		if n < 1 || n > 3 || c.sr2&(1<<(2+n)) != 0 {
+			return
+		}
+		reg := c.otp[(n-1)*256 : n*256]
+		for i, b := range data {
+			reg[(addr+i)%256] &= b
+		}
+	}
+	c.busy(c.Timing.PageProgram)
+}
+
+// sfdp returns an SFDP area with the header, a single parameter header, and
+// the first two DWORDs of the basic flash parameter table at 0x30: 4KB erase
+// with opcode 0x20, and the density. [JESD216|6.2 SFDP Header]
+func sfdp(size int) []byte {
+	const tableAddr = 0x30
+	const tableDWords = 9
+	b := bytes.Repeat([]byte{0xFF}, tableAddr+4*tableDWords)
+	copy(b, "SFDP")
+	copy(b[4:], []byte{0x06, 0x01, 0x00, 0xFF})
+	copy(b[8:], []byte{0x00, 0x06, 0x01, tableDWords, tableAddr, 0x00, 0x00, 0xFF})
+	copy(b[tableAddr:], []byte{0xE5, 0x20, 0xF1, 0xFF})
+	bits := uint32(size*8 - 1)
+	copy(b[tableAddr+4:], []byte{byte(bits), byte(bits >> 8), byte(bits >> 16), byte(bits >> 24)})
+	return b
+}
+
+func addr24(in []byte) int {
+	return int(in[1])<<16 | int(in[2])<<8 | int(in[3])
+}
+
+func fill(b []byte, v byte) {
+	for i := range b {
+		b[i] = v
+	}
+}
@@ -0,0 +1,170 @@
+package flash
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// One-time programmable (OTP) area commands.
+//   - [N25Q32|Table 16: Command Set]
+//   - [W25Q128|8.1.2 Instruction Set Table 1]
+const (
+	flashCmdReadOTP          = 0x4B // Read OTP Array (Micron)
+	flashCmdProgramOTP       = 0x42 // Program OTP Array / Program Security Registers
+	flashCmdReadSecurityRegs = 0x48 // Read Security Registers (Winbond)
+)
+
+// ErrUnknownFlash is returned for operations that depend on the flash model
+// when ReadID did not identify the flash.
+var ErrUnknownFlash = errors.New("unknown flash")
+
+// OTP describes the one-time programmable area of the flash: Count regions of
+// Size bytes, numbered from 1, which can be locked individually.
+//
+//   - Winbond: security registers 1-3 of 256 bytes at 0x1000, 0x2000 and
+//     0x3000, locked by LB1-3 of status register 2 [W25Q128|7.1.9 Security
+//     Register Lock Bits].
+//   - Micron: a 64-byte OTP array, locked by bit 0 of its control byte 64
+//     [N25Q32|PROGRAM OTP ARRAY].
+type OTP struct {
+	Count int
+	Size  int
+}
+
+// OTP returns the layout of the OTP area of the flash identified by ReadID.
+func (f *Flash) OTP() (OTP, error) {
+	switch f.statusLayout() {
+	case statusWinbond:
+		return OTP{Count: 3, Size: 256}, nil
+	case statusMicron:
+		return OTP{Count: 1, Size: 64}, nil
+	}
+	return OTP{}, fmt.Errorf("%w: OTP area not known", ErrUnknownFlash)
+}
+
+// otpAddr returns the address of byte off of OTP region n.
+func (f *Flash) otpAddr(n, off int) (int, error) {
+	otp, err := f.OTP()
+	if err != nil {
+		return 0, err
+	}
+	if n < 1 || n > otp.Count {
+		return 0, fmt.Errorf("OTP region %d out of range [1, %d]", n, otp.Count)
+	}
+	if off < 0 || off > otp.Size {
+		return 0, fmt.Errorf("OTP offset %d out of range [0, %d]", off, otp.Size)
+	}
+	if f.statusLayout() == statusWinbond {
+		return n<<12 | off, nil
+	}
+	return off, nil
+}
+
+// ReadOTP reads OTP region n.
+func (f *Flash) ReadOTP(n int) ([]byte, error) {
+	addr, err := f.otpAddr(n, 0)
+	if err != nil {
+		return nil, err
+	}
+	otp, _ := f.OTP()
+	return f.readOTP(addr, otp.Size)
+}
+
+func (f *Flash) readOTP(addr, size int) ([]byte, error) {
+	cmd := byte(flashCmdReadOTP)
+	if f.statusLayout() == statusWinbond {
+		cmd = flashCmdReadSecurityRegs
+	}
+	const cmdBytes = 5 // command, 24-bit address and 8 dummy clocks
+	buf := make([]byte, cmdBytes+size)
+	buf[0] = cmd
+	buf[1] = byte(addr >> 16)
+	buf[2] = byte(addr >> 8)
+	buf[3] = byte(addr)
+	if err := f.txRead(buf, cmdBytes); err != nil {
+		return nil, err
+	}
+	return buf[cmdBytes:], nil
+}
+
+// WriteOTP programs data at offset off of OTP region n. As with the main
+// array, programming can only clear bits, and the erase commands of the main
+// array leave the OTP area untouched.
+func (f *Flash) WriteOTP(n, off int, data []byte) error {
+	addr, err := f.otpAddr(n, off)
+	if err != nil {
+		return err
+	}
+	if otp, _ := f.OTP(); off+len(data) > otp.Size {
+		return fmt.Errorf("%d bytes at offset %d exceed the %d-byte OTP region", len(data), off, otp.Size)
+	}
+	return f.programOTP(addr, data)
+}
+
+func (f *Flash) programOTP(addr int, data []byte) error {
+	buf := make([]byte, 4+len(data))
+	buf[0] = flashCmdProgramOTP
+	buf[1] = byte(addr >> 16)
+	buf[2] = byte(addr >> 8)
+	buf[3] = byte(addr)
+	copy(buf[4:], data)
+	if err := f.writeTx(buf); err != nil {
+		return err
+	}
+	return f.BusyWait(100*time.Microsecond, f.tPP())
+}
+
+// OTPLocked tells whether OTP region n is locked.
+func (f *Flash) OTPLocked(n int) (bool, error) {
+	otp, err := f.OTP()
+	if err != nil {
+		return false, err
+	}
+	if _, err := f.otpAddr(n, 0); err != nil {
+		return false, err
+	}
+	if f.statusLayout() == statusWinbond {
+		regs, err := f.ReadStatusRegisters()
+		if err != nil {
+			return false, err
+		}
+		return regs.SR2.SecurityLock(n), nil
+	}
+	ctrl, err := f.readOTP(otp.Size, 1)
+	if err != nil {
+		return false, err
+	}
+	return ctrl[0]&1 == 0, nil
+}
+
+// LockOTP permanently locks OTP region n against programming and erasing.
+// This cannot be undone.
+func (f *Flash) LockOTP(n int) error {
+	otp, err := f.OTP()
+	if err != nil {
+		return err
+	}
+	if _, err := f.otpAddr(n, 0); err != nil {
+		return err
+	}
+	if f.statusLayout() == statusWinbond {
+		regs, err := f.ReadStatusRegisters()
+		if err != nil {
+			return err
+		}
+		if err := f.WriteStatusRegister2(regs.SR2 | 1<<(2+n)); err != nil {
+			return err
+		}
+	} else if err := f.programOTP(otp.Size, []byte{0xFE}); err != nil {
+		return err
+	}
+	locked, err := f.OTPLocked(n)
+	if err != nil {
+		return err
+	}
+	if !locked {
+		return fmt.Errorf("OTP region %d still unlocked after locking", n)
+	}
+	return nil
+}
@@ -0,0 +1,366 @@
+package flash
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// statusLayout tells which status registers a flash has besides the first one,
+// and how its block protect bits are interpreted.
+type statusLayout int
+
+const (
+	statusBasic   statusLayout = iota // status register only; BP2-0 and TB
+	statusMicron                      // flag status register
+	statusWinbond                     // status registers 2 and 3, SEC and CMP
+)
+
+// Status register commands besides flashCmdReadStatusRegister.
+//   - [N25Q32|Table 16: Command Set]
+//   - [W25Q128|8.1.2 Instruction Set Table 1]
+const (
+	flashCmdReadFlagStatusRegister = 0x70
+	flashCmdReadStatusRegister2    = 0x35
+	flashCmdReadStatusRegister3    = 0x15
+)
+
+// StatusRegisters holds the status registers supported by the flash, as read by
+// ReadStatusRegisters.
+type StatusRegisters struct {
+	SR StatusRegister
+
+	// HasSR2 is set if SR2 and SR3 are the Winbond status registers 2 and 3.
+	HasSR2 bool
+	SR2    StatusRegister2
+	SR3    StatusRegister3
+
+	// HasFlag is set if Flag is the Micron flag status register.
+	HasFlag bool
+	Flag    FlagStatusRegister
+}
+
+// StatusRegister2 is the status register 2 of Winbond flash chips.
+// [W25Q128|7.1 Status Registers]
+//
+//	Bits| Status Register-2
+//	----+--------------------------------
+//	7   | SUS: Erase/Program Suspend
+//	6   | CMP: Complement Protect
+//	5:3 | LB3-1: Security Register Lock
+//	2   | Reserved
+//	1   | QE: Quad Enable
+//	0   | SRL: Status Register Lock
+type StatusRegister2 byte
+
+func (sr StatusRegister2) Suspended() bool          { return sr&(1<<7) != 0 }
+func (sr StatusRegister2) Complement() bool         { return sr&(1<<6) != 0 }
+func (sr StatusRegister2) SecurityLock(n int) bool  { return sr&(1<<(2+n)) != 0 } // LB1-3
+func (sr StatusRegister2) QuadEnable() bool         { return sr&(1<<1) != 0 }
+func (sr StatusRegister2) StatusRegisterLock() bool { return sr&(1<<0) != 0 }
+
+func (sr StatusRegister2) String() string {
+	return formatBits(byte(sr), [8]string{"SRL", "QE", "", "LB1", "LB2", "LB3", "CMP", "SUS"})
+}
+
+// StatusRegister3 is the status register 3 of Winbond flash chips.
+// [W25Q128|7.1 Status Registers]
+//
+//	Bits| Status Register-3
+//	----+--------------------------------
+//	6:5 | DRV1-0: Output Driver Strength
+//	2   | WPS: Write Protect Selection
+type StatusRegister3 byte
+
+func (sr StatusRegister3) WriteProtectSelect() bool { return sr&(1<<2) != 0 }
+
+func (sr StatusRegister3) String() string {
+	return formatBits(byte(sr), [8]string{"", "", "WPS", "", "", "DRV0", "DRV1", ""})
+}
+
+// FlagStatusRegister is the flag status register of Micron flash chips.
+// [N25Q32|Flag Status Register]
+//
+//	Bits| Name
+//	----+------------------------------
+//	7   | Program or erase controller (1: ready)
+//	6   | Erase suspend
+//	5   | Erase error
+//	4   | Program error
+//	3   | VPP (1: disabled)
+//	2   | Program suspend
+//	1   | Protection error
+//	0   | Reserved
+type FlagStatusRegister byte
+
+func (sr FlagStatusRegister) Ready() bool           { return sr&(1<<7) != 0 }
+func (sr FlagStatusRegister) EraseError() bool      { return sr&(1<<5) != 0 }
+func (sr FlagStatusRegister) ProgramError() bool    { return sr&(1<<4) != 0 }
+func (sr FlagStatusRegister) ProtectionError() bool { return sr&(1<<1) != 0 }
+
+func (sr FlagStatusRegister) String() string {
+	return formatBits(byte(sr), [8]string{"", "PROT_ERR", "PGM_SUS", "VPP", "PGM_ERR", "ERASE_ERR", "ERASE_SUS", "READY"})
+}
+
+// formatBits formats b in binary followed by the names of the set bits, from
+// the most significant one.
+func formatBits(b byte, names [8]string) string {
+	s := fmt.Sprintf("%08b", b)
+	set := []string{}
+	for i := 7; i >= 0; i-- {
+		if b&(1<<i) != 0 && names[i] != "" {
+			set = append(set, names[i])
+		}
+	}
+	if len(set) == 0 {
+		return s
+	}
+	return s + " " + strings.Join(set, ",")
+}
+
+// ReadStatusRegisters reads all the status registers of the flash identified by
+// ReadID. Unknown flash chips only have the first one read.
+func (f *Flash) ReadStatusRegisters() (StatusRegisters, error) {
+	regs := StatusRegisters{}
+	var err error
+	if regs.SR, err = f.ReadStatusRegister(); err != nil {
+		return regs, err
+	}
+	read := func(cmd byte) (byte, error) {
+		buf := []byte{cmd, 0}
+		err := f.txRead(buf, 1)
+		return buf[1], err
+	}
+	switch f.statusLayout() {
+	case statusWinbond:
+		sr2, err := read(flashCmdReadStatusRegister2)
+		if err != nil {
+			return regs, err
+		}
+		sr3, err := read(flashCmdReadStatusRegister3)
+		if err != nil {
+			return regs, err
+		}
+		regs.HasSR2, regs.SR2, regs.SR3 = true, StatusRegister2(sr2), StatusRegister3(sr3)
+	case statusMicron:
+		flag, err := read(flashCmdReadFlagStatusRegister)
+		if err != nil {
+			return regs, err
+		}
+		regs.HasFlag, regs.Flag = true, FlagStatusRegister(flag)
+	}
+	return regs, nil
+}
+
+func (f *Flash) statusLayout() statusLayout {
+	if f.pr == nil {
+		return statusBasic
+	}
+	return f.pr.status
+}
+
+// Protection is the address range [Start, End) write protected by the block
+// protect bits of the status registers. It is empty if Start == End.
+type Protection struct {
+	Start, End int
+}
+
+func (p Protection) Size() int { return p.End - p.Start }
+
+func (p Protection) String() string {
+	if p.Size() == 0 {
+		return "none"
+	}
+	return fmt.Sprintf("0x%06X-0x%06X (%s)", p.Start, p.End-1, formatSize(p.Size()))
+}
+
+// Protection returns the range protected by the block protect bits of regs,
+// e.g. the upper 1/64 of the flash with BP2-0=001.
+//   - [N25Q32|Protected Area Sizes]
+//   - [W25Q128|7.1 Status Registers]
+//
+// The WPS individual block locks of Winbond flash chips are not considered.
+func (f *Flash) Protection(regs StatusRegisters) Protection {
+	size := f.Size()
+	bp := int(regs.SR>>2) & 7
+	var n int // protected bytes
+	switch {
+	case bp == 0:
+		n = 0
+	case bp == 7:
+		n = size
+	case regs.SR.SectorProtect() && f.statusLayout() == statusWinbond:
+		n = min(4<<10<<(bp-1), 32<<10)
+	default:
+		n = size >> (7 - bp)
+	}
+
+	p := Protection{size - n, size}
+	if regs.SR.TopBottom() {
+		p = Protection{0, n}
+	}
+	if regs.HasSR2 && regs.SR2.Complement() {
+		// Everything but the range
+		switch {
+		case n == 0:
+			p = Protection{0, size}
+		case n == size:
+			p = Protection{}
+		case p.Start == 0:
+			p = Protection{n, size}
+		default:
+			p = Protection{0, size - n}
+		}
+	}
+	if p.Size() == 0 {
+		return Protection{}
+	}
+	return p
+}
+
+// formatSize formats n bytes in KiB or MiB if it is a multiple.
+func formatSize(n int) string {
+	switch {
+	case n >= 1<<20 && n%(1<<20) == 0:
+		return fmt.Sprintf("%d MiB", n>>20)
+	case n >= 1<<10 && n%(1<<10) == 0:
+		return fmt.Sprintf("%d KiB", n>>10)
+	}
+	return fmt.Sprintf("%d bytes", n)
+}
+
+// Status register write commands.
+//   - [N25Q32|Table 16: Command Set]
+//   - [W25Q128|8.1.2 Instruction Set Table 1]
+const (
+	flashCmdWriteStatusRegister  = 0x01
+	flashCmdWriteStatusRegister2 = 0x31
+)
+
+// tW is the maximum status register write cycle time of the known flash chips.
+const tW = 15 * time.Millisecond // [W25Q128|9.6 AC Electrical Characteristics]
+
+// WriteStatusRegister writes the non-volatile status register, whose writable
+// bits are SRP, SEC, TB and BP2-0.
+func (f *Flash) WriteStatusRegister(sr StatusRegister) error {
+	return f.writeStatus(flashCmdWriteStatusRegister, byte(sr))
+}
+
+// WriteStatusRegister2 writes the status register 2 of Winbond flash chips.
+func (f *Flash) WriteStatusRegister2(sr StatusRegister2) error {
+	if f.statusLayout() != statusWinbond {
+		return errors.New("flash has no status register 2")
+	}
+	return f.writeStatus(flashCmdWriteStatusRegister2, byte(sr))
+}
+
+func (f *Flash) writeStatus(cmd, v byte) error {
+	if err := f.writeTx([]byte{cmd, v}); err != nil {
+		return err
+	}
+	return f.BusyWait(time.Millisecond, tW)
+}
+
+// blockProtectMask covers the SEC, TB and BP2-0 bits of the status register.
+const blockProtectMask = 0b0111_1100
+
+// Protections lists the ranges that can be protected with the block protect
+// bits, from the smallest.
+func (f *Flash) Protections() []Protection {
+	ps := []Protection{}
+	for _, sr := range f.protectionBits() {
+		p := f.Protection(StatusRegisters{SR: sr})
+		if !slices.Contains(ps, p) {
+			ps = append(ps, p)
+		}
+	}
+	slices.SortStableFunc(ps, func(a, b Protection) int { return a.Size() - b.Size() })
+	return ps
+}
+
+// protectionBits returns the combinations of the SEC, TB and BP2-0 bits.
+func (f *Flash) protectionBits() []StatusRegister {
+	bits := []StatusRegister{}
+	for sec := range 2 {
+		if sec == 1 && f.statusLayout() != statusWinbond {
+			break
+		}
+		for tb := range 2 {
+			for bp := range 8 {
+				bits = append(bits, StatusRegister(sec<<6|tb<<5|bp<<2))
+			}
+		}
+	}
+	return bits
+}
+
+// ErrStatusProtected is returned by SetProtection when the status register
+// cannot be written.
+var ErrStatusProtected = errors.New("status register is write-protected")
+
+// ErrWriteProtected is returned by the region operations when a range they
+// would erase or program is protected by the block protect bits, which makes
+// the flash ignore the commands silently.
+var ErrWriteProtected = errors.New("flash range is write-protected")
+
+// checkProtected returns ErrWriteProtected if a span overlaps the range
+// protected by the status registers. Unknown flash chips are not checked, as
+// the meaning of their block protect bits is not known.
+func (f *Flash) checkProtected(spans []span) error {
+	if f.pr == nil || len(spans) == 0 {
+		return nil
+	}
+	regs, err := f.ReadStatusRegisters()
+	if err != nil {
+		return err
+	}
+	p := f.Protection(regs)
+	for _, s := range spans {
+		if s.start < p.End && p.Start < s.end {
+			return fmt.Errorf("%w: 0x%06X-0x%06X overlaps %s", ErrWriteProtected, s.start, s.end, p)
+		}
+	}
+	return nil
+}
+
+// SetProtection sets the block protect bits to protect exactly p, which must be
+// one of Protections; an empty range removes the protection. The complement
+// bit of Winbond flash chips is cleared, and the other bits are kept.
+func (f *Flash) SetProtection(p Protection) error {
+	if p.Size() == 0 {
+		p = Protection{}
+	}
+	regs, err := f.ReadStatusRegisters()
+	if err != nil {
+		return err
+	}
+	if regs.SR.StatusRegisterProtect() {
+		// SRP makes the register read-only while /WP is low
+		return fmt.Errorf("%w by SRP; the /WP pin must be high", ErrStatusProtected)
+	}
+	if regs.HasSR2 && regs.SR2.Complement() {
+		if err := f.WriteStatusRegister2(regs.SR2 &^ (1 << 6)); err != nil {
+			return fmt.Errorf("clear CMP: %w", err)
+		}
+	}
+	for _, bits := range f.protectionBits() {
+		if f.Protection(StatusRegisters{SR: bits}) != p {
+			continue
+		}
+		sr := regs.SR&^blockProtectMask | bits
+		if err := f.WriteStatusRegister(sr); err != nil {
+			return err
+		}
+		got, err := f.ReadStatusRegister()
+		if err != nil {
+			return err
+		}
+		if got&blockProtectMask != bits {
+			return fmt.Errorf("%w: reads %s after writing %s", ErrStatusProtected, got, sr)
+		}
+		return nil
+	}
+	return fmt.Errorf("range %s cannot be protected with the block protect bits", p)
+}
@@ -0,0 +1,107 @@
+package flash_test
+
+import (
+	"testing"
+
+	"github.com/gentam/gice/flash"
+	"github.com/gentam/gice/flash/flashtest"
+)
+
+func TestProtection(t *testing.T) {
+	const (
+		n25q32  = 4 << 20
+		w25q128 = 16 << 20
+	)
+	tests := []struct {
+		name  string
+		model flashtest.Model
+		sr    flash.StatusRegister
+		sr2   flash.StatusRegister2 // of Winbond chips
+		want  flash.Protection
+	}{
+		{"N25Q32 none", flashtest.N25Q32, 0b0000_0000, 0, flash.Protection{}},
+		{"N25Q32 upper 1/64", flashtest.N25Q32, 0b0000_0100, 0, flash.Protection{Start: n25q32 - 64<<10, End: n25q32}},
+		{"N25Q32 lower 1/64", flashtest.N25Q32, 0b0010_0100, 0, flash.Protection{Start: 0, End: 64 << 10}},
+		{"N25Q32 upper half", flashtest.N25Q32, 0b0001_1000, 0, flash.Protection{Start: n25q32 / 2, End: n25q32}},
+		{"N25Q32 all", flashtest.N25Q32, 0b0011_1100, 0, flash.Protection{Start: 0, End: n25q32}},
+		{"N25Q32 without sectors", flashtest.N25Q32, 0b0100_0100, 0, flash.Protection{Start: n25q32 - 64<<10, End: n25q32}},
+		{"N25Q32 other bits", flashtest.N25Q32, 0b1000_0011, 0, flash.Protection{}},
+
+		{"W25Q128 none", flashtest.W25Q128, 0b0000_0000, 0, flash.Protection{}},
+		{"W25Q128 upper 256KB", flashtest.W25Q128, 0b0000_0100, 0, flash.Protection{Start: w25q128 - 256<<10, End: w25q128}},
+		{"W25Q128 lower 256KB", flashtest.W25Q128, 0b0010_0100, 0, flash.Protection{Start: 0, End: 256 << 10}},
+		{"W25Q128 upper half", flashtest.W25Q128, 0b0001_1000, 0, flash.Protection{Start: w25q128 / 2, End: w25q128}},
+		{"W25Q128 all", flashtest.W25Q128, 0b0001_1100, 0, flash.Protection{Start: 0, End: w25q128}},
+		{"W25Q128 upper sector", flashtest.W25Q128, 0b0100_0100, 0, flash.Protection{Start: w25q128 - 4<<10, End: w25q128}},
+		{"W25Q128 lower sector", flashtest.W25Q128, 0b0110_0100, 0, flash.Protection{Start: 0, End: 4 << 10}},
+		{"W25Q128 upper 32KB", flashtest.W25Q128, 0b0101_0100, 0, flash.Protection{Start: w25q128 - 32<<10, End: w25q128}},
+		{"W25Q128 complement upper", flashtest.W25Q128, 0b0000_0100, 1 << 6, flash.Protection{Start: 0, End: w25q128 - 256<<10}},
+		{"W25Q128 complement lower", flashtest.W25Q128, 0b0010_0100, 1 << 6, flash.Protection{Start: 256 << 10, End: w25q128}},
+		{"W25Q128 complement none", flashtest.W25Q128, 0b0000_0000, 1 << 6, flash.Protection{Start: 0, End: w25q128}},
+		{"W25Q128 complement all", flashtest.W25Q128, 0b0001_1100, 1 << 6, flash.Protection{}},
+		{"W25Q128 other bits", flashtest.W25Q128, 0b1000_0011, 0b0000_0011, flash.Protection{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, _ := newFlash(t, tt.model)
+			regs := flash.StatusRegisters{SR: tt.sr}
+			if tt.model.ID == flashtest.W25Q128.ID {
+				regs.HasSR2, regs.SR2 = true, tt.sr2
+			}
+			if got := f.Protection(regs); got != tt.want {
+				t.Errorf("SR %s SR2 %s protects %v, want %v", tt.sr, tt.sr2, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadStatusRegisters(t *testing.T) {
+	f, _ := newFlash(t, flashtest.W25Q128)
+	if err := f.WriteStatusRegister(0b0010_1000); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.WriteStatusRegister2(0b0100_0010); err != nil {
+		t.Fatal(err)
+	}
+	regs, err := f.ReadStatusRegisters()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !regs.HasSR2 || regs.HasFlag {
+		t.Fatalf("W25Q128 status registers %+v, want SR2 and SR3 only", regs)
+	}
+	if regs.SR&0b0111_1100 != 0b0010_1000 || !regs.SR2.Complement() || !regs.SR2.QuadEnable() {
+		t.Errorf("read SR %s SR2 %s after writing them", regs.SR, regs.SR2)
+	}
+	if got, want := f.Protection(regs), (flash.Protection{Start: 512 << 10, End: 16 << 20}); got != want {
+		t.Errorf("protects %v, want %v", got, want)
+	}
+
+	f, _ = newFlash(t, flashtest.N25Q32)
+	regs, err = f.ReadStatusRegisters()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if regs.HasSR2 || !regs.HasFlag || !regs.Flag.Ready() {
+		t.Errorf("N25Q32 status registers %+v, want a ready flag status register", regs)
+	}
+}
+
+func TestStatusRegisterString(t *testing.T) {
+	tests := []struct {
+		reg  interface{ String() string }
+		want string
+	}{
+		{flash.StatusRegister2(0b0100_0010), "01000010 CMP,QE"},
+		{flash.StatusRegister2(0b0011_1001), "00111001 LB3,LB2,LB1,SRL"},
+		{flash.StatusRegister3(0b0110_0100), "01100100 DRV1,DRV0,WPS"},
+		{flash.StatusRegister3(0), "00000000"},
+		{flash.FlagStatusRegister(0b1000_0000), "10000000 READY"},
+		{flash.FlagStatusRegister(0b1011_0010), "10110010 READY,ERASE_ERR,PGM_ERR,PROT_ERR"},
+	}
+	for _, tt := range tests {
+		if got := tt.reg.String(); got != tt.want {
+			t.Errorf("%T = %q, want %q", tt.reg, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,281 @@
+package flash
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// Region is data to be programmed at a flash address.
+type Region struct {
+	Addr int
+	Data []byte
+}
+
+func (r Region) end() int { return r.Addr + len(r.Data) }
+
+// AppendRegion appends data at addr, extending the last region if it ends
+// right at addr.
+func AppendRegion(regions []Region, addr int, data []byte) []Region {
+	if n := len(regions); n > 0 && regions[n-1].end() == addr {
+		regions[n-1].Data = append(regions[n-1].Data, data...)
+		return regions
+	}
+	return append(regions, Region{Addr: addr, Data: bytes.Clone(data)})
+}
+
+// WriteRegions programs several regions in one pass. The regions must not
+// overlap. All 4KB subsectors covered by the regions are erased before any of
+// them is programmed, so regions sharing a subsector don't clobber each other.
+func (f *Flash) WriteRegions(regions []Region) error {
+	if err := checkOverlap(regions); err != nil {
+		return err
+	}
+	if err := f.EraseRegions(regions); err != nil {
+		return err
+	}
+	for _, r := range regions {
+		if err := f.WriteAt(bytes.NewReader(r.Data), r.Addr); err != nil {
+			return fmt.Errorf("write 0x%06X: %w", r.Addr, err)
+		}
+	}
+	return nil
+}
+
+// EraseRegions erases the 4KB subsectors covered by the regions, merging
+// adjacent ones so that each subsector is erased only once.
+func (f *Flash) EraseRegions(regions []Region) error {
+	const subsectorSize = 4 << 10
+	if err := f.CheckFits(regions); err != nil {
+		return err
+	}
+	spans := mergeRegions(regions, subsectorSize)
+	if err := f.checkProtected(spans); err != nil {
+		return err
+	}
+	for _, s := range spans {
+		if err := f.Erase(s.start, s.end-s.start); err != nil {
+			return fmt.Errorf("erase 0x%06X: %w", s.start, err)
+		}
+	}
+	return nil
+}
+
+// ErrVerifyMismatch is returned, wrapped in a VerifyError, when the flash
+// content differs from the regions.
+var ErrVerifyMismatch = errors.New("flash content differs")
+
+// VerifyError reports the first byte that differs between the flash and the
+// regions passed to VerifyRegions.
+type VerifyError struct {
+	Addr      int
+	Want, Got byte
+}
+
+func (e *VerifyError) Error() string {
+	return fmt.Sprintf("%v at 0x%06X: wrote %02x, read %02x", ErrVerifyMismatch, e.Addr, e.Want, e.Got)
+}
+
+func (e *VerifyError) Unwrap() error { return ErrVerifyMismatch }
+
+// VerifyRegions reads the regions back and returns a *VerifyError for the
+// first byte that differs.
+func (f *Flash) VerifyRegions(regions []Region) error {
+	for _, r := range regions {
+		got, err := f.Read(r.Addr, len(r.Data))
+		if err != nil {
+			return fmt.Errorf("read 0x%06X: %w", r.Addr, err)
+		}
+		for i := range r.Data {
+			if got[i] != r.Data[i] {
+				return &VerifyError{Addr: r.Addr + i, Want: r.Data[i], Got: got[i]}
+			}
+		}
+	}
+	return nil
+}
+
+// ErrTooLarge is returned when regions extend past the end of the flash.
+var ErrTooLarge = errors.New("image does not fit in the flash")
+
+// CheckFits returns ErrTooLarge if a region extends past the capacity of the
+// flash identified by ReadID, before anything is erased.
+func (f *Flash) CheckFits(regions []Region) error {
+	for _, r := range regions {
+		if r.Addr < 0 {
+			return fmt.Errorf("region at negative address %d", r.Addr)
+		}
+		if r.end() > f.Size() {
+			return fmt.Errorf("%w: 0x%06X-0x%06X exceeds the flash size 0x%X by %d bytes",
+				ErrTooLarge, r.Addr, r.end(), f.Size(), r.end()-f.Size())
+		}
+	}
+	return nil
+}
+
+// CheckWritable checks, without changing the flash, that the regions fit in
+// the flash and that erasing the 4KB subsectors they cover is not refused for
+// a reserved or write-protected range, so that a sequence of writes can be
+// validated before its first step.
+func (f *Flash) CheckWritable(regions []Region) error {
+	const subsectorSize = 4 << 10
+	if err := f.CheckFits(regions); err != nil {
+		return err
+	}
+	spans := mergeRegions(regions, subsectorSize)
+	for _, s := range spans {
+		if err := f.checkReserved(s.start, s.end-s.start); err != nil {
+			return err
+		}
+	}
+	return f.checkProtected(spans)
+}
+
+func checkOverlap(regions []Region) error {
+	sorted := slices.Clone(regions)
+	slices.SortFunc(sorted, func(a, b Region) int { return a.Addr - b.Addr })
+	for i := 1; i < len(sorted); i++ {
+		if prev, r := sorted[i-1], sorted[i]; r.Addr < prev.end() {
+			return fmt.Errorf("region 0x%06X-0x%06X overlaps 0x%06X-0x%06X",
+				r.Addr, r.end(), prev.Addr, prev.end())
+		}
+	}
+	return nil
+}
+
+// span is an address range [start, end).
+type span struct{ start, end int }
+
+// mergeRegions aligns the regions to multiples of align and merges those that
+// touch or overlap.
+func mergeRegions(regions []Region, align int) []span {
+	spans := []span{}
+	for _, r := range regions {
+		if len(r.Data) == 0 {
+			continue
+		}
+		start := r.Addr / align * align
+		end := (r.end() + align - 1) / align * align
+		spans = append(spans, span{start, end})
+	}
+	slices.SortFunc(spans, func(a, b span) int { return a.start - b.start })
+
+	merged := []span{}
+	for _, s := range spans {
+		if n := len(merged); n > 0 && s.start <= merged[n-1].end {
+			merged[n-1].end = max(merged[n-1].end, s.end)
+			continue
+		}
+		merged = append(merged, s)
+	}
+	return merged
+}
+
+// UpdateRegions programs the regions while preserving the rest of the 4KB
+// subsectors they cover. Each subsector is read and patched: it is left alone
+// if unchanged, programmed in place if the new content only clears bits, and
+// erased and rewritten otherwise. It returns the number of subsectors erased.
+func (f *Flash) UpdateRegions(regions []Region) (erased int, err error) {
+	const (
+		subsectorSize = 4 << 10
+		pageSize      = 256
+	)
+	if err := checkOverlap(regions); err != nil {
+		return 0, err
+	}
+	if err := f.CheckFits(regions); err != nil {
+		return 0, err
+	}
+	spans := mergeRegions(regions, subsectorSize)
+	if err := f.checkProtected(spans); err != nil {
+		return 0, err
+	}
+	for _, s := range spans {
+		old, err := f.Read(s.start, s.end-s.start)
+		if err != nil {
+			return erased, fmt.Errorf("read 0x%06X: %w", s.start, err)
+		}
+		buf := bytes.Clone(old)
+		for _, r := range regions {
+			if len(r.Data) > 0 && s.start <= r.Addr && r.end() <= s.end {
+				copy(buf[r.Addr-s.start:], r.Data)
+			}
+		}
+
+		for off := 0; off < len(buf); off += subsectorSize {
+			addr := s.start + off
+			was, want := old[off:off+subsectorSize], buf[off:off+subsectorSize]
+			if bytes.Equal(was, want) {
+				continue
+			}
+			if !programmable(was, want) {
+				f.debug("update subsector", "addr", fmt.Sprintf("0x%06X", addr), "mode", "erase")
+				if err := f.Erase4KB(addr); err != nil {
+					return erased, fmt.Errorf("erase 0x%06X: %w", addr, err)
+				}
+				erased++
+				if err := f.WriteAt(bytes.NewReader(want), addr); err != nil {
+					return erased, fmt.Errorf("write 0x%06X: %w", addr, err)
+				}
+				continue
+			}
+			f.debug("update subsector", "addr", fmt.Sprintf("0x%06X", addr), "mode", "program")
+			for p := 0; p < subsectorSize; p += pageSize {
+				if bytes.Equal(was[p:p+pageSize], want[p:p+pageSize]) {
+					continue
+				}
+				if err := f.pageProgram(addr+p, want[p:p+pageSize]); err != nil {
+					return erased, fmt.Errorf("write 0x%06X: %w", addr+p, err)
+				}
+			}
+		}
+	}
+	return erased, nil
+}
+
+// ResumeRegions completes an interrupted write of the regions. The flash is
+// read back and compared with the regions 4KB subsector by subsector, and only
+// the pieces that differ are written with UpdateRegions. It returns the number
+// of subsector pieces that were already programmed and skipped.
+func (f *Flash) ResumeRegions(regions []Region) (done int, err error) {
+	const subsectorSize = 4 << 10
+	if err := checkOverlap(regions); err != nil {
+		return 0, err
+	}
+	if err := f.CheckFits(regions); err != nil {
+		return 0, err
+	}
+	var todo []Region
+	for _, r := range regions {
+		got, err := f.Read(r.Addr, len(r.Data))
+		if err != nil {
+			return 0, fmt.Errorf("read 0x%06X: %w", r.Addr, err)
+		}
+		for off := 0; off < len(r.Data); {
+			n := min(subsectorSize-(r.Addr+off)%subsectorSize, len(r.Data)-off)
+			if bytes.Equal(got[off:off+n], r.Data[off:off+n]) {
+				done++
+			} else {
+				todo = AppendRegion(todo, r.Addr+off, r.Data[off:off+n])
+			}
+			off += n
+		}
+	}
+	f.debug("resume regions", "done", done, "todo", len(todo))
+	if _, err := f.UpdateRegions(todo); err != nil {
+		return done, err
+	}
+	return done, nil
+}
+
+// programmable reports whether programming can turn old into new, which
+// requires only clearing bits.
+func programmable(old, new []byte) bool {
+	for i := range new {
+		if old[i]&new[i] != new[i] {
+			return false
+		}
+	}
+	return true
+}
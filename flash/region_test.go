@@ -0,0 +1,236 @@
+package flash_test
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/gentam/gice/board"
+	"github.com/gentam/gice/flash"
+	"github.com/gentam/gice/flash/flashtest"
+)
+
+// pattern returns n bytes of non-trivial content.
+func pattern(n int, seed byte) []byte {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = byte(i*7) ^ seed
+	}
+	return b
+}
+
+func TestUpdateRegions(t *testing.T) {
+	const n = 0x4000
+	zeros := make([]byte, n)
+	tests := []struct {
+		name    string
+		old     []byte // content of the first n bytes
+		regions []flash.Region
+		erased  int
+		counts  flashtest.Counts
+	}{
+		{
+			name:    "unchanged",
+			old:     pattern(n, 0),
+			regions: []flash.Region{{Addr: 0x1010, Data: pattern(n, 0)[0x1010:0x1110]}},
+		},
+		{
+			name:    "program erased bytes",
+			old:     bytes.Repeat([]byte{0xFF}, n),
+			regions: []flash.Region{{Addr: 0x1010, Data: pattern(0x100, 1)}},
+			counts:  flashtest.Counts{PagePrograms: 2},
+		},
+		{
+			name:    "only clear bits",
+			old:     bytes.Repeat([]byte{0xF0}, n),
+			regions: []flash.Region{{Addr: 0x2000, Data: make([]byte, 0x100)}},
+			counts:  flashtest.Counts{PagePrograms: 1},
+		},
+		{
+			name:    "set bits",
+			old:     zeros,
+			regions: []flash.Region{{Addr: 0x1010, Data: pattern(0x10, 2)}},
+			erased:  1,
+			counts:  flashtest.Counts{Erases4KB: 1, PagePrograms: 16},
+		},
+		{
+			name: "program and erase",
+			old:  append(zeros[:0x2000:0x2000], bytes.Repeat([]byte{0xFF}, n-0x2000)...),
+			regions: []flash.Region{
+				{Addr: 0x0FF0, Data: pattern(0x20, 3)},
+				{Addr: 0x3000, Data: pattern(0x10, 4)},
+			},
+			erased: 2,
+			counts: flashtest.Counts{Erases4KB: 2, PagePrograms: 33},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, chip := newFlash(t, flashtest.W25Q128)
+			chip.Load(0, tt.old)
+
+			erased, err := f.UpdateRegions(tt.regions)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if erased != tt.erased {
+				t.Errorf("erased %d subsectors, want %d", erased, tt.erased)
+			}
+			if got := chip.Counts(); got != tt.counts {
+				t.Errorf("counts = %+v, want %+v", got, tt.counts)
+			}
+			want := bytes.Clone(tt.old)
+			for _, r := range tt.regions {
+				copy(want[r.Addr:], r.Data)
+			}
+			if got := chip.Bytes()[:n]; !bytes.Equal(got, want) {
+				t.Errorf("flash content differs from the patched content")
+			}
+		})
+	}
+}
+
+func TestResumeRegions(t *testing.T) {
+	data := pattern(0x2800, 5)
+	tests := []struct {
+		name    string
+		written []byte // already written at 0x10000
+		done    int
+		counts  flashtest.Counts
+	}{
+		{"nothing written", nil, 0, flashtest.Counts{PagePrograms: 40}},
+		{"first subsector", data[:0x1000], 1, flashtest.Counts{PagePrograms: 24}},
+		{"interrupted in a page", data[:0x1080], 1, flashtest.Counts{PagePrograms: 24}},
+		{"all written", data, 3, flashtest.Counts{}},
+		{"stale data", append(bytes.Clone(data[:0x2000]), 0x00), 2, flashtest.Counts{Erases4KB: 1, PagePrograms: 8}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, chip := newFlash(t, flashtest.W25Q128)
+			chip.Load(0x10000, tt.written)
+
+			done, err := f.ResumeRegions([]flash.Region{{Addr: 0x10000, Data: data}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if done != tt.done {
+				t.Errorf("done = %d, want %d", done, tt.done)
+			}
+			if got := chip.Counts(); got != tt.counts {
+				t.Errorf("counts = %+v, want %+v", got, tt.counts)
+			}
+			if got := chip.Bytes()[0x10000 : 0x10000+len(data)]; !bytes.Equal(got, data) {
+				t.Errorf("flash content differs from the region")
+			}
+		})
+	}
+}
+
+func TestCheckWritable(t *testing.T) {
+	const size = 16 << 20
+	upper := flash.Protection{Start: size - 256<<10, End: size}
+	tests := []struct {
+		name       string
+		protection flash.Protection
+		reserved   []board.ReservedRange
+		regions    []flash.Region
+		err        error
+	}{
+		{
+			name:    "unprotected",
+			regions: []flash.Region{{Addr: 0, Data: make([]byte, 0x100)}},
+		},
+		{
+			name:    "too large",
+			regions: []flash.Region{{Addr: size - 0x100, Data: make([]byte, 0x101)}},
+			err:     flash.ErrTooLarge,
+		},
+		{
+			name:       "below the protected range",
+			protection: upper,
+			regions:    []flash.Region{{Addr: upper.Start - 0x1000, Data: make([]byte, 0x1000)}},
+		},
+		{
+			name:       "protected",
+			protection: upper,
+			regions:    []flash.Region{{Addr: upper.Start + 0x100, Data: make([]byte, 0x10)}},
+			err:        flash.ErrWriteProtected,
+		},
+		{
+			name:       "subsector shared with the protected range",
+			protection: upper,
+			regions:    []flash.Region{{Addr: upper.Start - 0x1000, Data: make([]byte, 0x1001)}},
+			err:        flash.ErrWriteProtected,
+		},
+		{
+			name:     "reserved",
+			reserved: []board.ReservedRange{{Name: "config", Start: 0x100000, End: 0x110000}},
+			regions:  []flash.Region{{Addr: 0x10F000, Data: make([]byte, 0x10)}},
+			err:      flash.ErrReserved,
+		},
+		{
+			name:     "subsector shared with a reserved range",
+			reserved: []board.ReservedRange{{Name: "config", Start: 0x100000, End: 0x100800}},
+			regions:  []flash.Region{{Addr: 0x100C00, Data: make([]byte, 0x10)}},
+			err:      flash.ErrReserved,
+		},
+		{
+			name:     "next to a reserved range",
+			reserved: []board.ReservedRange{{Name: "config", Start: 0x100000, End: 0x110000}},
+			regions:  []flash.Region{{Addr: 0x110000, Data: make([]byte, 0x10)}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, chip := newFlash(t, flashtest.W25Q128)
+			if err := f.SetProtection(tt.protection); err != nil {
+				t.Fatal(err)
+			}
+			f.Reserved = tt.reserved
+
+			err := f.CheckWritable(tt.regions)
+			if !errors.Is(err, tt.err) || (err == nil) != (tt.err == nil) {
+				t.Fatalf("CheckWritable = %v, want %v", err, tt.err)
+			}
+			if tt.err == nil {
+				return
+			}
+			// Writes setting bits are refused before anything is erased
+			chip.Load(0, make([]byte, size))
+			var regions []flash.Region
+			for _, r := range tt.regions {
+				regions = append(regions, flash.Region{Addr: r.Addr, Data: bytes.Repeat([]byte{0xFF}, len(r.Data))})
+			}
+			if _, err := f.UpdateRegions(regions); !errors.Is(err, tt.err) {
+				t.Errorf("UpdateRegions = %v, want %v", err, tt.err)
+			}
+			if got := chip.Counts(); got.Erases4KB != 0 || got.PagePrograms != 0 {
+				t.Errorf("counts = %+v, want no erase or program", got)
+			}
+		})
+	}
+}
+
+func FuzzCheckFits(f *testing.F) {
+	f.Add(0, uint16(0x100))
+	f.Add(16<<20-0x100, uint16(0x100))
+	f.Add(16<<20-0x100, uint16(0x101))
+	f.Add(-1, uint16(0x10)) // negative region address
+	f.Fuzz(func(t *testing.T, addr int, n uint16) {
+		fl := flash.NewFromTransport(&answers{id: flashtest.W25Q128.ID})
+		if _, _, err := fl.ReadID(); err != nil {
+			t.Fatal(err)
+		}
+		r := flash.Region{Addr: addr, Data: make([]byte, n)}
+		err := fl.CheckFits([]flash.Region{r})
+		if fits := addr >= 0 && addr+int(n) <= fl.Size(); fits != (err == nil) {
+			t.Fatalf("CheckFits(0x%X, %d bytes) = %v", addr, n, err)
+		}
+		if err != nil {
+			return
+		}
+		if err := fl.CheckWritable([]flash.Region{r}); err != nil {
+			t.Fatalf("CheckWritable(0x%X, %d bytes) = %v", addr, n, err)
+		}
+	})
+}
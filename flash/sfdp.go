@@ -0,0 +1,96 @@
+package flash
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// flashCmdReadSFDP reads the Serial Flash Discoverable Parameters. [JESD216]
+const flashCmdReadSFDP = 0x5A
+
+// SFDP is the header of the Serial Flash Discoverable Parameters.
+// [JESD216|6.2 SFDP Header]
+type SFDP struct {
+	Major, Minor int // SFDP revision
+	Params       []SFDPParam
+}
+
+// SFDPParam is a parameter header of the SFDP, pointing to a parameter table.
+// [JESD216|6.3 Parameter Header]
+type SFDPParam struct {
+	ID           uint16 // 0xFF00 for the basic flash parameter table
+	Major, Minor int
+	Addr         int // SFDP address of the table
+	Size         int // in bytes
+}
+
+// SFDPBasicParams is the ID of the JEDEC basic flash parameter table.
+const SFDPBasicParams = 0xFF00
+
+// ReadSFDP reads n bytes of the SFDP area from addr.
+func (f *Flash) ReadSFDP(addr, n int) ([]byte, error) {
+	const cmdBytes = 5 // command, 24-bit address and 8 dummy clocks
+	buf := make([]byte, cmdBytes+n)
+	buf[0] = flashCmdReadSFDP
+	buf[1] = byte(addr >> 16)
+	buf[2] = byte(addr >> 8)
+	buf[3] = byte(addr)
+	if err := f.txRead(buf, cmdBytes); err != nil {
+		return nil, err
+	}
+	return buf[cmdBytes:], nil
+}
+
+// ReadSFDPHeader reads the SFDP header and its parameter headers.
+func (f *Flash) ReadSFDPHeader() (SFDP, error) {
+	hdr, err := f.ReadSFDP(0, 8)
+	if err != nil {
+		return SFDP{}, err
+	}
+	if string(hdr[:4]) != "SFDP" {
+		return SFDP{}, errors.New("flash has no SFDP signature")
+	}
+	s := SFDP{Major: int(hdr[5]), Minor: int(hdr[4])}
+	n := int(hdr[6]) + 1
+	params, err := f.ReadSFDP(8, 8*n)
+	if err != nil {
+		return s, err
+	}
+	for i := range n {
+		p := params[8*i:]
+		s.Params = append(s.Params, SFDPParam{
+			ID:    uint16(p[7])<<8 | uint16(p[0]),
+			Major: int(p[2]),
+			Minor: int(p[1]),
+			Addr:  int(p[4]) | int(p[5])<<8 | int(p[6])<<16,
+			Size:  4 * int(p[3]),
+		})
+	}
+	return s, nil
+}
+
+// SFDPDensity returns the flash size in bytes from the basic flash parameter
+// table. [JESD216|6.4.5 JEDEC Basic Flash Parameter Table: 2nd DWORD]
+func (f *Flash) SFDPDensity(s SFDP) (int, error) {
+	for _, p := range s.Params {
+		if p.ID != SFDPBasicParams || p.Size < 8 {
+			continue
+		}
+		dw, err := f.ReadSFDP(p.Addr+4, 4)
+		if err != nil {
+			return 0, err
+		}
+		bits := binary.LittleEndian.Uint32(dw)
+		if bits&(1<<31) == 0 {
+			// Densities of less than a byte are invalid
+			if bits >= 7 {
+				return int(bits+1) / 8, nil
+			}
+		} else if n := bits &^ (1 << 31); n >= 3 && n < 34 {
+			return 1 << (n - 3), nil
+		}
+		return 0, fmt.Errorf("invalid SFDP density 0x%08X", bits)
+	}
+	return 0, errors.New("SFDP has no basic flash parameter table")
+}
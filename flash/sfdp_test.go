@@ -0,0 +1,40 @@
+package flash_test
+
+import (
+	"testing"
+
+	"github.com/gentam/gice/flash"
+	"github.com/gentam/gice/flash/flashtest"
+)
+
+func FuzzSFDP(f *testing.F) {
+	for _, m := range []flashtest.Model{flashtest.W25Q128, flashtest.N25Q32} {
+		fl, _ := newFlash(f, m)
+		table, err := fl.ReadSFDP(0, 0x100)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(table)
+	}
+	// Density of less than a byte
+	table := make([]byte, 0x40)
+	copy(table, "SFDP\x06\x01\x00\xFF\x00\x06\x01\x09\x30\x00\x00\xFF")
+	f.Add(table)
+	f.Add([]byte("SFDP"))
+	f.Add([]byte("SFDP\x06\x01\xFF\xFF"))
+	f.Fuzz(func(t *testing.T, table []byte) {
+		fl := flash.NewFromTransport(&answers{sfdp: table})
+		s, err := fl.ReadSFDPHeader()
+		if err != nil {
+			return
+		}
+		for _, p := range s.Params {
+			if p.Addr < 0 || p.Addr >= 1<<24 || p.Size < 0 {
+				t.Fatalf("parameter table %+v outside the SFDP area", p)
+			}
+		}
+		if n, err := fl.SFDPDensity(s); err == nil && n <= 0 {
+			t.Fatalf("density %d bytes", n)
+		}
+	})
+}
@@ -0,0 +1,27 @@
+package flash
+
+import "time"
+
+// Stats counts the operations of a Flash since it was created, to make slow
+// or flaky hardware visible.
+type Stats struct {
+	BytesRead       int
+	BytesProgrammed int
+	Erased4KB       int // subsectors erased
+	Erased64KB      int // sectors erased
+	ErasedChip      int // bulk erases
+
+	// BusyPolls counts the status register reads while waiting for a program
+	// or erase to finish, and BusyTimeouts the waits that ran out of time with
+	// ErrBusyTimeout.
+	BusyPolls    int
+	BusyTimeouts int
+
+	ReadTime, ProgramTime, EraseTime time.Duration
+}
+
+// BytesErased returns the number of bytes erased, counting a bulk erase as
+// size bytes.
+func (s Stats) BytesErased(size int) int {
+	return s.Erased4KB<<12 + s.Erased64KB<<16 + s.ErasedChip*size
+}
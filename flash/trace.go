@@ -0,0 +1,186 @@
+package flash
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"periph.io/x/conn/v3"
+	"periph.io/x/conn/v3/spi"
+)
+
+// LevelTrace is the level of the transaction events of LogConn, below
+// slog.LevelDebug so that debug logs are not flooded with them.
+const LevelTrace = slog.LevelDebug - 4
+
+// LogConn returns a connection emitting every transaction of c to l at
+// LevelTrace, with the decoded flash command, address, lengths, duration and
+// the first bytes of data as attributes.
+func LogConn(c spi.Conn, l *slog.Logger) spi.Conn {
+	return &logConn{Conn: c, log: l}
+}
+
+// TraceConn returns a connection logging every transaction of c to w, one line
+// each with the decoded flash command, address, lengths, duration and the
+// first bytes of data. It is LogConn with a handler writing those lines.
+func TraceConn(c spi.Conn, w io.Writer) spi.Conn {
+	return LogConn(c, slog.New(&traceHandler{w: w, mu: &sync.Mutex{}}))
+}
+
+// flashCmdTrace names the flash commands in traces, and tells whether they are
+// followed by a 24-bit address and whether their data is written rather than
+// read.
+var flashCmdTrace = map[byte]struct {
+	name      string
+	addr, out bool
+}{
+	flashCmdPowerUp:                {"POWER_UP", false, false},
+	flashCmdPowerDown:              {"POWER_DOWN", false, false},
+	flashCmdReadID:                 {"READ_ID", false, false},
+	flashCmdRead:                   {"READ", true, false},
+	flashCmdWriteEnable:            {"WRITE_ENABLE", false, false},
+	flashCmdPageProgram:            {"PAGE_PROGRAM", true, true},
+	flashCmdErase4KB:               {"ERASE_4KB", true, false},
+	flashCmdErase64KB:              {"ERASE_64KB", true, false},
+	flashCmdEraseChip:              {"ERASE_CHIP", false, false},
+	flashCmdReadStatusRegister:     {"READ_SR", false, false},
+	flashCmdReadStatusRegister2:    {"READ_SR2", false, false},
+	flashCmdReadStatusRegister3:    {"READ_SR3", false, false},
+	flashCmdReadFlagStatusRegister: {"READ_FLAG_SR", false, false},
+	flashCmdWriteStatusRegister:    {"WRITE_SR", false, true},
+	flashCmdWriteStatusRegister2:   {"WRITE_SR2", false, true},
+	flashCmdReadOTP:                {"READ_OTP", true, false},
+	flashCmdProgramOTP:             {"PROGRAM_OTP", true, true},
+	flashCmdReadSecurityRegs:       {"READ_SECURITY", true, false},
+	flashCmdReadSFDP:               {"READ_SFDP", true, false},
+}
+
+// traceBytes is the number of data bytes shown in traces.
+const traceBytes = 16
+
+// logConn is a spi.Conn logging the transactions of another one. Dummy
+// clocks and SRAM configuration data are decoded like commands, as the
+// connection does not know the state of chip select.
+type logConn struct {
+	spi.Conn
+	log *slog.Logger
+}
+
+func (t *logConn) Tx(w, r []byte) error {
+	if !t.log.Enabled(context.Background(), LevelTrace) {
+		return t.Conn.Tx(w, r)
+	}
+	// Full-duplex transfers overwrite w with what they read
+	sent := append([]byte(nil), w[:min(len(w), 4+traceBytes)]...)
+	start := time.Now()
+	err := t.Conn.Tx(w, r)
+	elapsed := time.Since(start)
+
+	attrs := []slog.Attr{slog.Duration("duration", elapsed.Round(time.Microsecond))}
+	data, hdr := sent, 0
+	in, out := true, true // which data is shown
+	if len(sent) > 0 {
+		cmd, ok := flashCmdTrace[sent[0]]
+		if ok && len(r) == len(w) {
+			// Full-duplex transfers shift dummy bytes out while reading and
+			// garbage in while writing
+			in, out = !cmd.out, cmd.out
+		}
+		if !ok {
+			cmd.name = fmt.Sprintf("0x%02X", sent[0])
+		}
+		attrs = append(attrs, slog.String("cmd", cmd.name))
+		hdr = 1
+		if cmd.addr && len(sent) >= 4 {
+			attrs = append(attrs, slog.String("addr", fmt.Sprintf("0x%06X", int(sent[1])<<16|int(sent[2])<<8|int(sent[3]))))
+			hdr = 4
+		}
+		data = sent[hdr:]
+	}
+	attrs = append(attrs, slog.Int("w", len(w)))
+	if out && len(data) > 0 {
+		attrs = append(attrs, slog.String("out", fmt.Sprintf("% x", data[:min(len(data), traceBytes)])))
+	}
+	if len(r) == len(w) {
+		// What was read while sending the command is meaningless
+		r = r[min(hdr, len(r)):]
+	}
+	if in && len(r) > 0 {
+		attrs = append(attrs, slog.Int("r", len(r)), slog.String("in", fmt.Sprintf("% x", r[:min(len(r), traceBytes)])))
+	}
+	if err != nil {
+		attrs = append(attrs, slog.String("err", err.Error()))
+	}
+	r0 := slog.NewRecord(start, LevelTrace, "spi", 0)
+	r0.AddAttrs(attrs...)
+	t.log.Handler().Handle(context.Background(), r0)
+	return err
+}
+
+func (t *logConn) TxPackets(p []spi.Packet) error {
+	for _, pkt := range p {
+		if err := t.Tx(pkt.W, pkt.R); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MaxTxSize implements conn.Limits.
+func (t *logConn) MaxTxSize() int {
+	if l, ok := t.Conn.(conn.Limits); ok {
+		return l.MaxTxSize()
+	}
+	return 0
+}
+
+// traceHandler is a slog.Handler writing the lines of TraceConn: the time and
+// message, the duration and command bare, the data in brackets, and the other
+// attributes as key=value.
+type traceHandler struct {
+	w     io.Writer
+	mu    *sync.Mutex // shared by the handlers derived with WithAttrs
+	attrs []slog.Attr
+}
+
+func (h *traceHandler) Enabled(context.Context, slog.Level) bool { return true }
+
+func (h *traceHandler) Handle(_ context.Context, r slog.Record) error {
+	s := strings.Builder{}
+	fmt.Fprintf(&s, "%s %s", r.Time.Format("15:04:05.000000"), r.Message)
+	write := func(a slog.Attr) bool {
+		switch a.Key {
+		case "duration", "cmd":
+			fmt.Fprintf(&s, " %s", a.Value)
+		case "out", "in":
+			fmt.Fprintf(&s, " [%s]", a.Value)
+		case "err":
+			fmt.Fprintf(&s, " err=%q", a.Value)
+		default:
+			fmt.Fprintf(&s, " %s=%s", a.Key, a.Value)
+		}
+		return true
+	}
+	for _, a := range h.attrs {
+		write(a)
+	}
+	r.Attrs(write)
+	s.WriteByte('\n')
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err := io.WriteString(h.w, s.String())
+	return err
+}
+
+func (h *traceHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &traceHandler{w: h.w, mu: h.mu, attrs: append(slices.Clip(h.attrs), attrs...)}
+}
+
+// WithGroup is not supported; the attributes of groups are written flat.
+func (h *traceHandler) WithGroup(string) slog.Handler { return h }
@@ -0,0 +1,57 @@
+package flash
+
+import (
+	"periph.io/x/conn/v3"
+	"periph.io/x/conn/v3/gpio"
+	"periph.io/x/conn/v3/spi"
+)
+
+// Transport carries the commands of a Flash to the chip.
+type Transport interface {
+	// Tx sends the first n bytes of buf and reads the response into the rest,
+	// within a single chip select.
+	Tx(buf []byte, n int) error
+
+	// MaxTxSize returns the maximum size of a command with its response, or
+	// 0 if there is no limit.
+	MaxTxSize() int
+}
+
+// SPITransport returns the transport of commands over the SPI connection c.
+// Chip select is driven through cs around each command, or left to the
+// connection if cs is nil.
+func SPITransport(c spi.Conn, cs gpio.PinIO) Transport {
+	return &spiTransport{conn: c, cs: cs}
+}
+
+type spiTransport struct {
+	conn spi.Conn
+	cs   gpio.PinIO
+}
+
+// Tx implements Transport. Full-duplex connections shift the whole buffer, so
+// buf[n:] must hold the dummy bytes to send.
+func (t *spiTransport) Tx(buf []byte, n int) (err error) {
+	if t.cs != nil {
+		if err = t.cs.Out(gpio.Low); err != nil {
+			return err
+		}
+		defer func() {
+			if csErr := t.cs.Out(gpio.High); csErr != nil && err == nil {
+				err = csErr
+			}
+		}()
+	}
+	if t.conn.Duplex() == conn.Half {
+		return t.conn.Tx(buf[:n], buf[n:])
+	}
+	return t.conn.Tx(buf, buf)
+}
+
+// MaxTxSize implements Transport with the conn.Limits of the connection.
+func (t *spiTransport) MaxTxSize() int {
+	if l, ok := t.conn.(conn.Limits); ok {
+		return l.MaxTxSize()
+	}
+	return 0
+}
@@ -0,0 +1,35 @@
+package flash
+
+import "fmt"
+
+// flashCmdReadUniqueID reads the factory-programmed unique ID of Winbond
+// flash chips; Micron chips have the READ OTP ARRAY command at the same code.
+// [W25Q128|8.2.40 Read Unique ID Number (4Bh)]
+const flashCmdReadUniqueID = 0x4B
+
+// UniqueID returns the factory-programmed unique ID of the flash identified
+// by ReadID, telling apart chips of the same model:
+//   - Winbond: the 64-bit unique ID number.
+//   - Micron: the 16 bytes of extended device ID and customized factory data
+//     following the JEDEC ID [N25Q32|READ ID].
+func (f *Flash) UniqueID() ([]byte, error) {
+	switch f.statusLayout() {
+	case statusWinbond:
+		const cmdBytes = 5 // command and 4 dummy bytes
+		buf := make([]byte, cmdBytes+8)
+		buf[0] = flashCmdReadUniqueID
+		if err := f.txRead(buf, cmdBytes); err != nil {
+			return nil, err
+		}
+		return buf[cmdBytes:], nil
+	case statusMicron:
+		const cmdBytes = 5 // command, JEDEC ID and the length of the rest
+		buf := make([]byte, cmdBytes+16)
+		buf[0] = flashCmdReadID
+		if err := f.txRead(buf, 1); err != nil {
+			return nil, err
+		}
+		return buf[cmdBytes:], nil
+	}
+	return nil, fmt.Errorf("%w: unique ID not known", ErrUnknownFlash)
+}
@@ -0,0 +1,167 @@
+package flash
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"periph.io/x/conn/v3"
+	"periph.io/x/conn/v3/physic"
+	"periph.io/x/conn/v3/spi"
+)
+
+// VCDWriter writes SPI transactions as a Value Change Dump of the CS, SCK,
+// MOSI and MISO signals in SPI mode 0, so that the traffic can be analyzed like
+// a logic analyzer capture, e.g. in PulseView with the SPI and SPI flash
+// decoders. Like the transactions of LogConn, each one is placed at the time
+// it started, with chip select asserted around it; its bits are clocked at the
+// frequency of the writer. Half-duplex transactions shift the bytes read after
+// the bytes written, with MOSI low. Every bit takes a few lines: dumps of large
+// reads are large.
+type VCDWriter struct {
+	half time.Duration // of the clock period
+
+	mu     sync.Mutex
+	w      *bufio.Writer
+	start  time.Time     // of the first transaction, time 0
+	end    time.Duration // of the last transaction
+	values [4]byte       // last dumped value of each signal
+}
+
+// NewVCDWriter returns a writer of the transactions clocked at clock to w.
+func NewVCDWriter(w io.Writer, clock physic.Frequency) *VCDWriter {
+	half := max(time.Duration(clock.Period())/2, time.Nanosecond)
+	return &VCDWriter{w: bufio.NewWriter(w), half: half}
+}
+
+// Conn returns a connection writing every transaction of c to the dump. The
+// connections of a writer share its timeline, e.g. when c is reopened.
+func (v *VCDWriter) Conn(c spi.Conn) spi.Conn {
+	return &vcdConn{Conn: c, v: v}
+}
+
+// VCD identifiers of the signals.
+const (
+	vcdCS   = '!'
+	vcdSCK  = '"'
+	vcdMOSI = '#'
+	vcdMISO = '$'
+)
+
+type vcdConn struct {
+	spi.Conn
+	v *VCDWriter
+}
+
+func (c *vcdConn) Tx(w, r []byte) error {
+	// Full-duplex transfers overwrite w with what they read
+	sent := bytes.Clone(w)
+	start := time.Now()
+	err := c.Conn.Tx(w, r)
+
+	mosi, miso := sent, r
+	if c.Conn.Duplex() == conn.Half {
+		mosi = append(sent, make([]byte, len(r))...)
+		miso = append(bytes.Repeat([]byte{0xFF}, len(sent)), r...)
+	}
+	if wErr := c.v.transaction(start, mosi, miso); wErr != nil && err == nil {
+		err = wErr
+	}
+	return err
+}
+
+func (c *vcdConn) TxPackets(p []spi.Packet) error {
+	for _, pkt := range p {
+		if err := c.Tx(pkt.W, pkt.R); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MaxTxSize implements conn.Limits.
+func (c *vcdConn) MaxTxSize() int {
+	if l, ok := c.Conn.(conn.Limits); ok {
+		return l.MaxTxSize()
+	}
+	return 0
+}
+
+// Close ends the dump a clock period after the last transaction, so that
+// viewers show the bus idle after it, and flushes it. The writer of the dump is
+// not closed.
+func (v *VCDWriter) Close() error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.start.IsZero() {
+		v.start = time.Now()
+		v.header()
+	}
+	v.end += 2 * v.half
+	fmt.Fprintf(v.w, "#%d\n", v.end.Nanoseconds())
+	return v.w.Flush()
+}
+
+// header writes the declarations and the initial, idle values.
+func (v *VCDWriter) header() {
+	fmt.Fprintf(v.w, "$date %s $end\n", v.start.Format(time.RFC3339))
+	fmt.Fprintf(v.w, "$version gice $end\n$timescale 1ns $end\n$scope module spi $end\n")
+	for _, sig := range []struct {
+		id   byte
+		name string
+	}{{vcdCS, "cs"}, {vcdSCK, "sck"}, {vcdMOSI, "mosi"}, {vcdMISO, "miso"}} {
+		fmt.Fprintf(v.w, "$var wire 1 %c %s $end\n", sig.id, sig.name)
+	}
+	fmt.Fprintf(v.w, "$upscope $end\n$enddefinitions $end\n#0\n$dumpvars\n1%c\n0%c\n0%c\n1%c\n$end\n", vcdCS, vcdSCK, vcdMOSI, vcdMISO)
+	v.values = [4]byte{'1', '0', '0', '1'}
+}
+
+// transaction dumps the bits of mosi and miso shifted by a transaction that
+// started at start, after the previous one: chip select falls half a clock
+// period before the first rising edge of SCK and rises half a period after its
+// last falling edge.
+func (v *VCDWriter) transaction(start time.Time, mosi, miso []byte) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.start.IsZero() {
+		v.start = start
+		v.header()
+	}
+	t := max(start.Sub(v.start), v.end+2*v.half)
+	fmt.Fprintf(v.w, "#%d\n", t.Nanoseconds())
+	v.set(vcdCS, 0)
+	for i := range max(len(mosi), len(miso)) {
+		for bit := 7; bit >= 0; bit-- {
+			if i < len(mosi) {
+				v.set(vcdMOSI, mosi[i]>>bit&1)
+			}
+			if i < len(miso) {
+				v.set(vcdMISO, miso[i]>>bit&1)
+			}
+			t += v.half
+			fmt.Fprintf(v.w, "#%d\n", t.Nanoseconds())
+			v.set(vcdSCK, 1)
+			t += v.half
+			fmt.Fprintf(v.w, "#%d\n", t.Nanoseconds())
+			v.set(vcdSCK, 0)
+		}
+	}
+	t += v.half
+	fmt.Fprintf(v.w, "#%d\n", t.Nanoseconds())
+	v.set(vcdCS, 1)
+	v.end = t
+	return v.w.Flush()
+}
+
+// set dumps the value of the signal if it changed.
+func (v *VCDWriter) set(id byte, bit byte) {
+	s := &v.values[id-vcdCS]
+	if *s == '0'+bit {
+		return
+	}
+	*s = '0' + bit
+	fmt.Fprintf(v.w, "%c%c\n", *s, id)
+}
@@ -0,0 +1,140 @@
+package flash_test
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gentam/gice/flash"
+	"github.com/gentam/gice/flash/flashtest"
+	"periph.io/x/conn/v3"
+	"periph.io/x/conn/v3/physic"
+)
+
+// vcdTx is a transaction decoded from a VCD capture.
+type vcdTx struct {
+	mosi, miso []byte
+	start, end int64 // ns
+}
+
+// decodeVCD samples MOSI and MISO on the rising edges of SCK while chip select
+// is low, checking that time never goes back.
+func decodeVCD(t *testing.T, vcd string) []vcdTx {
+	t.Helper()
+	ids := map[string]string{}
+	level := map[string]byte{}
+	var txs []vcdTx
+	var cur *vcdTx
+	var bits int
+	now := int64(-1)
+	s := bufio.NewScanner(strings.NewReader(vcd))
+	for s.Scan() {
+		line := s.Text()
+		switch {
+		case strings.HasPrefix(line, "$var "):
+			f := strings.Fields(line)
+			ids[f[3]] = f[4]
+		case strings.HasPrefix(line, "#"):
+			n, err := strconv.ParseInt(line[1:], 10, 64)
+			if err != nil || n <= now {
+				t.Fatalf("time %q after %d", line, now)
+			}
+			now = n
+		case len(line) == 2 && (line[0] == '0' || line[0] == '1'):
+			name, v := ids[line[1:]], line[0]-'0'
+			if name == "" {
+				t.Fatalf("value of undeclared signal %q", line)
+			}
+			level[name] = v
+			switch {
+			case name == "cs" && v == 0:
+				txs = append(txs, vcdTx{start: now})
+				cur, bits = &txs[len(txs)-1], 0
+			case name == "cs" && v == 1 && cur != nil:
+				if bits%8 != 0 {
+					t.Fatalf("transaction of %d bits", bits)
+				}
+				cur.end, cur = now, nil
+			case name == "sck" && v == 1 && cur != nil:
+				if bits%8 == 0 {
+					cur.mosi, cur.miso = append(cur.mosi, 0), append(cur.miso, 0)
+				}
+				i := len(cur.mosi) - 1
+				cur.mosi[i] = cur.mosi[i]<<1 | level["mosi"]
+				cur.miso[i] = cur.miso[i]<<1 | level["miso"]
+				bits++
+			}
+		}
+	}
+	return txs
+}
+
+// halfDuplex is a half-duplex connection to a chip.
+type halfDuplex struct{ *flashtest.Chip }
+
+func (c halfDuplex) Duplex() conn.Duplex { return conn.Half }
+
+func (c halfDuplex) Tx(w, r []byte) error {
+	buf := append(bytes.Clone(w), make([]byte, len(r))...)
+	if err := c.Chip.Tx(buf, buf); err != nil {
+		return err
+	}
+	copy(r, buf[len(w):])
+	return nil
+}
+
+func TestVCDConn(t *testing.T) {
+	for _, half := range []bool{false, true} {
+		name := "full duplex"
+		if half {
+			name = "half duplex"
+		}
+		t.Run(name, func(t *testing.T) {
+			chip := flashtest.New(flashtest.W25Q128)
+			chip.Load(0x100, []byte{0xA5, 0x3C})
+			var out bytes.Buffer
+			v := flash.NewVCDWriter(&out, physic.MegaHertz)
+			c := v.Conn(chip)
+			if half {
+				c = v.Conn(halfDuplex{chip})
+			}
+			f := flash.New(c, nil)
+			if _, _, err := f.ReadID(); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := f.Read(0x100, 2); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := v.Close(); err != nil {
+				t.Fatal(err)
+			}
+			txs := decodeVCD(t, out.String())
+			id := flashtest.W25Q128.ID
+			want := []vcdTx{
+				{mosi: []byte{0x9F, 0, 0, 0}, miso: []byte{0xFF, id[0], id[1], id[2]}},
+				{mosi: []byte{0x03, 0x00, 0x01, 0x00, 0, 0}, miso: []byte{0xFF, 0xFF, 0xFF, 0xFF, 0xA5, 0x3C}},
+			}
+			if len(txs) != len(want) {
+				t.Fatalf("decoded %d transactions, want %d", len(txs), len(want))
+			}
+			for i, tx := range txs {
+				if !bytes.Equal(tx.mosi, want[i].mosi) || !bytes.Equal(tx.miso, want[i].miso) {
+					t.Errorf("transaction %d: MOSI [% x] MISO [% x], want [% x] [% x]", i, tx.mosi, tx.miso, want[i].mosi, want[i].miso)
+				}
+				// 1µs per bit, and chip select rising half a period after
+				// the last falling edge
+				if d, bits := tx.end-tx.start, int64(8*len(tx.mosi)); d != bits*1000+500 {
+					t.Errorf("transaction %d lasts %dns for %d bits at 1MHz", i, d, bits)
+				}
+			}
+			// The dump ends a period after the last transaction
+			if last := fmt.Sprintf("#%d\n", txs[len(txs)-1].end+1000); !strings.HasSuffix(out.String(), last) {
+				t.Errorf("dump ends with %q, want %q", out.String()[max(out.Len()-20, 0):], last)
+			}
+		})
+	}
+}
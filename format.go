@@ -0,0 +1,105 @@
+package gice
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/gentam/gice/bitstream"
+)
+
+// Format is the file format of an image.
+type Format string
+
+const (
+	FormatAuto   Format = "auto"
+	FormatBin    Format = "bin"  // raw binary, e.g. a bitstream
+	FormatHex    Format = "hex"  // Intel HEX
+	FormatSREC   Format = "srec" // Motorola S-record
+	FormatGzip   Format = "gz"   // gzip-compressed image of any other format
+	FormatUF2    Format = "uf2"
+	FormatASCII  Format = "asc"    // textual bitstream from nextpnr/icebox
+	FormatBackup Format = "backup" // flash dump written by WriteBackup
+)
+
+// Formats lists the formats accepted by DecodeImage.
+var Formats = []Format{FormatAuto, FormatBin, FormatHex, FormatSREC, FormatGzip, FormatUF2, FormatASCII, FormatBackup}
+
+// DetectFormat guesses the format of data from its content.
+func DetectFormat(data []byte) Format {
+	text := bytes.TrimLeft(data, " \t\r\n")
+	switch {
+	case bytes.HasPrefix(data, []byte{0x1F, 0x8B}):
+		return FormatGzip
+	case IsBackup(data):
+		return FormatBackup
+	case IsUF2(data):
+		return FormatUF2
+	case len(text) > 0 && text[0] == ':' && isHexText(text[1:min(len(text), 64)]):
+		return FormatHex
+	case len(text) > 1 && text[0] == 'S' && text[1] >= '0' && text[1] <= '9' && isHexText(text[2:min(len(text), 64)]):
+		return FormatSREC
+	case bytes.HasPrefix(text, []byte(".comment")) || bytes.HasPrefix(text, []byte(".device")):
+		return FormatASCII
+	}
+	return FormatBin
+}
+
+// isHexText reports whether b holds only hex digits up to the end of the line.
+func isHexText(b []byte) bool {
+	if line, _, ok := bytes.Cut(b, []byte{'\n'}); ok {
+		b = bytes.TrimRight(line, "\r")
+	}
+	for _, c := range b {
+		if strings.IndexByte("0123456789abcdefABCDEF", c) < 0 {
+			return false
+		}
+	}
+	return len(b) > 0
+}
+
+// DecodeImage converts data in the given format into the regions to program.
+// Binary, bitstream, and ASCII input is placed at address 0; the other formats
+// carry their own addresses. UF2 blocks are filtered by uf2Family unless it is
+// zero.
+func DecodeImage(data []byte, format Format, uf2Family uint32) ([]Region, error) {
+	if format == FormatAuto || format == "" {
+		format = DetectFormat(data)
+	}
+	switch format {
+	case FormatBin:
+		return []Region{{Addr: 0, Data: data}}, nil
+	case FormatHex:
+		return ParseIntelHex(data)
+	case FormatSREC:
+		return ParseSREC(data)
+	case FormatUF2:
+		return ParseUF2(data, uf2Family)
+	case FormatASCII:
+		bin := bytes.Buffer{}
+		p := bitstream.Packer{}
+		if err := p.Pack(&bin, bytes.NewReader(data)); err != nil {
+			return nil, fmt.Errorf("pack: %w", err)
+		}
+		return []Region{{Addr: 0, Data: bin.Bytes()}}, nil
+	case FormatBackup:
+		_, content, err := ReadBackup(data)
+		if err != nil {
+			return nil, err
+		}
+		return []Region{{Addr: 0, Data: content}}, nil
+	case FormatGzip:
+		zr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		inner, err := io.ReadAll(zr)
+		if err != nil {
+			return nil, fmt.Errorf("gunzip: %w", err)
+		}
+		return DecodeImage(inner, FormatAuto, uf2Family)
+	}
+	return nil, fmt.Errorf("unknown format %q", format)
+}
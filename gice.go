@@ -0,0 +1,47 @@
+package gice
+
+import (
+	"github.com/gentam/gice/board"
+	"github.com/gentam/gice/flash"
+	"github.com/gentam/gice/transport"
+	"periph.io/x/conn/v3/gpio"
+	"periph.io/x/conn/v3/spi"
+)
+
+// Types of the flash, board and transport packages that appear in the Device
+// API, so that programs driving a Device only need to import gice.
+type (
+	Flash         = flash.Flash
+	FlashOption   = flash.Option
+	Region        = flash.Region
+	VerifyError   = flash.VerifyError
+	Board         = board.Board
+	ReservedRange = board.ReservedRange
+	Pin           = board.Pin
+	Channel       = board.Channel
+	SPIDevPins    = transport.SPIDevPins
+	BitbangPins   = transport.BitbangPins
+)
+
+// Errors of the flash package returned by the Device API, for errors.Is.
+var (
+	ErrUnknownFlash    = flash.ErrUnknownFlash
+	ErrWriteProtected  = flash.ErrWriteProtected
+	ErrStatusProtected = flash.ErrStatusProtected
+	ErrReserved        = flash.ErrReserved
+	ErrVerifyMismatch  = flash.ErrVerifyMismatch
+	ErrBusyTimeout     = flash.ErrBusyTimeout
+)
+
+const (
+	ChannelA    = board.ChannelA
+	ChannelB    = board.ChannelB
+	SignalPower = board.SignalPower
+)
+
+// NewFlashConn returns the flash attached to the SPI connection c of any
+// periph.io bus, for programs that drive the flash without a Device, e.g. over
+// the SPI controller of a Raspberry Pi. See flash.New.
+func NewFlashConn(c spi.Conn, cs gpio.PinIO, opts ...FlashOption) *Flash {
+	return flash.New(c, cs, opts...)
+}
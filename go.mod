@@ -4,7 +4,6 @@ go 1.25
 
 require (
 	periph.io/x/conn/v3 v3.7.2
+	periph.io/x/d2xx v0.1.1
 	periph.io/x/host/v3 v3.8.5
 )
-
-require periph.io/x/d2xx v0.1.1 // indirect
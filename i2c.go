@@ -0,0 +1,23 @@
+package gice
+
+import (
+	"periph.io/x/conn/v3/gpio"
+	"periph.io/x/conn/v3/i2c"
+)
+
+// NewI2C finds the FT2232H like NewDevice and opens an I²C bus on the selected
+// channel instead of SPI: ADBUS0 is SCL, and ADBUS1 and ADBUS2 must be tied
+// together as SDA. The MPSSE runs with three-phase data clocking so that data
+// is valid on both clock edges. [FTDI-AN_108]
+//
+// Only the FTDI options such as WithSerial and WithChannel apply.
+func NewI2C(opts ...Option) (i2c.BusCloser, error) {
+	d, err := newDevice(opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := d.findFT2232H(); err != nil {
+		return nil, err
+	}
+	return d.FTDI.I2C(gpio.PullUp)
+}
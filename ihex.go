@@ -0,0 +1,112 @@
+package gice
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/gentam/gice/flash"
+)
+
+// Intel HEX record types.
+const (
+	ihexData                   = 0x00
+	ihexEOF                    = 0x01
+	ihexExtendedSegmentAddress = 0x02
+	ihexStartSegmentAddress    = 0x03
+	ihexExtendedLinearAddress  = 0x04
+	ihexStartLinearAddress     = 0x05
+)
+
+// ParseIntelHex decodes Intel HEX text into regions, merging contiguous data
+// records.
+func ParseIntelHex(data []byte) ([]Region, error) {
+	regions := []Region{}
+	base := 0
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		if line[0] != ':' {
+			return nil, fmt.Errorf("line %d: missing start code", lineNo)
+		}
+		rec := make([]byte, hex.DecodedLen(len(line)-1))
+		if _, err := hex.Decode(rec, line[1:]); err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNo, err)
+		}
+		if len(rec) < 5 || len(rec) != 5+int(rec[0]) {
+			return nil, fmt.Errorf("line %d: invalid record length", lineNo)
+		}
+		sum := byte(0)
+		for _, b := range rec {
+			sum += b
+		}
+		if sum != 0 {
+			return nil, fmt.Errorf("line %d: checksum mismatch", lineNo)
+		}
+
+		offset := int(rec[1])<<8 | int(rec[2])
+		payload := rec[4 : len(rec)-1]
+		switch rec[3] {
+		case ihexData:
+			regions = flash.AppendRegion(regions, base+offset, payload)
+		case ihexEOF:
+			return regions, nil
+		case ihexExtendedSegmentAddress:
+			if len(payload) != 2 {
+				return nil, fmt.Errorf("line %d: invalid extended segment address", lineNo)
+			}
+			base = (int(payload[0])<<8 | int(payload[1])) << 4
+		case ihexExtendedLinearAddress:
+			if len(payload) != 2 {
+				return nil, fmt.Errorf("line %d: invalid extended linear address", lineNo)
+			}
+			base = (int(payload[0])<<8 | int(payload[1])) << 16
+		case ihexStartSegmentAddress, ihexStartLinearAddress:
+			// entry point; irrelevant for flash
+		default:
+			return nil, fmt.Errorf("line %d: unknown record type %02X", lineNo, rec[3])
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, errors.New("missing end of file record")
+}
+
+// WriteIntelHex encodes data to be placed at addr as Intel HEX with 16-byte
+// data records, emitting an extended linear address record whenever the upper
+// 16 bits of the address change.
+func WriteIntelHex(w io.Writer, addr int, data []byte) error {
+	const recordSize = 16
+	bw := bufio.NewWriter(w)
+	base := 0
+	for off := 0; off < len(data); {
+		a := addr + off
+		if a>>16 != base {
+			base = a >> 16
+			writeIntelHexRecord(bw, 0, ihexExtendedLinearAddress, []byte{byte(base >> 8), byte(base)})
+		}
+		// Records must not cross a 64KB boundary
+		n := min(recordSize, len(data)-off, 0x10000-a&0xFFFF)
+		writeIntelHexRecord(bw, a&0xFFFF, ihexData, data[off:off+n])
+		off += n
+	}
+	writeIntelHexRecord(bw, 0, ihexEOF, nil)
+	return bw.Flush()
+}
+
+func writeIntelHexRecord(w *bufio.Writer, offset int, typ byte, payload []byte) {
+	rec := append([]byte{byte(len(payload)), byte(offset >> 8), byte(offset), typ}, payload...)
+	sum := byte(0)
+	for _, b := range rec {
+		sum += b
+	}
+	rec = append(rec, -sum)
+	fmt.Fprintf(w, ":%X\n", rec)
+}
@@ -0,0 +1,51 @@
+package gice
+
+import (
+	"bytes"
+	"testing"
+)
+
+// checkRegions fails if a decoded region lies outside the 32-bit address
+// space, or does not encode back to itself with write and decode.
+func checkRegions(t *testing.T, regions []Region, write func(r Region) ([]byte, error), decode func([]byte) ([]Region, error)) {
+	t.Helper()
+	for _, r := range regions {
+		if r.Addr < 0 || r.Addr+len(r.Data) > 1<<32 {
+			t.Fatalf("region 0x%X of %d bytes outside the address space", r.Addr, len(r.Data))
+		}
+		if len(r.Data) == 0 {
+			continue
+		}
+		enc, err := write(r)
+		if err != nil {
+			t.Fatalf("encode region 0x%X: %v", r.Addr, err)
+		}
+		got, err := decode(enc)
+		if err != nil {
+			t.Fatalf("decode region 0x%X: %v", r.Addr, err)
+		}
+		if len(got) != 1 || got[0].Addr != r.Addr || !bytes.Equal(got[0].Data, r.Data) {
+			t.Fatalf("region 0x%X of %d bytes decoded back as %d regions", r.Addr, len(r.Data), len(got))
+		}
+	}
+}
+
+func FuzzParseIntelHex(f *testing.F) {
+	var buf bytes.Buffer
+	WriteIntelHex(&buf, 0xFFF8, []byte("across a 64KB boundary"))
+	f.Add(buf.Bytes())
+	f.Add([]byte(":020000021000EC\n:0100000055AA\n:00000001FF\n"))
+	f.Add([]byte(":00000001FF\n"))
+	f.Add([]byte(":0\n"))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		regions, err := ParseIntelHex(data)
+		if err != nil {
+			return
+		}
+		checkRegions(t, regions, func(r Region) ([]byte, error) {
+			var buf bytes.Buffer
+			err := WriteIntelHex(&buf, r.Addr, r.Data)
+			return buf.Bytes(), err
+		}, ParseIntelHex)
+	})
+}
@@ -0,0 +1,19 @@
+package gice
+
+import "bytes"
+
+// PadImage returns img padded with 0xFF up to a multiple of align bytes, e.g.
+// the erase sector size. Padding is blank flash content, so programming it
+// costs nothing as blank pages are skipped.
+func PadImage(img []byte, align int) []byte {
+	if align <= 0 || len(img)%align == 0 {
+		return img
+	}
+	return append(img, bytes.Repeat([]byte{0xFF}, align-len(img)%align)...)
+}
+
+// TrimImage returns img without its trailing 0xFF bytes, which are already
+// the content of erased flash.
+func TrimImage(img []byte) []byte {
+	return bytes.TrimRight(img, "\xFF")
+}
@@ -0,0 +1,86 @@
+package gice
+
+import (
+	"errors"
+	"time"
+
+	"periph.io/x/conn/v3"
+	"periph.io/x/conn/v3/gpio"
+)
+
+// [Lattice-TN1248|SPI Slave Configuration Process] timing
+const (
+	// Time for the FPGA to clear its configuration memory after CRESET_B is
+	// released, before it accepts the bitstream
+	tCRSCK = 1200 * time.Microsecond
+
+	// The FPGA asserts CDONE within 100 SPI clocks after the last bitstream
+	// byte.
+	cdoneClocks = 100
+)
+
+var errNoSlaveCS = errors.New("SRAM configuration requires a full-duplex programmer driving chip select")
+
+// ProgramSRAM configures the FPGA directly with the bitstream in SPI slave
+// mode, without touching the bitstream in flash. Chip select is held low while
+// the reset is released so that the FPGA selects slave mode, and the flash is
+// put into deep power-down first so that it ignores the transfer. Call
+// FinishConfiguration to wait for CDONE and start the design; the reported
+// time includes the transfer. The configuration is lost on the next reset or
+// power cycle. Flash commands of other goroutines wait for the transfer to
+// complete.
+func (d *Device) ProgramSRAM(bitstream []byte) error {
+	if d.reset == nil {
+		return errNoReset
+	}
+	if d.cs == nil || d.conn.Duplex() != conn.Full {
+		return errNoSlaveCS
+	}
+
+	d.debug("program SRAM", "size", len(bitstream))
+	if err := d.HoldFPGAReset(); err != nil {
+		return err
+	}
+	if err := d.Flash.Suspend(); err != nil {
+		return err
+	}
+	defer d.Flash.Resume()
+	if err := d.cs.Out(gpio.Low); err != nil {
+		return err
+	}
+	time.Sleep(tCRESETLow)
+	if err := d.releaseReset(); err != nil {
+		return err
+	}
+	d.released = time.Now()
+	time.Sleep(tCRSCK)
+
+	// 8 dummy clocks with chip select deasserted before the bitstream
+	if err := d.cs.Out(gpio.High); err != nil {
+		return err
+	}
+	if err := d.conn.Tx([]byte{0}, []byte{0}); err != nil {
+		return err
+	}
+	if err := d.cs.Out(gpio.Low); err != nil {
+		return err
+	}
+	// Full-duplex connections overwrite the buffer with what they read
+	buf := make([]byte, min(len(bitstream), d.Flash.MaxTxSize()))
+	for off := 0; off < len(bitstream); off += len(buf) {
+		chunk := buf[:copy(buf, bitstream[off:])]
+		if err := d.conn.Tx(chunk, chunk); err != nil {
+			d.cs.Out(gpio.High)
+			return err
+		}
+	}
+	if err := d.cs.Out(gpio.High); err != nil {
+		return err
+	}
+	d.debug("SRAM bitstream sent")
+	clocks := make([]byte, (cdoneClocks+7)/8)
+	if err := d.conn.Tx(clocks, clocks); err != nil {
+		return err
+	}
+	return d.cs.In(gpio.PullNoChange, gpio.NoEdge)
+}
@@ -0,0 +1,66 @@
+package gice
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/gentam/gice/flash"
+)
+
+// ParseSREC decodes Motorola S-record text into regions, merging contiguous
+// data records.
+func ParseSREC(data []byte) ([]Region, error) {
+	regions := []Region{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		if len(line) < 4 || line[0] != 'S' {
+			return nil, fmt.Errorf("line %d: invalid record", lineNo)
+		}
+		typ := line[1]
+		rec := make([]byte, hex.DecodedLen(len(line)-2))
+		if _, err := hex.Decode(rec, line[2:]); err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNo, err)
+		}
+		if len(rec) != 1+int(rec[0]) {
+			return nil, fmt.Errorf("line %d: invalid byte count", lineNo)
+		}
+		sum := byte(0)
+		for _, b := range rec {
+			sum += b
+		}
+		if sum != 0xFF {
+			return nil, fmt.Errorf("line %d: checksum mismatch", lineNo)
+		}
+
+		addrLen := 0
+		switch typ {
+		case '1':
+			addrLen = 2
+		case '2':
+			addrLen = 3
+		case '3':
+			addrLen = 4
+		case '0', '5', '6':
+			continue // header and record count
+		case '7', '8', '9':
+			return regions, nil // start address terminates the file
+		default:
+			return nil, fmt.Errorf("line %d: unknown record type S%c", lineNo, typ)
+		}
+		if len(rec) < 2+addrLen {
+			return nil, fmt.Errorf("line %d: record too short", lineNo)
+		}
+		addr := 0
+		for _, b := range rec[1 : 1+addrLen] {
+			addr = addr<<8 | int(b)
+		}
+		regions = flash.AppendRegion(regions, addr, rec[1+addrLen:len(rec)-1])
+	}
+	return regions, scanner.Err()
+}
@@ -0,0 +1,21 @@
+package gice
+
+import "testing"
+
+func FuzzParseSREC(f *testing.F) {
+	f.Add([]byte("S00600004844521B\nS1070000DEADBEEFC0\nS9030000FC\n"))
+	f.Add([]byte("S30900FFFFFF01020304EF\nS70500000000FA\n"))
+	f.Add([]byte("S1\n"))
+	f.Add([]byte("S10200FD\n"))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		regions, err := ParseSREC(data)
+		if err != nil {
+			return
+		}
+		for _, r := range regions {
+			if r.Addr < 0 || r.Addr+len(r.Data) > 1<<32 {
+				t.Fatalf("region 0x%X of %d bytes outside the address space", r.Addr, len(r.Data))
+			}
+		}
+	})
+}
@@ -0,0 +1,60 @@
+package gice
+
+import (
+	"io"
+	"log/slog"
+
+	"github.com/gentam/gice/flash"
+	"github.com/gentam/gice/transport"
+)
+
+// WithTrace logs every SPI transaction to w, one line each with the decoded
+// flash command, address, lengths, duration and the first bytes of data.
+func WithTrace(w io.Writer) Option {
+	return func(d *Device) { d.trace = w }
+}
+
+// WithRecord records every SPI transaction to w with transport.RecordConn, so
+// that the session can be served back by WithReplay.
+func WithRecord(w io.Writer) Option {
+	return func(d *Device) { d.record = w }
+}
+
+// WithVCD writes every SPI transaction to w as a Value Change Dump of the bus
+// signals clocked at the SPI clock, to be analyzed in PulseView or another
+// waveform viewer. Close ends the dump, leaving w open. See flash.VCDWriter.
+func WithVCD(w io.Writer) Option {
+	return func(d *Device) { d.vcdOut = w }
+}
+
+// WithLogger emits the debug events of the device and its flash to l, such as
+// the FPGA reset and configuration phases and the reinitializations, and every
+// SPI transaction of the flash at flash.LevelTrace.
+func WithLogger(l *slog.Logger) Option {
+	return func(d *Device) { d.log = l }
+}
+
+// debug emits an event to the logger of WithLogger, if set.
+func (d *Device) debug(msg string, args ...any) {
+	if d.log != nil {
+		d.log.Debug(msg, args...)
+	}
+}
+
+// wrapTrace makes the connection opened by d.open record, dump and log its
+// transactions, if WithRecord, WithVCD or WithTrace was given. The dump goes on
+// across Reinit.
+func (d *Device) wrapTrace() {
+	if d.record != nil {
+		d.conn = transport.RecordConn(d.conn, d.record)
+	}
+	if d.vcdOut != nil {
+		if d.vcd == nil {
+			d.vcd = flash.NewVCDWriter(d.vcdOut, d.clock)
+		}
+		d.conn = d.vcd.Conn(d.conn)
+	}
+	if d.trace != nil {
+		d.conn = flash.TraceConn(d.conn, d.trace)
+	}
+}
@@ -0,0 +1,302 @@
+package gice
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/gentam/gice/board"
+	"github.com/gentam/gice/flash/flashtest"
+	"github.com/gentam/gice/transport"
+	"periph.io/x/conn/v3/gpio"
+	"periph.io/x/conn/v3/physic"
+	"periph.io/x/conn/v3/spi"
+)
+
+// WithSPIDev uses the SPI port (e.g. "/dev/spidev0.0") and GPIO character
+// device lines given by pins instead of an FTDI device, for a single board
+// computer wired directly to the board. See transport.OpenSPIDev.
+func WithSPIDev(port string, pins SPIDevPins) Option {
+	return withBus(func(d *Device) (*transport.Bus, error) {
+		return transport.OpenSPIDev(port, pins, d.clock)
+	})
+}
+
+// WithBitbang bit-bangs SPI (mode 0, MSB first) on plain GPIOs instead of using
+// an FTDI device, for boards where no SPI controller is wired to the flash.
+// It is slow: every bit takes several GPIO accesses.
+func WithBitbang(pins BitbangPins) Option {
+	return withBus(func(*Device) (*transport.Bus, error) {
+		return transport.OpenBitbang(pins)
+	})
+}
+
+// WithD2XX drives the MPSSE of the i-th interface enumerated by the FTDI D2XX
+// library (0 is channel A of the first FT2232H) itself instead of going
+// through the FTDI driver of periph, for setups where that driver has trouble
+// claiming the device. Device.FTDI is nil, and the USB latency timer is set to
+// latency. See transport.OpenD2XX.
+func WithD2XX(i int, latency time.Duration) Option {
+	return withMPSSE(func(d *Device) (*transport.Bus, error) {
+		return transport.OpenD2XX(i, d.clock, latency)
+	})
+}
+
+// WithUSB drives the MPSSE of an FTDI chip itself over raw USB bulk transfers
+// (Linux usbfs) instead of going through the FTDI driver of periph, for chips
+// that driver does not model such as the FT232H and the full-speed FT2232D,
+// whose SPI clock is 6MHz at most, and to tune the USB latency timer, set to
+// latency. The chip is selected with WithSerial or WithIndex, and the channel
+// with WithChannel or the board profile detected from the product string.
+// Device.FTDI is nil. See transport.OpenUSB.
+func WithUSB(latency time.Duration) Option {
+	return withMPSSE(func(d *Device) (*transport.Bus, error) {
+		dev, err := d.findUSB()
+		if err != nil {
+			return nil, err
+		}
+		ch := d.channel
+		if ch < 0 {
+			ch = ChannelA
+			if d.Board != nil {
+				ch = d.Board.Channel
+			}
+		}
+		return transport.OpenUSB(dev, int(ch), d.clock, latency)
+	})
+}
+
+// findUSB selects the chip of WithUSB like findFT2232H, and the board profile
+// from its product string unless WithBoard is given.
+func (d *Device) findUSB() (transport.USBDevice, error) {
+	devs, err := transport.USBDevices()
+	if err != nil {
+		return transport.USBDevice{}, err
+	}
+	var dev *transport.USBDevice
+	switch {
+	case d.serial != "":
+		for i := range devs {
+			if devs[i].Serial == d.serial {
+				dev = &devs[i]
+				break
+			}
+		}
+		if dev == nil {
+			return transport.USBDevice{}, fmt.Errorf("%w with serial %q", ErrDeviceNotFound, d.serial)
+		}
+	case d.index >= 0:
+		if d.index >= len(devs) {
+			return transport.USBDevice{}, fmt.Errorf("%w: no device #%d (%d attached)", ErrDeviceNotFound, d.index, len(devs))
+		}
+		dev = &devs[d.index]
+	case len(devs) > 0:
+		dev = &devs[0]
+	default:
+		return transport.USBDevice{}, ErrDeviceNotFound
+	}
+	if d.Board == nil {
+		d.Board = board.Detect(dev.Product)
+	}
+	return *dev, nil
+}
+
+// WithSerprog uses a programmer speaking the flashrom serprog protocol over rw,
+// e.g. the serial port of a Raspberry Pi Pico running pico-serprog, instead of
+// an FTDI device.
+//
+// Serprog has no FPGA reset or CDONE lines: the FPGA must be kept in reset by
+// other means while the flash is accessed, and ReleaseFlash only disables the
+// output drivers of the programmer.
+func WithSerprog(rw io.ReadWriter) Option {
+	return withBus(func(d *Device) (*transport.Bus, error) {
+		return transport.OpenSerprog(rw, d.clock)
+	})
+}
+
+// WithRemote uses a device served by ServeRemote (gice remoted) over rw,
+// typically a TCP connection to a host the board is attached to. The board
+// profile of the server is used unless WithBoard is given. The protocol has no
+// authentication; use it on trusted networks only.
+func WithRemote(rw io.ReadWriter) Option {
+	return withBus(func(d *Device) (*transport.Bus, error) {
+		b, name, err := transport.OpenRemote(rw)
+		if err == nil && d.Board == nil {
+			d.Board = board.Lookup(name)
+		}
+		return b, err
+	})
+}
+
+// WithReplay serves back a session recorded with WithRecord from r instead of
+// using a programmer, e.g. to reproduce a bug report without the hardware.
+// Every transaction must match the recording; see transport.OpenReplay.
+func WithReplay(r io.Reader) Option {
+	var b *transport.Bus
+	return withBus(func(*Device) (*transport.Bus, error) {
+		// Reinit goes on with the same recording
+		if b != nil {
+			return b, nil
+		}
+		var err error
+		b, err = transport.OpenReplay(r)
+		return b, err
+	})
+}
+
+// WithVirtual simulates a board with a flash of model m instead of using a
+// programmer: the flash operations act on the image file at path, taking the
+// times set by timing. See transport.OpenVirtual.
+func WithVirtual(path string, m flashtest.Model, timing flashtest.Timing) Option {
+	var v *transport.Virtual
+	return withBus(func(d *Device) (*transport.Bus, error) {
+		// Reinit goes on with the same board
+		if v == nil {
+			var err error
+			if v, err = transport.OpenVirtual(path, m, timing); err != nil {
+				return nil, err
+			}
+		}
+		return v.Bus(d.clock), nil
+	})
+}
+
+// withMPSSE is withBus for the programmers driving the MPSSE of an FTDI chip
+// themselves. The host drivers of periph are not initialized for the device,
+// as its FTDI driver would open every FTDI device itself.
+func withMPSSE(open func(*Device) (*transport.Bus, error)) Option {
+	bus := withBus(open)
+	return func(d *Device) {
+		bus(d)
+		d.noHost = true
+	}
+}
+
+// withBus makes the device use the bus opened by open instead of an FTDI
+// device.
+func withBus(open func(*Device) (*transport.Bus, error)) Option {
+	return func(d *Device) {
+		d.open = func(d *Device) error {
+			b, err := open(d)
+			if err != nil {
+				return err
+			}
+			d.conn, d.port, d.release = b.Conn, b.Port, b.Release
+			d.cs, d.reset, d.cdone = b.CS, b.Reset, b.CDone
+			return nil
+		}
+	}
+}
+
+// ServeRemote answers requests of a WithRemote client read from rw until rw is
+// closed. The transactions of the client hold the lock of d.Flash, so that they
+// do not interleave with the commands of local Flash users.
+func (d *Device) ServeRemote(rw io.ReadWriter) error {
+	l := &remoteLock{f: d.Flash}
+	defer l.release()
+	b := &transport.Bus{Conn: remoteConn{d.conn, l}, Reset: d.reset, CDone: d.cdone}
+	if d.cs != nil {
+		b.CS = remoteCS{d.cs, l}
+	}
+	name := ""
+	if d.Board != nil {
+		name = d.Board.Name
+	}
+	return transport.ServeRemote(rw, b, name, d.Flash.MaxTxSize())
+}
+
+// remoteLock holds the lock of the flash from the assertion of chip select by a
+// remote client to its deassertion, or for each transfer when the bus has no
+// chip select pin.
+type remoteLock struct {
+	f    *Flash
+	held bool
+}
+
+func (l *remoteLock) acquire() {
+	if !l.held {
+		l.f.Lock()
+		l.held = true
+	}
+}
+
+// release unlocks the flash, also when the client disconnects with chip select
+// asserted.
+func (l *remoteLock) release() {
+	if l.held {
+		l.f.Unlock()
+		l.held = false
+	}
+}
+
+type remoteConn struct {
+	spi.Conn
+	l *remoteLock
+}
+
+func (c remoteConn) Tx(w, r []byte) error {
+	if c.l.held {
+		return c.Conn.Tx(w, r)
+	}
+	c.l.acquire()
+	defer c.l.release()
+	return c.Conn.Tx(w, r)
+}
+
+func (c remoteConn) TxPackets(p []spi.Packet) error {
+	if c.l.held {
+		return c.Conn.TxPackets(p)
+	}
+	c.l.acquire()
+	defer c.l.release()
+	return c.Conn.TxPackets(p)
+}
+
+type remoteCS struct {
+	gpio.PinIO
+	l *remoteLock
+}
+
+func (p remoteCS) Out(l gpio.Level) error {
+	if l == gpio.Low {
+		p.l.acquire()
+		return p.PinIO.Out(l)
+	}
+	defer p.l.release()
+	return p.PinIO.Out(l)
+}
+
+func (p remoteCS) In(pull gpio.Pull, edge gpio.Edge) error {
+	defer p.l.release()
+	return p.PinIO.In(pull, edge)
+}
+
+// ServeSerprog answers serprog commands read from rw with the SPI connection
+// of the device until rw is closed, so that flashrom can access the flash
+// through gice. Enabling the output drivers (S_PIN_STATE) holds the FPGA in
+// reset and disabling them hands the flash back to the FPGA.
+func (d *Device) ServeSerprog(rw io.ReadWriter) error {
+	return transport.ServeSerprog(rw, serprogTarget{d.Flash, d})
+}
+
+// serprogTarget serves the flash of a device over serprog.
+type serprogTarget struct {
+	*Flash
+	d *Device
+}
+
+func (t serprogTarget) Clock() physic.Frequency { return t.d.clock }
+
+func (t serprogTarget) SetPinState(enable bool) error {
+	var err error
+	if enable {
+		err = t.d.HoldFPGAReset()
+	} else {
+		err = t.d.ReleaseFlash()
+	}
+	if errors.Is(err, errNoReset) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,95 @@
+package transport
+
+import (
+	"periph.io/x/conn/v3"
+	"periph.io/x/conn/v3/gpio"
+	"periph.io/x/conn/v3/spi"
+)
+
+// BitbangPins names the GPIOs wired to the iCE40 board when SPI is bit-banged,
+// e.g. "GPIO11" on a Raspberry Pi.
+type BitbangPins struct {
+	CLK  string // iCE_SCK
+	MOSI string // FLASH_MOSI
+	MISO string // FLASH_MISO
+	SPIDevPins
+}
+
+// OpenBitbang bit-bangs SPI (mode 0, MSB first) on plain GPIOs, for boards
+// where no SPI controller is wired to the flash. It is slow: every bit takes
+// several GPIO accesses.
+func OpenBitbang(pins BitbangPins) (*Bus, error) {
+	c := &bitbangConn{}
+	var err error
+	if c.clk, err = lookupGPIO("CLK", pins.CLK); err != nil {
+		return nil, err
+	}
+	if c.mosi, err = lookupGPIO("MOSI", pins.MOSI); err != nil {
+		return nil, err
+	}
+	if c.miso, err = lookupGPIO("MISO", pins.MISO); err != nil {
+		return nil, err
+	}
+	b := &Bus{Conn: c}
+	if err := b.lookupPins(pins.SPIDevPins); err != nil {
+		return nil, err
+	}
+
+	if err := c.clk.Out(gpio.Low); err != nil {
+		return nil, err
+	}
+	if err := c.mosi.Out(gpio.Low); err != nil {
+		return nil, err
+	}
+	if err := c.miso.In(gpio.PullNoChange, gpio.NoEdge); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// bitbangConn is an spi.Conn in mode 0 without chip select handling.
+type bitbangConn struct {
+	clk, mosi, miso gpio.PinIO
+}
+
+func (c *bitbangConn) String() string { return "bitbang(" + c.clk.Name() + ")" }
+
+func (c *bitbangConn) Duplex() conn.Duplex { return conn.Full }
+
+// Tx shifts out w and shifts into r, padding w with zeros if r is longer.
+func (c *bitbangConn) Tx(w, r []byte) error {
+	for i := range max(len(w), len(r)) {
+		var out, in byte
+		if i < len(w) {
+			out = w[i]
+		}
+		for bit := 7; bit >= 0; bit-- {
+			if err := c.mosi.Out(gpio.Level(out>>bit&1 != 0)); err != nil {
+				return err
+			}
+			// Data is sampled on the rising edge and shifted on the falling edge
+			if err := c.clk.Out(gpio.High); err != nil {
+				return err
+			}
+			if c.miso.Read() == gpio.High {
+				in |= 1 << bit
+			}
+			if err := c.clk.Out(gpio.Low); err != nil {
+				return err
+			}
+		}
+		if i < len(r) {
+			r[i] = in
+		}
+	}
+	return nil
+}
+
+func (c *bitbangConn) TxPackets(p []spi.Packet) error {
+	for _, pkt := range p {
+		if err := c.Tx(pkt.W, pkt.R); err != nil {
+			return err
+		}
+	}
+	return nil
+}
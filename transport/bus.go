@@ -0,0 +1,24 @@
+package transport
+
+import (
+	"periph.io/x/conn/v3/gpio"
+	"periph.io/x/conn/v3/spi"
+)
+
+// Bus is the SPI connection to the flash of a board along with the pins
+// configuring its FPGA.
+type Bus struct {
+	Conn spi.Conn
+
+	CS    gpio.PinIO // iCE_SS_B; nil if Conn drives chip select itself
+	Reset gpio.PinIO // iCE_CRESET; nil if the programmer has no reset line
+	CDone gpio.PinIO // iCE_CDONE; nil if the programmer has no CDONE line
+
+	// Port is the port of Conn, to be closed when reopening the bus; nil if it
+	// is not closable.
+	Port spi.PortCloser
+
+	// Release, if set, stops driving the bus so that the FPGA can access the
+	// flash, for programmers without a reset line.
+	Release func() error
+}
@@ -0,0 +1,128 @@
+//go:build !no_d2xx
+
+package transport
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"periph.io/x/conn/v3/physic"
+	"periph.io/x/d2xx"
+)
+
+// OpenD2XX opens the i-th interface enumerated by the FTDI D2XX library, e.g.
+// 0 for channel A of the first FT2232H, and drives its MPSSE with OpenMPSSE.
+// The USB latency timer is set to latency, rounded to milliseconds.
+//
+// The interface is opened directly rather than through the FTDI driver of
+// periph, for setups where that driver cannot claim the device; it must not
+// have been opened by the driver, which host.Init does for every FTDI device.
+// Builds with the no_d2xx tag, like those without cgo outside Windows, lack
+// the library and fail to open.
+func OpenD2XX(i int, clock physic.Frequency, latency time.Duration) (*Bus, error) {
+	// The library enumerates the interfaces before opening one
+	n, e := d2xx.CreateDeviceInfoList()
+	if e != 0 {
+		return nil, fmt.Errorf("d2xx: enumerate interfaces: %s", e)
+	}
+	if i >= n {
+		return nil, fmt.Errorf("d2xx: interface %d not found among %d", i, n)
+	}
+	h, e := d2xx.Open(i)
+	if e != 0 {
+		return nil, fmt.Errorf("d2xx: open interface %d: %s", i, e)
+	}
+	p := &d2xxPipe{h: h}
+	if err := p.setup(latency); err != nil {
+		h.Close()
+		return nil, fmt.Errorf("d2xx: %w", err)
+	}
+	b, err := OpenMPSSE(p, clock)
+	if err != nil {
+		h.Close()
+		return nil, err
+	}
+	return b, nil
+}
+
+// d2xxPipe is the byte stream of a D2XX handle in MPSSE mode.
+type d2xxPipe struct {
+	h d2xx.Handle
+}
+
+// setup resets the interface and puts it in MPSSE mode. [FTDI-AN_135|4.1]
+func (p *d2xxPipe) setup(latency time.Duration) error {
+	const timeout = 5000 // ms
+	steps := []struct {
+		name string
+		fn   func() d2xx.Err
+	}{
+		{"reset", p.h.ResetDevice},
+		{"set USB parameters", func() d2xx.Err { return p.h.SetUSBParameters(65536, 65536) }},
+		{"disable event characters", func() d2xx.Err { return p.h.SetChars(0, false, 0, false) }},
+		{"set timeouts", func() d2xx.Err { return p.h.SetTimeouts(timeout, timeout) }},
+		{"set latency timer", func() d2xx.Err { return p.h.SetLatencyTimer(latencyMS(latency)) }},
+		{"set flow control", p.h.SetFlowControl},
+		{"reset bit mode", func() d2xx.Err { return p.h.SetBitMode(0, ftdiBitModeReset) }},
+		{"enter MPSSE mode", func() d2xx.Err { return p.h.SetBitMode(0, ftdiBitModeMPSSE) }},
+	}
+	for _, s := range steps {
+		if e := s.fn(); e != 0 {
+			return fmt.Errorf("%s: %s", s.name, e)
+		}
+	}
+	// Let the MPSSE settle before the synchronization
+	time.Sleep(50 * time.Millisecond)
+	return nil
+}
+
+func (p *d2xxPipe) Read(b []byte) (int, error) {
+	n, e := p.h.Read(b)
+	if e != 0 {
+		return n, errors.New(e.String())
+	}
+	if n == 0 && len(b) > 0 {
+		return 0, errors.New("read timeout")
+	}
+	return n, nil
+}
+
+func (p *d2xxPipe) Write(b []byte) (int, error) {
+	for off := 0; off < len(b); {
+		n, e := p.h.Write(b[off:])
+		if e != 0 {
+			return off + n, errors.New(e.String())
+		}
+		if n == 0 {
+			return off, errors.New("write timeout")
+		}
+		off += n
+	}
+	return len(b), nil
+}
+
+// Purge discards the answers queued by the library. The library has no purge
+// of the buffers of the chip: they are read out until none is left.
+func (p *d2xxPipe) Purge() error {
+	buf := make([]byte, 4096)
+	for {
+		n, e := p.h.GetQueueStatus()
+		if e != 0 {
+			return errors.New(e.String())
+		}
+		if n == 0 {
+			return nil
+		}
+		if _, err := p.Read(buf[:min(int(n), len(buf))]); err != nil {
+			return err
+		}
+	}
+}
+
+func (p *d2xxPipe) Close() error {
+	if e := p.h.Close(); e != 0 {
+		return errors.New(e.String())
+	}
+	return nil
+}
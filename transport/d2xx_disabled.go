@@ -0,0 +1,16 @@
+//go:build no_d2xx
+
+package transport
+
+import (
+	"errors"
+	"time"
+
+	"periph.io/x/conn/v3/physic"
+)
+
+// OpenD2XX returns an error: the D2XX library is disabled by the no_d2xx
+// build tag.
+func OpenD2XX(i int, clock physic.Frequency, latency time.Duration) (*Bus, error) {
+	return nil, errors.New("d2xx: disabled by the no_d2xx build tag")
+}
@@ -0,0 +1,19 @@
+// Package transport opens the SPI buses that gice reaches the flash and the
+// FPGA through when periph's FTDI driver is not used: the MPSSE of an FTDI
+// channel driven directly through the D2XX library or Linux usbfs, a Linux
+// spidev port, bit-banged GPIOs, a serprog programmer, a remote gice server,
+// the replay of a recorded session, or a virtual board whose flash is an image
+// file. It also implements the server side of the serprog and remote
+// protocols, and the recording of sessions.
+//
+// # References:
+//
+//   - [FTDI-AN_108]: Command Processor for MPSSE and MCU Host Bus Emulation Modes (https://ftdichip.com/wp-content/uploads/2020/08/AN_108_Command_Processor_for_MPSSE_and_MCU_Host_Bus_Emulation_Modes.pdf)
+//   - [FTDI-AN_114]: Interfacing FT2232H Hi-Speed Devices To SPI Bus (https://ftdichip.com/wp-content/uploads/2020/08/AN_114_FTDI_Hi_Speed_USB_To_SPI_Example.pdf)
+//   - [FTDI-AN_135]: FTDI MPSSE Basics (https://ftdichip.com/wp-content/uploads/2020/08/AN_135_MPSSE_Basics.pdf)
+//   - [FTDI-AN_232B-04]: Data Throughput, Latency and Handshaking (https://ftdichip.com/wp-content/uploads/2020/08/AN232B-04_DataLatencyFlow.pdf)
+//   - [FTDI-DS_FT2232D]: FT2232D Dual USB to Serial UART/FIFO IC Datasheet (https://ftdichip.com/wp-content/uploads/2020/08/DS_FT2232D.pdf)
+//   - [FTDI-DS_FT2232H]: FT2232H Hi-Speed Dual USB UART/FIFO IC Data Sheet (https://ftdichip.com/wp-content/uploads/2024/09/DS_FT2232H.pdf)
+//   - [iCEBreaker]: iCEBreaker FPGA (https://github.com/icebreaker-fpga/icebreaker/blob/master/hardware/v1.0e/icebreaker-sch.pdf)
+//   - [serprog]: Serial Flasher Protocol Specification (https://www.flashrom.org/supported_hw/supported_prog/serprog/serprog-protocol.html)
+package transport
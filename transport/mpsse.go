@@ -0,0 +1,408 @@
+package transport
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"periph.io/x/conn/v3"
+	"periph.io/x/conn/v3/gpio"
+	"periph.io/x/conn/v3/physic"
+	"periph.io/x/conn/v3/spi"
+)
+
+// MPSSE commands. [FTDI-AN_108]
+const (
+	mpsseWriteReadBytes  = 0x31 // clock bytes out on -ve edge and in on +ve edge, MSB first
+	mpsseWriteBytes      = 0x11 // clock bytes out on -ve edge, MSB first
+	mpsseSetLow          = 0x80 // set the value and direction of ADBUS
+	mpsseGetLow          = 0x81 // read ADBUS
+	mpsseLoopbackOff     = 0x85
+	mpsseSetDivisor      = 0x86
+	mpsseSendImmediate   = 0x87 // flush the responses to the host
+	mpsseDisableDiv5     = 0x8A // 60MHz master clock
+	mpsseDisable3Phase   = 0x8D
+	mpsseDisableAdaptive = 0x97
+	mpsseBadCommand      = 0xFA // answer to an invalid command, followed by it
+	mpsseSyncCommand     = 0xAA // invalid commands sent to check the answers line up
+	mpsseCheckCommand    = 0xAB
+
+	mpsseMaxBytes = 65536 // length of a data command
+)
+
+// mpsseModel holds what differs between the MPSSEs of the FTDI chips.
+type mpsseModel struct {
+	base    physic.Frequency // highest SCK frequency, half the master clock
+	fifo    int              // size of the transmit buffer, of the answers to the host
+	hiSpeed bool             // has the clocking commands of the Hi-Speed chips
+}
+
+var (
+	// mpsseHiSpeed is the MPSSE of the FT2232H and the other Hi-Speed chips,
+	// with the divide-by-5 of its 60MHz master clock disabled.
+	// [FTDI-DS_FT2232H]
+	mpsseHiSpeed = mpsseModel{base: 30 * physic.MegaHertz, fifo: 4096, hiSpeed: true}
+	// mpsseFullSpeed is the MPSSE of the FT2232C/D/L, with a 12MHz master
+	// clock and a 128 byte transmit buffer. [FTDI-DS_FT2232D]
+	mpsseFullSpeed = mpsseModel{base: 6 * physic.MegaHertz, fifo: 128}
+)
+
+// ADBUS pins of the SPI interface and of the FPGA. [FTDI-AN_114] [iCEBreaker]
+const (
+	mpssePinSCK   = 1 << 0
+	mpssePinMOSI  = 1 << 1
+	mpssePinCS    = 1 << 4
+	mpssePinCDone = 1 << 6
+	mpssePinReset = 1 << 7
+)
+
+// OpenMPSSE drives the MPSSE of a channel of a Hi-Speed FTDI chip such as the
+// FT2232H through rw, the byte stream of an interface already put in MPSSE
+// mode: what is written is executed as commands and their responses are read
+// back. The SPI connection (mode 0) is clocked at the highest frequency up to
+// clock, with chip select, the FPGA reset and CDONE on ADBUS4, ADBUS7 and
+// ADBUS6 like with the FT2232H boards.
+//
+// Asserting chip select is queued and sent along with the next transfer, and
+// deasserting it is written without waiting for an answer, so that each flash
+// command takes a single USB round trip. Reads are clocked in commands of the
+// size of the transmit buffer of the chip, each answered before the next is
+// written: once the answers waiting for the host fill it, the chip stops taking
+// commands.
+// Every batch of commands ends with an invalid one, whose answer must come last:
+// otherwise, e.g. after a command the chip did not understand, rw is purged if
+// it has a Purge method, the MPSSE synchronized again and the transfer fails
+// with ErrOutOfSync. Bus.Port closes rw if it is an io.Closer.
+func OpenMPSSE(rw io.ReadWriter, clock physic.Frequency) (*Bus, error) {
+	return openMPSSE(rw, mpsseHiSpeed, clock)
+}
+
+// openMPSSE is OpenMPSSE for the MPSSE model of the chip.
+func openMPSSE(rw io.ReadWriter, model mpsseModel, clock physic.Frequency) (*Bus, error) {
+	m := &mpsse{rw: rw, model: model, value: mpssePinCS, dir: mpssePinSCK | mpssePinMOSI | mpssePinCS}
+	if err := m.sync(); err != nil {
+		return nil, fmt.Errorf("mpsse: %w", err)
+	}
+	c, err := m.Connect(clock, spi.Mode0, 8)
+	if err != nil {
+		return nil, err
+	}
+	return &Bus{
+		Conn:  c,
+		CS:    &mpssePin{m: m, bit: mpssePinCS, name: "ADBUS4"},
+		Reset: &mpssePin{m: m, bit: mpssePinReset, name: "ADBUS7"},
+		CDone: &mpssePin{m: m, bit: mpssePinCDone, name: "ADBUS6"},
+		Port:  m,
+	}, nil
+}
+
+// mpsse is the command processor of an FTDI channel, and the SPI port on its
+// ADBUS pins.
+type mpsse struct {
+	mu         sync.Mutex
+	rw         io.ReadWriter
+	model      mpsseModel
+	value, dir byte   // ADBUS state
+	pending    []byte // commands sent with the next transfer
+	clock      physic.Frequency
+}
+
+var _ spi.PortCloser = (*mpsse)(nil)
+
+func (m *mpsse) String() string { return "mpsse " + m.clock.String() }
+
+// Close implements spi.PortCloser. All ADBUS pins but the FPGA reset are
+// released first, so that the reset stays held if it is driven low.
+func (m *mpsse) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.dir &= mpssePinReset
+	m.setLow()
+	err := m.flush(nil, nil)
+	if c, ok := m.rw.(io.Closer); ok {
+		return errors.Join(err, c.Close())
+	}
+	return err
+}
+
+// LimitSpeed implements spi.Port.
+func (m *mpsse) LimitSpeed(f physic.Frequency) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.setClock(f)
+}
+
+// Connect implements spi.Port. Only mode 0 with 8 bit words is supported.
+func (m *mpsse) Connect(f physic.Frequency, mode spi.Mode, bits int) (spi.Conn, error) {
+	if mode != spi.Mode0 || bits != 8 {
+		return nil, fmt.Errorf("mpsse: unsupported SPI mode %s with %d bits", mode, bits)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.model.hiSpeed {
+		m.pending = append(m.pending, mpsseDisableDiv5, mpsseDisableAdaptive, mpsseDisable3Phase)
+	}
+	m.pending = append(m.pending, mpsseLoopbackOff)
+	m.setLow()
+	if err := m.flush(nil, nil); err != nil {
+		return nil, fmt.Errorf("mpsse: configure: %w", err)
+	}
+	if err := m.setClock(f); err != nil {
+		return nil, err
+	}
+	return &mpsseConn{m: m}, nil
+}
+
+// setClock sets the divisor of the master clock giving the highest SCK
+// frequency up to f. [FTDI-AN_108|3.8.2 Set TCK/SK Divisor]
+func (m *mpsse) setClock(f physic.Frequency) error {
+	base := m.model.base
+	if f <= 0 {
+		return fmt.Errorf("mpsse: invalid clock %s", f)
+	}
+	div := min((base+f-1)/f-1, 0xFFFF)
+	if err := m.flush([]byte{mpsseSetDivisor, byte(div), byte(div >> 8)}, nil); err != nil {
+		return fmt.Errorf("mpsse: set clock: %w", err)
+	}
+	m.clock = base / (div + 1)
+	return nil
+}
+
+// sync discards pending output of the device by waiting for the answer to an
+// invalid command. [FTDI-AN_135|4.2 Synchronize the MPSSE]
+func (m *mpsse) sync() error {
+	const bogus = mpsseSyncCommand
+	if _, err := m.rw.Write([]byte{bogus, mpsseSendImmediate}); err != nil {
+		return err
+	}
+	b := make([]byte, 1)
+	for prev, n := byte(0), 0; ; n++ {
+		if n == 4096 {
+			return errors.New("synchronize: no answer to an invalid command")
+		}
+		if _, err := io.ReadFull(m.rw, b); err != nil {
+			return fmt.Errorf("synchronize: %w", err)
+		}
+		if prev == mpsseBadCommand && b[0] == bogus {
+			return nil
+		}
+		prev = b[0]
+	}
+}
+
+// setLow appends the command setting the ADBUS state to the pending ones.
+func (m *mpsse) setLow() {
+	m.pending = append(m.pending, mpsseSetLow, m.value, m.dir)
+}
+
+// ErrOutOfSync is returned by the transfers of OpenMPSSE when the answers of
+// the MPSSE did not line up with the commands. The MPSSE is synchronized again
+// with chip select released, so the whole transaction can be retried.
+var ErrOutOfSync = errors.New("mpsse: answers out of sync with the commands")
+
+// purger is implemented by the byte streams that can discard the data in
+// flight in both directions.
+type purger interface {
+	Purge() error
+}
+
+// flush writes the pending commands followed by cmd and reads len(resp) bytes
+// of answer, checking that the answer to an invalid command comes right after
+// them.
+func (m *mpsse) flush(cmd, resp []byte) error {
+	buf := append(m.pending, cmd...)
+	m.pending = m.pending[:0]
+	if len(resp) > 0 {
+		buf = append(buf, mpsseCheckCommand, mpsseSendImmediate)
+	}
+	if len(buf) > 0 {
+		if _, err := m.rw.Write(buf); err != nil {
+			return err
+		}
+	}
+	if len(resp) == 0 {
+		return nil
+	}
+	if _, err := io.ReadFull(m.rw, resp); err != nil {
+		return err
+	}
+	var check [2]byte
+	if _, err := io.ReadFull(m.rw, check[:]); err != nil {
+		return err
+	}
+	if check != [2]byte{mpsseBadCommand, mpsseCheckCommand} {
+		return m.resync()
+	}
+	return nil
+}
+
+// resync discards the answers in flight, synchronizes the MPSSE again and
+// releases chip select, returning ErrOutOfSync.
+func (m *mpsse) resync() error {
+	if p, ok := m.rw.(purger); ok {
+		if err := p.Purge(); err != nil {
+			return fmt.Errorf("purge: %w", err)
+		}
+	}
+	if err := m.sync(); err != nil {
+		return err
+	}
+	m.value |= mpssePinCS
+	m.setLow()
+	if err := m.flush(nil, nil); err != nil {
+		return err
+	}
+	return ErrOutOfSync
+}
+
+// mpsseConn is the SPI connection of an mpsse. Chip select is driven through
+// the pin of Bus.CS.
+type mpsseConn struct {
+	m *mpsse
+}
+
+func (c *mpsseConn) String() string      { return "mpsse" }
+func (c *mpsseConn) Duplex() conn.Duplex { return conn.Full }
+
+// MaxTxSize implements conn.Limits.
+func (c *mpsseConn) MaxTxSize() int { return mpsseMaxBytes }
+
+// Tx implements spi.Conn, shifting w out and, if r is not empty, max(len(w),
+// len(r)) bytes into r.
+func (c *mpsseConn) Tx(w, r []byte) error {
+	n := max(len(w), len(r))
+	// Leaving room for the answer to the check command of flush
+	op, chunk := byte(mpsseWriteReadBytes), c.m.model.fifo-2
+	if len(r) == 0 {
+		// Nothing fills the transmit buffer
+		op, chunk = mpsseWriteBytes, mpsseMaxBytes
+	}
+	c.m.mu.Lock()
+	defer c.m.mu.Unlock()
+	var resp []byte
+	if len(r) > 0 {
+		resp = make([]byte, n)
+	}
+	if n == 0 {
+		return c.m.flush(nil, nil)
+	}
+	cmd := make([]byte, 0, min(n, chunk)+3)
+	for off := 0; off < n; off += chunk {
+		l := min(n-off, chunk)
+		cmd = append(cmd[:0], op, byte(l-1), byte((l-1)>>8))
+		if off < len(w) {
+			cmd = append(cmd, w[off:min(off+l, len(w))]...)
+		}
+		// Shift zeros past the end of w
+		for i := max(len(w), off); i < off+l; i++ {
+			cmd = append(cmd, 0)
+		}
+		var out []byte
+		if len(r) > 0 {
+			out = resp[off : off+l]
+		}
+		if err := c.m.flush(cmd, out); err != nil {
+			return fmt.Errorf("mpsse: transfer: %w", err)
+		}
+	}
+	copy(r, resp)
+	return nil
+}
+
+// TxPackets implements spi.Conn.
+func (c *mpsseConn) TxPackets(p []spi.Packet) error {
+	for _, pkt := range p {
+		if err := c.Tx(pkt.W, pkt.R); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mpssePin is a gpio.PinIO on ADBUS.
+type mpssePin struct {
+	m    *mpsse
+	bit  byte
+	name string
+}
+
+func (p *mpssePin) String() string { return "mpsse " + p.name }
+func (p *mpssePin) Halt() error    { return nil }
+func (p *mpssePin) Name() string   { return p.name }
+
+func (p *mpssePin) Number() int {
+	n := 0
+	for b := p.bit; b > 1; b >>= 1 {
+		n++
+	}
+	return n
+}
+
+func (p *mpssePin) Function() string {
+	p.m.mu.Lock()
+	out := p.m.dir&p.bit != 0
+	p.m.mu.Unlock()
+	if out {
+		return "Out/" + p.Read().String()
+	}
+	return "In/" + p.Read().String()
+}
+
+// In turns the pin into an input. Pull and edge detection are not supported.
+func (p *mpssePin) In(pull gpio.Pull, edge gpio.Edge) error {
+	if pull != gpio.PullNoChange && pull != gpio.Float || edge != gpio.NoEdge {
+		return errors.New("mpsse: pins support neither pull nor edge detection")
+	}
+	m := p.m
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.dir &^= p.bit
+	m.setLow()
+	return m.flush(nil, nil)
+}
+
+// Read returns the level of the pin, or Low if it cannot be read.
+func (p *mpssePin) Read() gpio.Level {
+	m := p.m
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	b := make([]byte, 1)
+	if err := m.flush([]byte{mpsseGetLow}, b); err != nil {
+		return gpio.Low
+	}
+	return b[0]&p.bit != 0
+}
+
+func (p *mpssePin) WaitForEdge(timeout time.Duration) bool { return false }
+func (p *mpssePin) Pull() gpio.Pull                        { return gpio.PullNoChange }
+func (p *mpssePin) DefaultPull() gpio.Pull                 { return gpio.PullNoChange }
+
+// Out drives the pin. Asserting chip select is deferred to the next transfer.
+func (p *mpssePin) Out(l gpio.Level) error {
+	m := p.m
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.dir |= p.bit
+	if l {
+		m.value |= p.bit
+	} else {
+		m.value &^= p.bit
+	}
+	m.setLow()
+	if p.bit == mpssePinCS && l == gpio.Low {
+		return nil
+	}
+	return m.flush(nil, nil)
+}
+
+func (p *mpssePin) PWM(gpio.Duty, physic.Frequency) error {
+	return errors.New("mpsse: pins do not support PWM")
+}
+
+// latencyMS returns the USB latency timer value for latency, clamped to the
+// 1 to 255ms the FTDI chips support. [FTDI-AN_232B-04]
+func latencyMS(latency time.Duration) uint8 {
+	return uint8(min(max(latency.Round(time.Millisecond)/time.Millisecond, 1), 255))
+}
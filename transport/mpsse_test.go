@@ -0,0 +1,352 @@
+package transport
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"slices"
+	"testing"
+
+	"github.com/gentam/gice/flash"
+	"github.com/gentam/gice/flash/flashtest"
+	"periph.io/x/conn/v3/gpio"
+	"periph.io/x/conn/v3/physic"
+)
+
+// mpsseChip emulates the MPSSE of an FTDI channel wired to a flash: the data
+// commands sent while chip select is low make up a transaction of the chip. A
+// transaction split over several commands is replayed from its start for each
+// of them, which only suits reads.
+type mpsseChip struct {
+	chip       *flashtest.Chip
+	tx         []byte // shifted out since chip select was asserted
+	value, dir byte
+	cdone      bool
+	divisor    int
+	out        bytes.Buffer // answers not read yet
+	in         []byte       // incomplete command
+	writes     int
+	lengths    []int // of the data commands
+	fifo       int   // size of the transmit buffer, if limited
+	fullSpeed  bool  // without the clocking commands of the Hi-Speed chips
+}
+
+func (e *mpsseChip) Write(b []byte) (int, error) {
+	e.writes++
+	e.in = append(e.in, b...)
+	for len(e.in) > 0 {
+		n := e.command(e.in)
+		if n == 0 {
+			break
+		}
+		e.in = e.in[n:]
+		if e.fifo > 0 && e.out.Len() > e.fifo {
+			// The chip stops taking commands until its answers are read
+			return len(b), errors.New("write timeout: transmit buffer full")
+		}
+	}
+	return len(b), nil
+}
+
+// command runs the command at the start of b and returns its length, or 0 if
+// it is incomplete.
+func (e *mpsseChip) command(b []byte) int {
+	switch b[0] {
+	case mpsseDisableDiv5, mpsseDisableAdaptive, mpsseDisable3Phase:
+		if e.fullSpeed {
+			break
+		}
+		return 1
+	case mpsseLoopbackOff, mpsseSendImmediate:
+		return 1
+	case mpsseSetDivisor, mpsseSetLow:
+		if len(b) < 3 {
+			return 0
+		}
+		if b[0] == mpsseSetDivisor {
+			e.divisor = int(b[1]) | int(b[2])<<8
+		} else {
+			e.value, e.dir = b[1], b[2]
+			if !e.selected() {
+				e.tx = nil
+			}
+		}
+		return 3
+	case mpsseGetLow:
+		v := e.value &^ mpssePinCDone
+		if e.cdone {
+			v |= mpssePinCDone
+		}
+		e.out.WriteByte(v)
+		return 1
+	case mpsseWriteReadBytes, mpsseWriteBytes:
+		if len(b) < 3 {
+			return 0
+		}
+		n := int(b[1]) | int(b[2])<<8 + 1
+		if len(b) < 3+n {
+			return 0
+		}
+		e.lengths = append(e.lengths, n)
+		w, r := b[3:3+n], bytes.Repeat([]byte{0xFF}, n)
+		if e.selected() {
+			e.tx = append(e.tx, w...)
+			out := make([]byte, len(e.tx))
+			e.chip.Tx(e.tx, out)
+			copy(r, out[len(e.tx)-n:])
+		}
+		if b[0] == mpsseWriteReadBytes {
+			e.out.Write(r)
+		}
+		return 3 + n
+	}
+	e.out.Write([]byte{mpsseBadCommand, b[0]})
+	return 1
+}
+
+func (e *mpsseChip) selected() bool {
+	return e.dir&mpssePinCS != 0 && e.value&mpssePinCS == 0
+}
+
+func (e *mpsseChip) Read(b []byte) (int, error) {
+	if e.out.Len() == 0 {
+		return 0, io.EOF
+	}
+	return e.out.Read(b)
+}
+
+func TestMPSSE(t *testing.T) {
+	e := &mpsseChip{chip: flashtest.New(flashtest.W25Q128)}
+	// Answers left over from a previous session
+	e.out.Write([]byte{0x12, mpsseBadCommand, 0x34})
+	b, err := OpenMPSSE(e, 10*physic.MegaHertz)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.divisor != 2 {
+		t.Errorf("divisor = %d, want 2 for 10MHz", e.divisor)
+	}
+	if e.dir != mpssePinSCK|mpssePinMOSI|mpssePinCS || e.value&mpssePinCS == 0 {
+		t.Errorf("ADBUS value 0x%02X direction 0x%02X, want chip select released", e.value, e.dir)
+	}
+
+	f := flash.New(b.Conn, b.CS)
+	if _, _, err := f.ReadID(); err != nil {
+		t.Fatal(err)
+	}
+	want := []byte("written through the MPSSE")
+	if err := f.WriteAt(bytes.NewReader(want), 0x1000); err != nil {
+		t.Fatal(err)
+	}
+	got, err := f.Read(0x1000, len(want))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("read back %q, want %q", got, want)
+	}
+
+	// Asserting chip select goes with the transfer
+	e.writes = 0
+	if _, err := f.ReadStatusRegister(); err != nil {
+		t.Fatal(err)
+	}
+	if e.writes != 2 {
+		t.Errorf("status read in %d writes, want 2", e.writes)
+	}
+	if e.value&mpssePinCS == 0 {
+		t.Errorf("chip select left asserted")
+	}
+}
+
+func TestMPSSELongTx(t *testing.T) {
+	e := &mpsseChip{chip: flashtest.New(flashtest.W25Q128), fifo: mpsseHiSpeed.fifo}
+	b, err := OpenMPSSE(e, 30*physic.MegaHertz)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.lengths = nil
+	w := make([]byte, mpsseMaxBytes+10)
+	if err := b.Conn.Tx(w, nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(e.lengths) != 2 || e.lengths[0] != mpsseMaxBytes || e.lengths[1] != 10 {
+		t.Errorf("write commands of %v bytes, want [%d 10]", e.lengths, mpsseMaxBytes)
+	}
+
+	// Reads are split to fit the transmit buffer with the answer to the check
+	e.lengths = nil
+	chunk := mpsseHiSpeed.fifo - 2
+	r := make([]byte, 3*chunk+10)
+	if err := b.Conn.Tx(w[:4], r); err != nil {
+		t.Fatal(err)
+	}
+	if want := []int{chunk, chunk, chunk, 10}; !slices.Equal(e.lengths, want) {
+		t.Errorf("read commands of %v bytes, want %v", e.lengths, want)
+	}
+	if !bytes.Equal(r, bytes.Repeat([]byte{0xFF}, len(r))) {
+		t.Errorf("read other than the idle bus with chip select released")
+	}
+
+	// A whole flash read through the bounded buffer
+	data := make([]byte, 20000)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+	e.chip.Load(0x10000, data)
+	got, err := flash.New(b.Conn, b.CS).Read(0x10000, len(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Errorf("read back other data than loaded")
+	}
+}
+
+// purgedChip is an mpsseChip with the Purge method of the USB pipes.
+type purgedChip struct {
+	*mpsseChip
+	purges int
+}
+
+func (e *purgedChip) Purge() error {
+	e.purges++
+	e.out.Reset()
+	e.in = nil
+	return nil
+}
+
+func TestMPSSEResync(t *testing.T) {
+	for _, purge := range []bool{false, true} {
+		e := &mpsseChip{chip: flashtest.New(flashtest.W25Q128)}
+		var rw io.ReadWriter = e
+		p := &purgedChip{mpsseChip: e}
+		if purge {
+			rw = p
+		}
+		b, err := OpenMPSSE(rw, 30*physic.MegaHertz)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f := flash.New(b.Conn, b.CS)
+		// The answer to a command the chip did not understand
+		e.out.Write([]byte{mpsseBadCommand, 0x42})
+		if _, _, err := f.ReadID(); !errors.Is(err, ErrOutOfSync) {
+			t.Fatalf("purge %v: ReadID after a bad command: %v, want ErrOutOfSync", purge, err)
+		}
+		if purge && p.purges != 1 {
+			t.Errorf("purged %d times, want once", p.purges)
+		}
+		if e.selected() {
+			t.Errorf("purge %v: chip select left asserted", purge)
+		}
+		id, _, err := f.ReadID()
+		if err != nil {
+			t.Fatalf("purge %v: ReadID after resynchronizing: %v", purge, err)
+		}
+		if want := flashtest.W25Q128.ID; id != want {
+			t.Errorf("purge %v: ID %X after resynchronizing, want %X", purge, id, want)
+		}
+	}
+}
+
+func TestMPSSEFullSpeed(t *testing.T) {
+	e := &mpsseChip{chip: flashtest.New(flashtest.W25Q128), fifo: mpsseFullSpeed.fifo, fullSpeed: true}
+	b, err := openMPSSE(e, mpsseFullSpeed, 30*physic.MegaHertz)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.divisor != 0 {
+		t.Errorf("divisor = %d, want 0 for 6MHz", e.divisor)
+	}
+	if err := b.Port.LimitSpeed(physic.MegaHertz); err != nil {
+		t.Fatal(err)
+	}
+	if e.divisor != 5 {
+		t.Errorf("divisor = %d, want 5 for 1MHz", e.divisor)
+	}
+
+	data := bytes.Repeat([]byte("full speed"), 100)
+	e.chip.Load(0x2000, data)
+	e.lengths = nil
+	f := flash.New(b.Conn, b.CS)
+	got, err := f.Read(0x2000, len(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Errorf("read back other data than loaded")
+	}
+	for _, n := range e.lengths {
+		if n > mpsseFullSpeed.fifo-2 {
+			t.Errorf("read command of %d bytes, want at most %d", n, mpsseFullSpeed.fifo-2)
+		}
+	}
+}
+
+func TestMPSSEClock(t *testing.T) {
+	tests := []struct {
+		clock   physic.Frequency
+		divisor int
+	}{
+		{30 * physic.MegaHertz, 0},
+		{60 * physic.MegaHertz, 0},
+		{10 * physic.MegaHertz, 2},
+		{7 * physic.MegaHertz, 4}, // 6MHz
+		{physic.KiloHertz, 29999},
+		{100 * physic.Hertz, 0xFFFF},
+	}
+	for _, tt := range tests {
+		e := &mpsseChip{chip: flashtest.New(flashtest.W25Q128)}
+		if _, err := OpenMPSSE(e, tt.clock); err != nil {
+			t.Fatal(err)
+		}
+		if e.divisor != tt.divisor {
+			t.Errorf("%s: divisor = %d, want %d", tt.clock, e.divisor, tt.divisor)
+		}
+	}
+}
+
+func TestMPSSEPins(t *testing.T) {
+	e := &mpsseChip{chip: flashtest.New(flashtest.W25Q128)}
+	b, err := OpenMPSSE(e, 30*physic.MegaHertz)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Reset.Out(gpio.Low); err != nil {
+		t.Fatal(err)
+	}
+	if e.dir&mpssePinReset == 0 || e.value&mpssePinReset != 0 {
+		t.Errorf("reset not driven low: value 0x%02X direction 0x%02X", e.value, e.dir)
+	}
+	e.cdone = true
+	if l := b.CDone.Read(); l != gpio.High {
+		t.Errorf("CDONE = %s, want High", l)
+	}
+	if err := b.CS.In(gpio.PullNoChange, gpio.NoEdge); err != nil {
+		t.Fatal(err)
+	}
+	if e.dir&mpssePinCS != 0 {
+		t.Errorf("chip select still driven")
+	}
+	if n := b.CDone.Number(); n != 6 {
+		t.Errorf("CDONE is ADBUS%d, want ADBUS6", n)
+	}
+}
+
+func TestMPSSEClose(t *testing.T) {
+	e := &mpsseChip{chip: flashtest.New(flashtest.W25Q128)}
+	b, err := OpenMPSSE(e, 30*physic.MegaHertz)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Reset.Out(gpio.Low); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Port.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if e.dir != mpssePinReset || e.value&mpssePinReset != 0 {
+		t.Errorf("ADBUS value 0x%02X direction 0x%02X, want only the reset held low", e.value, e.dir)
+	}
+}
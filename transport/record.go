@@ -0,0 +1,192 @@
+package transport
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"periph.io/x/conn/v3"
+	"periph.io/x/conn/v3/spi"
+)
+
+// Recordings of RecordConn are JSON lines: a header describing the connection
+//
+//	{"duplex":"Full","max_tx":65536}
+//
+// followed by one line per transaction with the bytes written and read in hex.
+// Full-duplex transactions read as many bytes as they write.
+//
+//	{"w":"9f000000","r":"00ef7018"}
+type recordLine struct {
+	Duplex string `json:"duplex,omitempty"` // header only
+	MaxTx  int    `json:"max_tx,omitempty"` // header only; 0 if unlimited
+
+	W string `json:"w,omitempty"`
+	R string `json:"r,omitempty"`
+}
+
+// RecordConn returns a connection writing every transaction of c to w, so that
+// a session with real hardware can be served back by OpenReplay, e.g. for
+// regression tests or to reproduce the bug report of a user.
+func RecordConn(c spi.Conn, w io.Writer) spi.Conn {
+	return &recordConn{Conn: c, enc: json.NewEncoder(w)}
+}
+
+type recordConn struct {
+	spi.Conn
+	mu     sync.Mutex
+	enc    *json.Encoder
+	header bool // written
+}
+
+func (c *recordConn) Tx(w, r []byte) error {
+	// Full-duplex transfers overwrite w with what they read
+	sent := bytes.Clone(w)
+	err := c.Conn.Tx(w, r)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.header {
+		c.header = true
+		if encErr := c.enc.Encode(recordLine{Duplex: c.Conn.Duplex().String(), MaxTx: c.MaxTxSize()}); encErr != nil && err == nil {
+			err = encErr
+		}
+	}
+	if err != nil {
+		// The transaction is not recorded, as its result is unknown
+		return err
+	}
+	return c.enc.Encode(recordLine{W: hex.EncodeToString(sent), R: hex.EncodeToString(r)})
+}
+
+func (c *recordConn) TxPackets(p []spi.Packet) error {
+	for _, pkt := range p {
+		if err := c.Tx(pkt.W, pkt.R); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MaxTxSize implements conn.Limits.
+func (c *recordConn) MaxTxSize() int {
+	if l, ok := c.Conn.(conn.Limits); ok {
+		return l.MaxTxSize()
+	}
+	return 0
+}
+
+// ErrReplayMismatch is returned by a replayed connection when a transaction
+// differs from the recording.
+var ErrReplayMismatch = errors.New("transaction differs from the recording")
+
+// OpenReplay returns a bus serving back the transactions recorded by
+// RecordConn from r. Each transaction must write what was recorded, in the
+// same order, and reads what was recorded; anything else fails with
+// ErrReplayMismatch. The bus has no chip select, reset or CDONE lines.
+func OpenReplay(r io.Reader) (*Bus, error) {
+	c, err := NewReplay(r)
+	if err != nil {
+		return nil, err
+	}
+	return &Bus{Conn: c}, nil
+}
+
+// Replay is the connection of OpenReplay.
+type Replay struct {
+	mu     sync.Mutex
+	duplex conn.Duplex
+	maxTx  int
+	txs    []recordLine
+	next   int // index in txs of the next transaction
+}
+
+// NewReplay reads the recording of RecordConn from r.
+func NewReplay(r io.Reader) (*Replay, error) {
+	p := &Replay{duplex: conn.DuplexUnknown}
+	dec := json.NewDecoder(r)
+	for line := 1; ; line++ {
+		var l recordLine
+		if err := dec.Decode(&l); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("recording line %d: %w", line, err)
+		}
+		if l.Duplex != "" {
+			// Reopened connections write another header
+			if p.duplex == conn.DuplexUnknown {
+				p.duplex, p.maxTx = parseDuplex(l.Duplex), l.MaxTx
+			}
+			continue
+		}
+		p.txs = append(p.txs, l)
+	}
+	if p.duplex == conn.DuplexUnknown && len(p.txs) > 0 {
+		return nil, errors.New("recording has no header")
+	}
+	return p, nil
+}
+
+func parseDuplex(s string) conn.Duplex {
+	for _, d := range []conn.Duplex{conn.Half, conn.Full} {
+		if d.String() == s {
+			return d
+		}
+	}
+	return conn.DuplexUnknown
+}
+
+// Tx implements spi.Conn.
+func (p *Replay) Tx(w, r []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.next == len(p.txs) {
+		return fmt.Errorf("%w: transaction %d was not recorded", ErrReplayMismatch, p.next+1)
+	}
+	tx := p.txs[p.next]
+	want, err := hex.DecodeString(tx.W)
+	if err != nil {
+		return fmt.Errorf("recording transaction %d: %w", p.next+1, err)
+	}
+	read, err := hex.DecodeString(tx.R)
+	if err != nil {
+		return fmt.Errorf("recording transaction %d: %w", p.next+1, err)
+	}
+	if !bytes.Equal(w, want) || len(r) != len(read) {
+		return fmt.Errorf("%w: transaction %d writes [% x] and reads %d bytes, recorded [% x] and %d bytes",
+			ErrReplayMismatch, p.next+1, w[:min(len(w), 16)], len(r), want[:min(len(want), 16)], len(read))
+	}
+	copy(r, read)
+	p.next++
+	return nil
+}
+
+// TxPackets implements spi.Conn.
+func (p *Replay) TxPackets(pkts []spi.Packet) error {
+	for _, pkt := range pkts {
+		if err := p.Tx(pkt.W, pkt.R); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Remaining returns the number of recorded transactions not replayed yet, so
+// that tests can check that the whole recording was consumed.
+func (p *Replay) Remaining() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.txs) - p.next
+}
+
+// Duplex implements conn.Conn with the duplex of the recorded connection.
+func (p *Replay) Duplex() conn.Duplex { return p.duplex }
+
+// MaxTxSize implements conn.Limits with the limit of the recorded connection.
+func (p *Replay) MaxTxSize() int { return p.maxTx }
+
+func (p *Replay) String() string { return "replay" }
@@ -0,0 +1,107 @@
+package transport
+
+import (
+	"bytes"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/gentam/gice/flash"
+	"github.com/gentam/gice/flash/flashtest"
+)
+
+// session runs flash commands over f, returning what the flash answered.
+func session(f *flash.Flash) ([][]byte, error) {
+	var out [][]byte
+	id, _, err := f.ReadID()
+	if err != nil {
+		return nil, err
+	}
+	out = append(out, id[:])
+	if err := f.WriteAt(bytes.NewReader([]byte("recorded session")), 0x1000); err != nil {
+		return nil, err
+	}
+	for _, addr := range []int{0, 0x1000} {
+		b, err := f.Read(addr, 32)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, b)
+	}
+	return out, nil
+}
+
+func TestRecordReplay(t *testing.T) {
+	v, err := OpenVirtual(filepath.Join(t.TempDir(), "flash.bin"), flashtest.W25Q128, flashtest.Timing{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer v.Close()
+	var rec bytes.Buffer
+	b := v.Bus(0)
+	want, err := session(flash.New(RecordConn(b.Conn, &rec), b.CS))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(want[2], []byte("recorded session")) {
+		t.Fatalf("read back [% x] from the virtual flash", want[2])
+	}
+
+	t.Run("same session", func(t *testing.T) {
+		p, err := NewReplay(bytes.NewReader(rec.Bytes()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := session(flash.New(p, nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := range want {
+			if !bytes.Equal(got[i], want[i]) {
+				t.Errorf("answer %d = [% x], recorded [% x]", i, got[i], want[i])
+			}
+		}
+		if n := p.Remaining(); n != 0 {
+			t.Errorf("%d transactions not replayed", n)
+		}
+	})
+
+	tests := []struct {
+		name string
+		run  func(f *flash.Flash) error
+	}{
+		{"other command", func(f *flash.Flash) error {
+			_, err := f.ReadStatusRegister()
+			return err
+		}},
+		{"other address", func(f *flash.Flash) error {
+			if _, _, err := f.ReadID(); err != nil {
+				return err
+			}
+			return f.WriteAt(bytes.NewReader([]byte("recorded session")), 0x2000)
+		}},
+		{"other length", func(f *flash.Flash) error {
+			id := make([]byte, 5)
+			id[0] = 0x9F
+			return f.Tx(id, 1)
+		}},
+		{"past the recording", func(f *flash.Flash) error {
+			if _, err := session(f); err != nil {
+				return err
+			}
+			_, _, err := f.ReadID()
+			return err
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := NewReplay(bytes.NewReader(rec.Bytes()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := tt.run(flash.New(p, nil)); !errors.Is(err, ErrReplayMismatch) {
+				t.Errorf("got %v, want %v", err, ErrReplayMismatch)
+			}
+		})
+	}
+}
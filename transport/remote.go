@@ -0,0 +1,255 @@
+package transport
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"periph.io/x/conn/v3"
+	"periph.io/x/conn/v3/gpio"
+	"periph.io/x/conn/v3/physic"
+	"periph.io/x/conn/v3/spi"
+)
+
+// Remote protocol between OpenRemote and ServeRemote. Every request is
+//
+//	op (1 byte) | pin (1 byte) | length (uint32 BE) | payload
+//
+// and is answered with
+//
+//	status (1 byte) | length (uint32 BE) | payload
+//
+// where a non-zero status carries an error message as payload.
+const (
+	remoteOpTx       = 0x01 // full-duplex SPI transfer of the payload
+	remoteOpOut      = 0x02 // drive the pin to payload[0]
+	remoteOpIn       = 0x03 // set the pin as input
+	remoteOpRead     = 0x04 // read the pin level
+	remoteOpFunction = 0x05 // read the pin function
+	remoteOpBoard    = 0x06 // read the board profile name
+
+	remoteStatusOK    = 0x00
+	remoteStatusError = 0x01
+
+	remotePinCS    = 0
+	remotePinReset = 1
+	remotePinCDone = 2
+
+	remoteMaxPayload = 1 << 20
+)
+
+// OpenRemote connects to a bus served by ServeRemote (gice remoted) over rw,
+// typically a TCP connection to a host the board is attached to. It also
+// returns the name of the board profile of the server, if any. The protocol has
+// no authentication; use it on trusted networks only.
+func OpenRemote(rw io.ReadWriter) (*Bus, string, error) {
+	c := &remoteClient{rw: rw, r: bufio.NewReader(rw)}
+	name, err := c.call(remoteOpBoard, 0, nil)
+	if err != nil {
+		return nil, "", fmt.Errorf("remote: %w", err)
+	}
+	b := &Bus{
+		Conn:  &remoteConn{c},
+		CS:    &remotePin{c: c, n: remotePinCS, name: "CS"},
+		Reset: &remotePin{c: c, n: remotePinReset, name: "CRESET"},
+		CDone: &remotePin{c: c, n: remotePinCDone, name: "CDONE"},
+	}
+	return b, string(name), nil
+}
+
+type remoteClient struct {
+	rw io.ReadWriter
+	r  *bufio.Reader
+}
+
+func (c *remoteClient) call(op, pin byte, payload []byte) ([]byte, error) {
+	req := make([]byte, 6, 6+len(payload))
+	req[0] = op
+	req[1] = pin
+	binary.BigEndian.PutUint32(req[2:], uint32(len(payload)))
+	if _, err := c.rw.Write(append(req, payload...)); err != nil {
+		return nil, err
+	}
+	status, resp, err := readRemoteFrame(c.r)
+	if err != nil {
+		return nil, err
+	}
+	if status != remoteStatusOK {
+		return nil, errors.New(string(resp))
+	}
+	return resp, nil
+}
+
+// readRemoteFrame reads a header byte followed by a length-prefixed payload.
+func readRemoteFrame(r io.Reader) (byte, []byte, error) {
+	hdr := make([]byte, 5)
+	if _, err := io.ReadFull(r, hdr); err != nil {
+		return 0, nil, err
+	}
+	n := binary.BigEndian.Uint32(hdr[1:])
+	if n > remoteMaxPayload {
+		return 0, nil, fmt.Errorf("remote frame too large (%d bytes)", n)
+	}
+	payload := make([]byte, n)
+	_, err := io.ReadFull(r, payload)
+	return hdr[0], payload, err
+}
+
+// remoteConn is a full-duplex spi.Conn forwarding transfers to the server.
+type remoteConn struct{ c *remoteClient }
+
+func (rc *remoteConn) String() string { return "remote" }
+
+func (rc *remoteConn) Duplex() conn.Duplex { return conn.Full }
+
+// MaxTxSize implements conn.Limits.
+func (rc *remoteConn) MaxTxSize() int { return remoteMaxPayload }
+
+func (rc *remoteConn) Tx(w, r []byte) error {
+	resp, err := rc.c.call(remoteOpTx, 0, w)
+	if err != nil {
+		return err
+	}
+	copy(r, resp)
+	return nil
+}
+
+func (rc *remoteConn) TxPackets(p []spi.Packet) error {
+	for _, pkt := range p {
+		if err := rc.Tx(pkt.W, pkt.R); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// remotePin is a gpio.PinIO of the server.
+type remotePin struct {
+	c    *remoteClient
+	n    byte
+	name string
+}
+
+func (p *remotePin) String() string { return "remote " + p.name }
+func (p *remotePin) Halt() error    { return nil }
+func (p *remotePin) Name() string   { return p.name }
+func (p *remotePin) Number() int    { return int(p.n) }
+
+func (p *remotePin) Function() string {
+	f, err := p.c.call(remoteOpFunction, p.n, nil)
+	if err != nil {
+		return "ERR"
+	}
+	return string(f)
+}
+
+func (p *remotePin) In(pull gpio.Pull, edge gpio.Edge) error {
+	_, err := p.c.call(remoteOpIn, p.n, nil)
+	return err
+}
+
+func (p *remotePin) Read() gpio.Level {
+	l, err := p.c.call(remoteOpRead, p.n, nil)
+	return err == nil && len(l) == 1 && l[0] != 0
+}
+
+func (p *remotePin) WaitForEdge(timeout time.Duration) bool { return false }
+func (p *remotePin) Pull() gpio.Pull                        { return gpio.PullNoChange }
+func (p *remotePin) DefaultPull() gpio.Pull                 { return gpio.PullNoChange }
+
+func (p *remotePin) Out(l gpio.Level) error {
+	v := byte(0)
+	if l {
+		v = 1
+	}
+	_, err := p.c.call(remoteOpOut, p.n, []byte{v})
+	return err
+}
+
+func (p *remotePin) PWM(gpio.Duty, physic.Frequency) error {
+	return errors.New("remote pins do not support PWM")
+}
+
+// ServeRemote answers requests of an OpenRemote client read from rw with the
+// bus b until rw is closed. Transfers are split into chunks of at most maxTx
+// bytes, and boardName is reported as the board profile.
+func ServeRemote(rw io.ReadWriter, b *Bus, boardName string, maxTx int) error {
+	r := bufio.NewReader(rw)
+	for {
+		hdr := make([]byte, 1)
+		if _, err := io.ReadFull(r, hdr); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		// The rest of a request has the layout of a response frame
+		pin, payload, err := readRemoteFrame(r)
+		if err != nil {
+			return err
+		}
+
+		status := byte(remoteStatusOK)
+		resp, err := b.serveRemoteOp(hdr[0], pin, payload, boardName, maxTx)
+		if err != nil {
+			status = remoteStatusError
+			resp = []byte(err.Error())
+		}
+		frame := make([]byte, 5, 5+len(resp))
+		frame[0] = status
+		binary.BigEndian.PutUint32(frame[1:], uint32(len(resp)))
+		if _, err := rw.Write(append(frame, resp...)); err != nil {
+			return err
+		}
+	}
+}
+
+func (b *Bus) serveRemoteOp(op, pin byte, payload []byte, boardName string, maxTx int) ([]byte, error) {
+	if op == remoteOpTx {
+		// Split transfers longer than the limit of the server; chip select is
+		// held by the client around them
+		for off := 0; off < len(payload); off += maxTx {
+			chunk := payload[off:min(off+maxTx, len(payload))]
+			if err := b.Conn.Tx(chunk, chunk); err != nil {
+				return nil, err
+			}
+		}
+		return payload, nil
+	}
+	if op == remoteOpBoard {
+		return []byte(boardName), nil
+	}
+
+	var p gpio.PinIO
+	switch pin {
+	case remotePinCS:
+		p = b.CS
+	case remotePinReset:
+		p = b.Reset
+	case remotePinCDone:
+		p = b.CDone
+	}
+	if p == nil {
+		return nil, fmt.Errorf("pin %d not available", pin)
+	}
+	switch op {
+	case remoteOpOut:
+		if len(payload) != 1 {
+			return nil, errors.New("invalid level")
+		}
+		return nil, p.Out(gpio.Level(payload[0] != 0))
+	case remoteOpIn:
+		return nil, p.In(gpio.PullNoChange, gpio.NoEdge)
+	case remoteOpRead:
+		if p.Read() == gpio.High {
+			return []byte{1}, nil
+		}
+		return []byte{0}, nil
+	case remoteOpFunction:
+		return []byte(p.Function()), nil
+	}
+	return nil, fmt.Errorf("unknown op 0x%02X", op)
+}
@@ -0,0 +1,211 @@
+package transport
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"periph.io/x/conn/v3"
+	"periph.io/x/conn/v3/physic"
+	"periph.io/x/conn/v3/spi"
+)
+
+// serprog commands. [serprog]
+const (
+	serprogAck = 0x06
+	serprogNak = 0x15
+
+	serprogCmdQIface    = 0x01 // query interface version
+	serprogCmdQCmdMap   = 0x02 // query supported commands
+	serprogCmdQBusType  = 0x05 // query supported bus types
+	serprogCmdQWrNMax   = 0x08 // query maximum write-n length
+	serprogCmdSyncNop   = 0x10 // special no-operation returning NAK+ACK
+	serprogCmdQRdNMax   = 0x11 // query maximum read-n length
+	serprogCmdSBusType  = 0x12 // set used bus type
+	serprogCmdOSPIOp    = 0x13 // perform SPI operation
+	serprogCmdSSPIFreq  = 0x14 // set SPI clock frequency
+	serprogCmdSPinState = 0x15 // enable/disable output drivers
+
+	serprogBusSPI = 1 << 3
+)
+
+// OpenSerprog connects to a programmer speaking the flashrom serprog protocol
+// over rw, e.g. the serial port of a Raspberry Pi Pico running pico-serprog,
+// and sets its SPI clock if supported.
+//
+// Serprog has no FPGA reset or CDONE lines: the FPGA must be kept in reset by
+// other means while the flash is accessed, and Bus.Release only disables the
+// output drivers of the programmer.
+func OpenSerprog(rw io.ReadWriter, clock physic.Frequency) (*Bus, error) {
+	c := &serprogConn{rw: rw, r: bufio.NewReader(rw)}
+	if err := c.sync(); err != nil {
+		return nil, fmt.Errorf("serprog: %w", err)
+	}
+
+	resp := make([]byte, 32)
+	if err := c.cmd(serprogCmdQIface, nil, resp[:2]); err != nil {
+		return nil, fmt.Errorf("serprog: query interface version: %w", err)
+	}
+	if v := binary.LittleEndian.Uint16(resp); v != 1 {
+		return nil, fmt.Errorf("serprog: unsupported interface version %d", v)
+	}
+	if err := c.cmd(serprogCmdQCmdMap, nil, resp); err != nil {
+		return nil, fmt.Errorf("serprog: query commands: %w", err)
+	}
+	copy(c.cmdMap[:], resp)
+	for _, cmd := range []byte{serprogCmdSBusType, serprogCmdOSPIOp} {
+		if !c.supports(cmd) {
+			return nil, fmt.Errorf("serprog: programmer lacks command 0x%02X", cmd)
+		}
+	}
+	if c.supports(serprogCmdQBusType) {
+		if err := c.cmd(serprogCmdQBusType, nil, resp[:1]); err != nil {
+			return nil, fmt.Errorf("serprog: query bus types: %w", err)
+		}
+		if resp[0]&serprogBusSPI == 0 {
+			return nil, errors.New("serprog: programmer does not support SPI")
+		}
+	}
+	if err := c.cmd(serprogCmdSBusType, []byte{serprogBusSPI}, nil); err != nil {
+		return nil, fmt.Errorf("serprog: set bus type: %w", err)
+	}
+	var err error
+	if c.maxWrite, err = c.queryMaxLen(serprogCmdQWrNMax); err != nil {
+		return nil, fmt.Errorf("serprog: query maximum write length: %w", err)
+	}
+	if c.maxRead, err = c.queryMaxLen(serprogCmdQRdNMax); err != nil {
+		return nil, fmt.Errorf("serprog: query maximum read length: %w", err)
+	}
+	if c.supports(serprogCmdSSPIFreq) {
+		if err := c.cmd(serprogCmdSSPIFreq, binary.LittleEndian.AppendUint32(nil, uint32(clock/physic.Hertz)), resp[:4]); err != nil {
+			return nil, fmt.Errorf("serprog: set SPI frequency: %w", err)
+		}
+	}
+	if err := c.setPinState(true); err != nil {
+		return nil, err
+	}
+	return &Bus{Conn: c, Release: func() error { return c.setPinState(false) }}, nil
+}
+
+// serprogConn is a half-duplex spi.Conn over the serprog protocol. The
+// programmer drives chip select for each operation.
+type serprogConn struct {
+	rw     io.ReadWriter
+	r      *bufio.Reader
+	cmdMap [32]byte
+
+	maxWrite, maxRead int
+}
+
+func (c *serprogConn) String() string { return "serprog" }
+
+func (c *serprogConn) Duplex() conn.Duplex { return conn.Half }
+
+// MaxTxSize implements conn.Limits.
+func (c *serprogConn) MaxTxSize() int { return min(c.maxWrite, c.maxRead) }
+
+// Tx sends w and then reads len(r) bytes within a single chip select.
+func (c *serprogConn) Tx(w, r []byte) error {
+	args := make([]byte, 6, 6+len(w))
+	putUint24(args[0:], len(w))
+	putUint24(args[3:], len(r))
+	return c.cmd(serprogCmdOSPIOp, append(args, w...), r)
+}
+
+func (c *serprogConn) TxPackets(p []spi.Packet) error {
+	for _, pkt := range p {
+		if err := c.Tx(pkt.W, pkt.R); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setPinState enables the output drivers, or disables them so the FPGA can
+// access the flash.
+func (c *serprogConn) setPinState(enable bool) error {
+	if !c.supports(serprogCmdSPinState) {
+		return nil
+	}
+	state := byte(0)
+	if enable {
+		state = 1
+	}
+	if err := c.cmd(serprogCmdSPinState, []byte{state}, nil); err != nil {
+		return fmt.Errorf("serprog: set pin state: %w", err)
+	}
+	return nil
+}
+
+func (c *serprogConn) supports(cmd byte) bool { return c.cmdMap[cmd/8]&(1<<(cmd%8)) != 0 }
+
+// cmd sends the command with its arguments and reads the ACK and len(resp)
+// bytes of response.
+func (c *serprogConn) cmd(cmd byte, args, resp []byte) error {
+	if _, err := c.rw.Write(append([]byte{cmd}, args...)); err != nil {
+		return err
+	}
+	ack, err := c.r.ReadByte()
+	if err != nil {
+		return err
+	}
+	switch ack {
+	case serprogAck:
+	case serprogNak:
+		return fmt.Errorf("command 0x%02X rejected", cmd)
+	default:
+		return fmt.Errorf("command 0x%02X: unexpected response 0x%02X", cmd, ack)
+	}
+	_, err = io.ReadFull(c.r, resp)
+	return err
+}
+
+// queryMaxLen returns the maximum length reported by the command, where 0
+// means the protocol limit of 2^24 bytes.
+func (c *serprogConn) queryMaxLen(cmd byte) (int, error) {
+	const protocolMax = 1 << 24
+	if !c.supports(cmd) {
+		return protocolMax, nil
+	}
+	resp := make([]byte, 3)
+	if err := c.cmd(cmd, nil, resp); err != nil {
+		return 0, err
+	}
+	if n := int(resp[0]) | int(resp[1])<<8 | int(resp[2])<<16; n != 0 {
+		return n, nil
+	}
+	return protocolMax, nil
+}
+
+// sync discards pending output of the programmer by waiting for the NAK+ACK
+// answer of S_SYNCNOP.
+func (c *serprogConn) sync() error {
+	const syncTimeout = 2 * time.Second
+	if d, ok := c.rw.(interface{ SetReadDeadline(time.Time) error }); ok {
+		if err := d.SetReadDeadline(time.Now().Add(syncTimeout)); err == nil {
+			defer d.SetReadDeadline(time.Time{})
+		}
+	}
+	if _, err := c.rw.Write([]byte{serprogCmdSyncNop}); err != nil {
+		return err
+	}
+	for prev := byte(0); ; {
+		b, err := c.r.ReadByte()
+		if err != nil {
+			return fmt.Errorf("synchronize: %w", err)
+		}
+		if prev == serprogNak && b == serprogAck {
+			return nil
+		}
+		prev = b
+	}
+}
+
+func putUint24(b []byte, v int) {
+	b[0] = byte(v)
+	b[1] = byte(v >> 8)
+	b[2] = byte(v >> 16)
+}
@@ -0,0 +1,170 @@
+package transport
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+
+	"periph.io/x/conn/v3/physic"
+)
+
+// serprog commands only used by the server. [serprog]
+const (
+	serprogCmdNop      = 0x00 // no operation
+	serprogCmdQPgmName = 0x03 // query programmer name
+	serprogCmdQSerBuf  = 0x04 // query serial buffer size
+)
+
+// serprogOpHeader is the room left in a transaction for the opcode, address
+// and dummy bytes written before a read of the advertised maximum length.
+const serprogOpHeader = 16
+
+// serprogServed lists the commands implemented by ServeSerprog.
+var serprogServed = []byte{
+	serprogCmdNop,
+	serprogCmdQIface,
+	serprogCmdQCmdMap,
+	serprogCmdQPgmName,
+	serprogCmdQSerBuf,
+	serprogCmdQBusType,
+	serprogCmdQWrNMax,
+	serprogCmdSyncNop,
+	serprogCmdQRdNMax,
+	serprogCmdSBusType,
+	serprogCmdOSPIOp,
+	serprogCmdSSPIFreq,
+	serprogCmdSPinState,
+}
+
+// SerprogTarget is the flash served by ServeSerprog.
+type SerprogTarget interface {
+	// Tx sends the first n bytes of buf and reads the response into the rest
+	// within a single chip select.
+	Tx(buf []byte, n int) error
+
+	// MaxTxSize returns the maximum size of a transaction.
+	MaxTxSize() int
+
+	// Clock returns the SPI clock frequency.
+	Clock() physic.Frequency
+
+	// SetPinState gives the flash to the programmer when enabled, e.g. by
+	// holding the FPGA in reset, and hands it back to the FPGA otherwise.
+	SetPinState(enable bool) error
+}
+
+// ServeSerprog answers serprog commands read from rw with the target t until
+// rw is closed, so that flashrom can access the flash through gice.
+func ServeSerprog(rw io.ReadWriter, t SerprogTarget) error {
+	r := bufio.NewReader(rw)
+	var cmdMap [32]byte
+	for _, cmd := range serprogServed {
+		cmdMap[cmd/8] |= 1 << (cmd % 8)
+	}
+	// flashrom writes the command of a read of max read-n bytes in the same
+	// transaction, and likewise for writes
+	maxLen := make([]byte, 3)
+	putUint24(maxLen, t.MaxTxSize()-serprogOpHeader)
+
+	for {
+		cmd, err := r.ReadByte()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		var resp []byte
+		ok := true
+		switch cmd {
+		case serprogCmdNop:
+		case serprogCmdQIface:
+			resp = []byte{1, 0}
+		case serprogCmdQCmdMap:
+			resp = cmdMap[:]
+		case serprogCmdQPgmName:
+			resp = make([]byte, 16)
+			copy(resp, "gice")
+		case serprogCmdQSerBuf:
+			resp = []byte{0xFF, 0xFF}
+		case serprogCmdQBusType:
+			resp = []byte{serprogBusSPI}
+		case serprogCmdQWrNMax, serprogCmdQRdNMax:
+			resp = maxLen
+		case serprogCmdSyncNop:
+			if _, err := rw.Write([]byte{serprogNak}); err != nil {
+				return err
+			}
+		case serprogCmdSBusType:
+			arg, err := readN(r, 1)
+			if err != nil {
+				return err
+			}
+			ok = arg[0]&serprogBusSPI != 0
+		case serprogCmdOSPIOp:
+			if resp, err = serveSPIOp(r, t); err != nil {
+				if !errors.As(err, &spiOpError{}) {
+					return err
+				}
+				ok = false
+			}
+		case serprogCmdSSPIFreq:
+			if _, err := readN(r, 4); err != nil {
+				return err
+			}
+			// The clock is set when connecting; report the actual one
+			resp = binary.LittleEndian.AppendUint32(nil, uint32(t.Clock()/physic.Hertz))
+		case serprogCmdSPinState:
+			arg, err := readN(r, 1)
+			if err != nil {
+				return err
+			}
+			ok = t.SetPinState(arg[0] != 0) == nil
+		default:
+			ok = false
+		}
+
+		if !ok {
+			if _, err := rw.Write([]byte{serprogNak}); err != nil {
+				return err
+			}
+			continue
+		}
+		if _, err := rw.Write(append([]byte{serprogAck}, resp...)); err != nil {
+			return err
+		}
+	}
+}
+
+// spiOpError is a failed O_SPIOP, answered with NAK rather than ending the
+// session.
+type spiOpError struct{ error }
+
+func serveSPIOp(r io.Reader, t SerprogTarget) ([]byte, error) {
+	args, err := readN(r, 6)
+	if err != nil {
+		return nil, err
+	}
+	slen := int(args[0]) | int(args[1])<<8 | int(args[2])<<16
+	rlen := int(args[3]) | int(args[4])<<8 | int(args[5])<<16
+	w, err := readN(r, slen)
+	if err != nil {
+		return nil, err
+	}
+	if slen+rlen > t.MaxTxSize() {
+		return nil, spiOpError{errors.New("SPI operation too long")}
+	}
+	buf := append(w, make([]byte, rlen)...)
+	if err := t.Tx(buf, slen); err != nil {
+		return nil, spiOpError{err}
+	}
+	return buf[slen:], nil
+}
+
+func readN(r io.Reader, n int) ([]byte, error) {
+	buf := make([]byte, n)
+	_, err := io.ReadFull(r, buf)
+	return buf, err
+}
@@ -0,0 +1,96 @@
+package transport
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/gentam/gice/flash/flashtest"
+	"periph.io/x/conn/v3/physic"
+)
+
+// serprogChip serves a flashtest.Chip over serprog.
+type serprogChip struct {
+	*flashtest.Chip
+	maxTx int
+}
+
+func (c serprogChip) Tx(buf []byte, n int) error    { return c.Chip.Tx(buf, buf) }
+func (c serprogChip) MaxTxSize() int                { return c.maxTx }
+func (c serprogChip) Clock() physic.Frequency       { return physic.MegaHertz }
+func (c serprogChip) SetPinState(enable bool) error { return nil }
+
+func TestServeSerprogMaxLen(t *testing.T) {
+	chip := flashtest.New(flashtest.W25Q128)
+	want := make([]byte, 4096)
+	for i := range want {
+		want[i] = byte(i * 7)
+	}
+	chip.Load(0, want)
+
+	client, server := net.Pipe()
+	defer client.Close()
+	go ServeSerprog(server, serprogChip{chip, 1024})
+	r := bufio.NewReader(client)
+	cmd := func(b ...byte) byte {
+		t.Helper()
+		if _, err := client.Write(b); err != nil {
+			t.Fatal(err)
+		}
+		ack, err := r.ReadByte()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ack
+	}
+	readN := func(n int) []byte {
+		t.Helper()
+		buf := make([]byte, n)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			t.Fatal(err)
+		}
+		return buf
+	}
+
+	limits := map[byte]int{}
+	for _, q := range []byte{serprogCmdQWrNMax, serprogCmdQRdNMax} {
+		if ack := cmd(q); ack != serprogAck {
+			t.Fatalf("query 0x%02X: got 0x%02X", q, ack)
+		}
+		b := readN(3)
+		limits[q] = int(b[0]) | int(b[1])<<8 | int(b[2])<<16
+	}
+
+	tests := []struct {
+		name       string
+		slen, rlen int
+		ok         bool
+	}{
+		{"read of max read-n", 4, limits[serprogCmdQRdNMax], true},
+		{"write of max write-n", limits[serprogCmdQWrNMax], 0, true},
+		{"beyond the transaction size", 4, 1024 - 3, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := make([]byte, tt.slen)
+			if tt.rlen > 0 {
+				w[0] = 0x03 // read from 0
+			}
+			args := []byte{serprogCmdOSPIOp}
+			args = append(args, byte(tt.slen), byte(tt.slen>>8), byte(tt.slen>>16))
+			args = append(args, byte(tt.rlen), byte(tt.rlen>>8), byte(tt.rlen>>16))
+			ack := cmd(append(args, w...)...)
+			if got := ack == serprogAck; got != tt.ok {
+				t.Fatalf("got 0x%02X, want ACK %v", ack, tt.ok)
+			}
+			if !tt.ok {
+				return
+			}
+			if got := readN(tt.rlen); !bytes.Equal(got, want[:tt.rlen]) {
+				t.Errorf("read back differs from the flash content")
+			}
+		})
+	}
+}
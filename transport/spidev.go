@@ -0,0 +1,70 @@
+package transport
+
+import (
+	"fmt"
+
+	"periph.io/x/conn/v3/gpio"
+	"periph.io/x/conn/v3/gpio/gpioreg"
+	"periph.io/x/conn/v3/physic"
+	"periph.io/x/conn/v3/spi"
+	"periph.io/x/conn/v3/spi/spireg"
+)
+
+// SPIDevPins names the GPIO lines wired to the iCE40 board when the flash is
+// connected directly to an SPI controller, e.g. "GPIO25" on a Raspberry Pi.
+//
+// CS must be a plain GPIO rather than the chip select of the SPI controller,
+// as it has to be held high while the FPGA leaves reset and then released for
+// the FPGA to drive.
+type SPIDevPins struct {
+	CS    string // iCE_SS_B
+	Reset string // iCE_CRESET
+	CDone string // iCE_CDONE
+}
+
+// OpenSPIDev opens the SPI port (e.g. "/dev/spidev0.0") at the clock and the
+// GPIO character device lines given by pins, for a single board computer wired
+// directly to the board.
+func OpenSPIDev(port string, pins SPIDevPins, clock physic.Frequency) (*Bus, error) {
+	b := &Bus{}
+	if err := b.lookupPins(pins); err != nil {
+		return nil, err
+	}
+
+	p, err := spireg.Open(port)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open SPI port %q: %w", port, err)
+	}
+	// Chip select is driven through b.CS, see SPIDevPins
+	b.Conn, err = p.Connect(clock, spi.Mode0|spi.NoCS, 8)
+	if err != nil {
+		p.Close()
+		return nil, fmt.Errorf("SPI port %q: %w", port, err)
+	}
+	b.Port = p
+	return b, nil
+}
+
+// lookupPins sets the chip select and FPGA configuration pins of the bus.
+func (b *Bus) lookupPins(pins SPIDevPins) error {
+	var err error
+	if b.CS, err = lookupGPIO("CS", pins.CS); err != nil {
+		return err
+	}
+	if b.Reset, err = lookupGPIO("reset", pins.Reset); err != nil {
+		return err
+	}
+	b.CDone, err = lookupGPIO("CDONE", pins.CDone)
+	return err
+}
+
+func lookupGPIO(function, name string) (gpio.PinIO, error) {
+	if name == "" {
+		return nil, fmt.Errorf("no GPIO given for %s", function)
+	}
+	p := gpioreg.ByName(name)
+	if p == nil {
+		return nil, fmt.Errorf("GPIO %q for %s not found", name, function)
+	}
+	return p, nil
+}
@@ -0,0 +1,90 @@
+package transport
+
+import "fmt"
+
+// USBDevice is an FTDI chip with an MPSSE found by USBDevices.
+type USBDevice struct {
+	Type     string // chip type, e.g. "FT2232H"
+	Product  string // USB product string, the EEPROM description
+	Serial   string // USB serial number
+	Channels int    // interfaces with an MPSSE, from channel A
+
+	path      string // device node
+	sysfs     string // device directory in sysfs
+	fullSpeed bool   // the MPSSE is mpsseFullSpeed
+}
+
+func (d USBDevice) String() string {
+	return fmt.Sprintf("%s %q (serial %q)", d.Type, d.Product, d.Serial)
+}
+
+// FTDIChip describes an FTDI chip with an MPSSE.
+type FTDIChip struct {
+	Name     string // e.g. "FT2232H"
+	Channels int    // interfaces having an MPSSE, from channel A
+
+	fullSpeed bool // the MPSSE is mpsseFullSpeed, not mpsseHiSpeed
+}
+
+// ftdiChips lists the FTDI chips with an MPSSE by USB product ID: only
+// channels A and B of the quad chips have one. [FTDI-AN_135]
+var ftdiChips = map[uint16]FTDIChip{
+	0x6010: {Name: "FT2232H", Channels: 2},
+	0x6011: {Name: "FT4232H", Channels: 2},
+	0x6014: {Name: "FT232H", Channels: 1},
+	0x6040: {Name: "FT2233HP", Channels: 2},
+	0x6041: {Name: "FT4233HP", Channels: 2},
+	0x6042: {Name: "FT2232HP", Channels: 2},
+	0x6043: {Name: "FT4232HP", Channels: 2},
+	0x6048: {Name: "FT4232HA", Channels: 2},
+}
+
+// ft2232D is the full-speed FT2232C/D/L, which has the product ID of the
+// FT2232H and an older device release number.
+var ft2232D = FTDIChip{Name: "FT2232D", Channels: 2, fullSpeed: true}
+
+// LookupFTDIChip returns the Hi-Speed FTDI chip with an MPSSE having the USB
+// product ID pid.
+func LookupFTDIChip(pid uint16) (FTDIChip, bool) {
+	t, ok := ftdiChips[pid]
+	return t, ok
+}
+
+// usbChipType returns the chip with the USB product ID and device release
+// number (bcdDevice), including the FT2232D.
+func usbChipType(pid, release uint16) (FTDIChip, bool) {
+	const releaseFT2232H = 0x0700
+	if pid == 0x6010 && release < releaseFT2232H {
+		return ft2232D, true
+	}
+	return LookupFTDIChip(pid)
+}
+
+const usbVendorFTDI = 0x0403
+
+// FTDI vendor requests and bit modes. [FTDI-AN_135]
+const (
+	ftdiReqReset      = 0x00 // wValue 0 resets the interface, 1 and 2 purge the RX and TX buffers
+	ftdiReqSetFlow    = 0x02
+	ftdiReqSetEvent   = 0x06
+	ftdiReqSetError   = 0x07
+	ftdiReqSetLatency = 0x09
+	ftdiReqSetBitMode = 0x0B // wValue is the pin mask and the mode << 8
+
+	ftdiFlowRTSCTS = 0x0100 // in wIndex
+
+	ftdiBitModeReset = 0x00
+	ftdiBitModeMPSSE = 0x02
+)
+
+// appendPackets appends the data of the packets received from the IN endpoint
+// of an FTDI interface to dst, stripping the 2 modem status bytes that start
+// every packet. [FTDI-AN_232B-04]
+func appendPackets(dst, in []byte, maxPacket int) []byte {
+	for off := 0; off < len(in); off += maxPacket {
+		if pkt := in[off:min(off+maxPacket, len(in))]; len(pkt) > 2 {
+			dst = append(dst, pkt[2:]...)
+		}
+	}
+	return dst
+}
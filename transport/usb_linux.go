@@ -0,0 +1,290 @@
+//go:build !(mips || mipsle || mips64 || mips64le || ppc64 || ppc64le)
+
+package transport
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"periph.io/x/conn/v3/physic"
+)
+
+// usbfs ioctls, with the asm-generic encoding of linux/usbdevice_fs.h; MIPS
+// and POWER use another one.
+var (
+	usbdevfsControl          = iowr('U', 0, unsafe.Sizeof(usbCtrlTransfer{}))
+	usbdevfsBulk             = iowr('U', 2, unsafe.Sizeof(usbBulkTransfer{}))
+	usbdevfsClaimInterface   = ior('U', 15, 4)
+	usbdevfsReleaseInterface = ior('U', 16, 4)
+	usbdevfsIoctl            = iowr('U', 18, unsafe.Sizeof(usbIoctl{}))
+	usbdevfsDisconnect       = uintptr('U'<<8 | 22)
+	usbdevfsConnect          = uintptr('U'<<8 | 23)
+)
+
+func ior(typ, nr, size uintptr) uintptr  { return 2<<30 | size<<16 | typ<<8 | nr }
+func iowr(typ, nr, size uintptr) uintptr { return 3<<30 | size<<16 | typ<<8 | nr }
+
+// usbCtrlTransfer is struct usbdevfs_ctrltransfer.
+type usbCtrlTransfer struct {
+	requestType, request uint8
+	value, index, length uint16
+	timeout              uint32 // ms
+	data                 unsafe.Pointer
+}
+
+// usbBulkTransfer is struct usbdevfs_bulktransfer.
+type usbBulkTransfer struct {
+	ep, length, timeout uint32
+	data                unsafe.Pointer
+}
+
+// usbIoctl is struct usbdevfs_ioctl.
+type usbIoctl struct {
+	ifno, code int32
+	data       unsafe.Pointer
+}
+
+// USBAvailable tells whether OpenUSB is implemented on this platform.
+const USBAvailable = true
+
+// USBDevices lists the attached FTDI chips with an MPSSE, as found in sysfs.
+func USBDevices() ([]USBDevice, error) {
+	return usbDevices("/sys/bus/usb/devices")
+}
+
+func usbDevices(sysfs string) ([]USBDevice, error) {
+	entries, err := os.ReadDir(sysfs)
+	if errors.Is(err, os.ErrNotExist) {
+		// No USB host controller
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var devs []USBDevice
+	for _, e := range entries {
+		// Interfaces are named like 1-1:1.0
+		if strings.Contains(e.Name(), ":") {
+			continue
+		}
+		dir := filepath.Join(sysfs, e.Name())
+		attr := func(name string) string {
+			b, _ := os.ReadFile(filepath.Join(dir, name))
+			return strings.TrimSpace(string(b))
+		}
+		vid, _ := strconv.ParseUint(attr("idVendor"), 16, 16)
+		pid, _ := strconv.ParseUint(attr("idProduct"), 16, 16)
+		release, _ := strconv.ParseUint(attr("bcdDevice"), 16, 16)
+		t, ok := usbChipType(uint16(pid), uint16(release))
+		if vid != usbVendorFTDI || !ok {
+			continue
+		}
+		bus, err1 := strconv.Atoi(attr("busnum"))
+		dev, err2 := strconv.Atoi(attr("devnum"))
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		devs = append(devs, USBDevice{
+			Type:      t.Name,
+			Product:   attr("product"),
+			Serial:    attr("serial"),
+			Channels:  t.Channels,
+			path:      fmt.Sprintf("/dev/bus/usb/%03d/%03d", bus, dev),
+			sysfs:     dir,
+			fullSpeed: t.fullSpeed,
+		})
+	}
+	return devs, nil
+}
+
+// OpenUSB claims the interface of channel (0 for A) of dev through Linux
+// usbfs, detaching the ftdi_sio serial driver from it, and drives its MPSSE
+// with OpenMPSSE over bulk transfers of its own rather than through the FTDI
+// driver of periph, so that chips the driver does not model can be used. The
+// USB latency timer is set to latency, rounded to milliseconds: the chip
+// sends incomplete packets of answers after that long. Bus.Port releases the
+// interface back to the serial driver. The full-speed FT2232D clocks SPI at
+// 6MHz at most.
+func OpenUSB(dev USBDevice, channel int, clock physic.Frequency, latency time.Duration) (*Bus, error) {
+	if channel < 0 || channel >= dev.Channels {
+		return nil, fmt.Errorf("usb: %s has no MPSSE on channel %c", dev.Type, 'A'+rune(channel))
+	}
+	fd, err := syscall.Open(dev.path, syscall.O_RDWR|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, fmt.Errorf("usb: open %s: %w", dev.path, err)
+	}
+	p := &usbPipe{fd: fd, ifno: channel, maxPacket: 512}
+	if dev.fullSpeed {
+		p.maxPacket = 64
+	}
+	if s, err := os.ReadFile(fmt.Sprintf("%s:1.%d/ep_%02x/wMaxPacketSize", dev.sysfs, channel, p.epIn())); err == nil {
+		if n, err := strconv.ParseUint(strings.TrimSpace(string(s)), 16, 16); err == nil && n > 2 {
+			p.maxPacket = int(n)
+		}
+	}
+	if err := p.claim(); err != nil {
+		syscall.Close(fd)
+		return nil, fmt.Errorf("usb: %s: %w", dev, err)
+	}
+	if err := p.setup(latency); err != nil {
+		p.Close()
+		return nil, fmt.Errorf("usb: %s: %w", dev, err)
+	}
+	model := mpsseHiSpeed
+	if dev.fullSpeed {
+		model = mpsseFullSpeed
+	}
+	b, err := openMPSSE(p, model, clock)
+	if err != nil {
+		p.Close()
+		return nil, err
+	}
+	return b, nil
+}
+
+// usbPipe is the byte stream of an FTDI interface over usbfs bulk transfers.
+type usbPipe struct {
+	fd        int
+	ifno      int
+	maxPacket int    // of the IN endpoint, which starts every packet with 2 status bytes
+	in        []byte // bulk IN buffer
+	buf       []byte // data received and not read yet
+}
+
+func (p *usbPipe) epIn() int  { return 0x81 + 2*p.ifno }
+func (p *usbPipe) epOut() int { return 0x02 + 2*p.ifno }
+
+func (p *usbPipe) ioctl(req uintptr, arg unsafe.Pointer) (int, error) {
+	n, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(p.fd), req, uintptr(arg))
+	if errno != 0 {
+		return 0, errno
+	}
+	return int(n), nil
+}
+
+// claim detaches the kernel driver from the interface and claims it.
+func (p *usbPipe) claim() error {
+	detach := usbIoctl{ifno: int32(p.ifno), code: int32(usbdevfsDisconnect)}
+	// ENODATA: no driver is bound
+	if _, err := p.ioctl(usbdevfsIoctl, unsafe.Pointer(&detach)); err != nil && err != syscall.ENODATA {
+		return fmt.Errorf("detach the kernel driver: %w", err)
+	}
+	ifno := uint32(p.ifno)
+	if _, err := p.ioctl(usbdevfsClaimInterface, unsafe.Pointer(&ifno)); err != nil {
+		if err == syscall.EBUSY {
+			return fmt.Errorf("claim interface %d: %w; is it opened by another program?", p.ifno, err)
+		}
+		return fmt.Errorf("claim interface %d: %w", p.ifno, err)
+	}
+	return nil
+}
+
+// control sends a vendor request to the interface.
+func (p *usbPipe) control(req uint8, value uint16, index uint16) error {
+	const vendorOut = 0x40
+	c := usbCtrlTransfer{
+		requestType: vendorOut,
+		request:     req,
+		value:       value,
+		index:       index | uint16(p.ifno+1),
+		timeout:     1000,
+	}
+	_, err := p.ioctl(usbdevfsControl, unsafe.Pointer(&c))
+	return err
+}
+
+// setup resets the interface and puts it in MPSSE mode. [FTDI-AN_135]
+func (p *usbPipe) setup(latency time.Duration) error {
+	steps := []struct {
+		name         string
+		req          uint8
+		value, index uint16
+	}{
+		{"reset", ftdiReqReset, 0, 0},
+		{"purge RX buffer", ftdiReqReset, 1, 0},
+		{"purge TX buffer", ftdiReqReset, 2, 0},
+		{"disable event character", ftdiReqSetEvent, 0, 0},
+		{"disable error character", ftdiReqSetError, 0, 0},
+		{"set latency timer", ftdiReqSetLatency, uint16(latencyMS(latency)), 0},
+		{"set flow control", ftdiReqSetFlow, 0, ftdiFlowRTSCTS},
+		{"reset bit mode", ftdiReqSetBitMode, ftdiBitModeReset << 8, 0},
+		{"enter MPSSE mode", ftdiReqSetBitMode, ftdiBitModeMPSSE << 8, 0},
+	}
+	for _, s := range steps {
+		if err := p.control(s.req, s.value, s.index); err != nil {
+			return fmt.Errorf("%s: %w", s.name, err)
+		}
+	}
+	// Let the MPSSE settle before the synchronization
+	time.Sleep(50 * time.Millisecond)
+	return nil
+}
+
+// Read returns the data received, stripping the status bytes of the packets.
+// The chip answers with status bytes only until the data is ready.
+func (p *usbPipe) Read(b []byte) (int, error) {
+	const timeout = 5 * time.Second
+	deadline := time.Now().Add(timeout)
+	if p.in == nil {
+		p.in = make([]byte, 32*p.maxPacket)
+	}
+	in := p.in
+	for len(p.buf) == 0 {
+		if time.Now().After(deadline) {
+			return 0, errors.New("read timeout")
+		}
+		t := usbBulkTransfer{ep: uint32(p.epIn()), length: uint32(len(in)), timeout: 1000, data: unsafe.Pointer(&in[0])}
+		n, err := p.ioctl(usbdevfsBulk, unsafe.Pointer(&t))
+		if err != nil {
+			return 0, err
+		}
+		p.buf = appendPackets(p.buf, in[:n], p.maxPacket)
+	}
+	n := copy(b, p.buf)
+	p.buf = p.buf[n:]
+	return n, nil
+}
+
+func (p *usbPipe) Write(b []byte) (int, error) {
+	// Older kernels limit bulk transfers to 16KB
+	const maxWrite = 16 << 10
+	for off := 0; off < len(b); {
+		chunk := b[off:min(off+maxWrite, len(b))]
+		t := usbBulkTransfer{ep: uint32(p.epOut()), length: uint32(len(chunk)), timeout: 5000, data: unsafe.Pointer(&chunk[0])}
+		n, err := p.ioctl(usbdevfsBulk, unsafe.Pointer(&t))
+		if err != nil {
+			return off, err
+		}
+		off += n
+	}
+	return len(b), nil
+}
+
+// Purge discards the data in the buffers of the chip and the answers received
+// and not read yet.
+func (p *usbPipe) Purge() error {
+	for _, v := range []uint16{1, 2} {
+		if err := p.control(ftdiReqReset, v, 0); err != nil {
+			return err
+		}
+	}
+	p.buf = nil
+	return nil
+}
+
+// Close releases the interface and lets the kernel driver bind to it again.
+// The MPSSE keeps driving the pins as they were left.
+func (p *usbPipe) Close() error {
+	ifno := uint32(p.ifno)
+	p.ioctl(usbdevfsReleaseInterface, unsafe.Pointer(&ifno))
+	attach := usbIoctl{ifno: int32(p.ifno), code: int32(usbdevfsConnect)}
+	p.ioctl(usbdevfsIoctl, unsafe.Pointer(&attach))
+	return syscall.Close(p.fd)
+}
@@ -0,0 +1,56 @@
+//go:build !(mips || mipsle || mips64 || mips64le || ppc64 || ppc64le)
+
+package transport
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestUSBDevices(t *testing.T) {
+	sysfs := t.TempDir()
+	devices := map[string]map[string]string{
+		"1-1": {"idVendor": "0403", "idProduct": "6010", "bcdDevice": "0700", "busnum": "1", "devnum": "5", "product": "iCEBreaker V1.0e", "serial": "ib1"},
+		"1-2": {"idVendor": "0403", "idProduct": "6014", "busnum": "1", "devnum": "7", "product": "FT232H MPSSE"},
+		// An FT2232D, with the product ID of the FT2232H
+		"1-4": {"idVendor": "0403", "idProduct": "6010", "bcdDevice": "0500", "busnum": "1", "devnum": "9", "product": "Dual RS232"},
+		// An FT232R, without MPSSE
+		"1-3":     {"idVendor": "0403", "idProduct": "6001", "busnum": "1", "devnum": "8"},
+		"2-1":     {"idVendor": "1d6b", "idProduct": "0002", "busnum": "2", "devnum": "1"},
+		"1-1:1.0": {"bInterfaceNumber": "00"},
+	}
+	for name, attrs := range devices {
+		dir := filepath.Join(sysfs, name)
+		if err := os.Mkdir(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		for k, v := range attrs {
+			if err := os.WriteFile(filepath.Join(dir, k), []byte(v+"\n"), 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	devs, err := usbDevices(sysfs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []USBDevice{
+		{Type: "FT2232H", Product: "iCEBreaker V1.0e", Serial: "ib1", Channels: 2, path: "/dev/bus/usb/001/005", sysfs: filepath.Join(sysfs, "1-1")},
+		{Type: "FT232H", Product: "FT232H MPSSE", Channels: 1, path: "/dev/bus/usb/001/007", sysfs: filepath.Join(sysfs, "1-2")},
+		{Type: "FT2232D", Product: "Dual RS232", Channels: 2, path: "/dev/bus/usb/001/009", sysfs: filepath.Join(sysfs, "1-4"), fullSpeed: true},
+	}
+	if len(devs) != len(want) {
+		t.Fatalf("found %v, want %v", devs, want)
+	}
+	for i := range want {
+		if devs[i] != want[i] {
+			t.Errorf("device %d = %+v, want %+v", i, devs[i], want[i])
+		}
+	}
+
+	if devs, err := usbDevices(filepath.Join(sysfs, "missing")); err != nil || len(devs) != 0 {
+		t.Errorf("without sysfs: %v, %v; want no device", devs, err)
+	}
+}
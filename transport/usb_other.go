@@ -0,0 +1,23 @@
+//go:build !linux || mips || mipsle || mips64 || mips64le || ppc64 || ppc64le
+
+package transport
+
+import (
+	"errors"
+	"time"
+
+	"periph.io/x/conn/v3/physic"
+)
+
+// USBAvailable tells whether OpenUSB is implemented on this platform.
+const USBAvailable = false
+
+var errNoUSB = errors.New("usb: raw USB access is only implemented with Linux usbfs")
+
+// USBDevices returns an error: raw USB access is only implemented on Linux.
+func USBDevices() ([]USBDevice, error) { return nil, errNoUSB }
+
+// OpenUSB returns an error: raw USB access is only implemented on Linux.
+func OpenUSB(dev USBDevice, channel int, clock physic.Frequency, latency time.Duration) (*Bus, error) {
+	return nil, errNoUSB
+}
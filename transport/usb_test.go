@@ -0,0 +1,50 @@
+package transport
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestAppendPackets(t *testing.T) {
+	tests := []struct {
+		name string
+		in   []byte
+		want []byte
+	}{
+		{"nothing", nil, nil},
+		{"status only", []byte{0x32, 0x60}, nil},
+		{"one packet", []byte{0x32, 0x60, 1, 2}, []byte{1, 2}},
+		{"full packets", []byte{0x32, 0x60, 1, 2, 3, 4, 0x32, 0x60, 5, 6, 7, 8}, []byte{1, 2, 3, 4, 5, 6, 7, 8}},
+		{"short last packet", []byte{0x32, 0x60, 1, 2, 3, 4, 0x32, 0x60, 5}, []byte{1, 2, 3, 4, 5}},
+		{"status only last packet", []byte{0x32, 0x60, 1, 2, 3, 4, 0x32, 0x60}, []byte{1, 2, 3, 4}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := appendPackets(nil, tt.in, 6)
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("appendPackets = [% x], want [% x]", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUSBChipType(t *testing.T) {
+	tests := []struct {
+		pid, release uint16
+		name         string
+		channels     int
+	}{
+		{0x6010, 0x0700, "FT2232H", 2},
+		{0x6010, 0x0500, "FT2232D", 2},
+		{0x6011, 0x0800, "FT4232H", 2},
+		{0x6014, 0x0900, "FT232H", 1},
+		{0x6048, 0x3600, "FT4232HA", 2},
+		{0x6001, 0x0600, "", 0}, // FT232R, without MPSSE
+	}
+	for _, tt := range tests {
+		c, ok := usbChipType(tt.pid, tt.release)
+		if ok != (tt.name != "") || c.Name != tt.name || c.Channels != tt.channels {
+			t.Errorf("usbChipType(0x%04X, 0x%04X) = %+v, %v; want %s with %d channels", tt.pid, tt.release, c, ok, tt.name, tt.channels)
+		}
+	}
+}
@@ -0,0 +1,242 @@
+package transport
+
+import (
+	"bytes"
+	"cmp"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gentam/gice/bitstream"
+	"github.com/gentam/gice/flash/flashtest"
+	"periph.io/x/conn/v3"
+	"periph.io/x/conn/v3/gpio"
+	"periph.io/x/conn/v3/physic"
+	"periph.io/x/conn/v3/spi"
+)
+
+// Virtual is a board simulated in memory whose flash content is the file it
+// was opened from: every program and erase is written through to the file, so
+// that the whole CLI can be exercised without hardware, e.g. in tutorials or
+// CI. The flash is a flashtest.Chip; the FPGA configures itself when its reset
+// is released if the flash, or the SRAM bitstream sent with chip select held
+// low, starts with a valid bitstream.
+type Virtual struct {
+	mu     sync.Mutex
+	chip   *flashtest.Chip
+	file   *os.File
+	err    error // first error writing the file
+	cs     gpio.Level
+	reset  gpio.Level
+	sram   bool   // the FPGA is in SPI peripheral mode, receiving a bitstream
+	loaded []byte // bitstream received in SPI peripheral mode
+	done   bool   // CDONE, when booted from the flash
+}
+
+// OpenVirtual opens the image file at path as the flash of a virtual board,
+// creating it if needed. A file shorter than the flash is padded with erased
+// bytes. The chip reports busy after each operation as set by timing, which
+// may be flashtest.W25Q128Timing for the program and erase times of a real
+// chip.
+func OpenVirtual(path string, m flashtest.Model, timing flashtest.Timing) (*Virtual, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if len(data) > m.Size {
+		f.Close()
+		return nil, fmt.Errorf("%s: %d bytes exceed the flash size %d", path, len(data), m.Size)
+	}
+	if n := len(data); n < m.Size {
+		if _, err := f.WriteAt(bytes.Repeat([]byte{0xFF}, m.Size-n), int64(n)); err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+
+	v := &Virtual{chip: flashtest.New(m), file: f, cs: gpio.High, reset: gpio.High}
+	v.chip.Timing = timing
+	v.chip.Load(0, data)
+	v.chip.OnChange = func(addr int, data []byte) {
+		if _, err := f.WriteAt(data, int64(addr)); err != nil {
+			v.mu.Lock()
+			v.err = cmp.Or(v.err, err)
+			v.mu.Unlock()
+		}
+	}
+	v.done = bitstreamAt(data)
+	return v, nil
+}
+
+// Bus returns the bus of the board. Transfers take as long as they would at
+// clock; 0 disables the delay. Buses returned by successive calls share the
+// state of the board.
+func (v *Virtual) Bus(clock physic.Frequency) *Bus {
+	return &Bus{
+		Conn:  &virtualConn{v: v, clock: clock},
+		CS:    &virtualPin{v: v, n: remotePinCS, name: "CS"},
+		Reset: &virtualPin{v: v, n: remotePinReset, name: "CRESET"},
+		CDone: &virtualPin{v: v, n: remotePinCDone, name: "CDONE"},
+	}
+}
+
+// Close closes the image file. The flash content is already written to it.
+func (v *Virtual) Close() error {
+	return v.file.Close()
+}
+
+// bitstreamAt reports whether the FPGA configures itself from data.
+func bitstreamAt(data []byte) bool {
+	_, err := bitstream.Parse(data)
+	return err == nil
+}
+
+type virtualConn struct {
+	v     *Virtual
+	clock physic.Frequency
+}
+
+func (c *virtualConn) String() string      { return "virtual " + c.v.file.Name() }
+func (c *virtualConn) Duplex() conn.Duplex { return conn.Full }
+
+// Tx implements spi.Conn. The FPGA receives the transfer in SPI peripheral
+// mode, and the flash otherwise.
+func (c *virtualConn) Tx(w, r []byte) error {
+	if c.clock > 0 {
+		time.Sleep(time.Duration(8*max(len(w), len(r))) * c.clock.Period())
+	}
+	v := c.v
+	v.mu.Lock()
+	if v.sram {
+		if v.cs == gpio.Low {
+			v.loaded = append(v.loaded, w...)
+		}
+		v.mu.Unlock()
+		// The FPGA does not drive the bus
+		fill(r, 0xFF)
+		return nil
+	}
+	v.mu.Unlock()
+
+	if err := v.chip.Tx(w, r); err != nil {
+		return err
+	}
+	// OnChange runs during Tx with the lock of the chip held
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if err := v.err; err != nil {
+		v.err = nil
+		return fmt.Errorf("write %s: %w", v.file.Name(), err)
+	}
+	return nil
+}
+
+// TxPackets implements spi.Conn.
+func (c *virtualConn) TxPackets(p []spi.Packet) error {
+	for _, pkt := range p {
+		if err := c.Tx(pkt.W, pkt.R); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func fill(b []byte, v byte) {
+	for i := range b {
+		b[i] = v
+	}
+}
+
+// virtualPin is a gpio.PinIO of a Virtual board.
+type virtualPin struct {
+	v    *Virtual
+	n    byte
+	name string
+}
+
+func (p *virtualPin) String() string { return "virtual " + p.name }
+func (p *virtualPin) Halt() error    { return nil }
+func (p *virtualPin) Name() string   { return p.name }
+func (p *virtualPin) Number() int    { return int(p.n) }
+
+func (p *virtualPin) Function() string {
+	if p.n == remotePinCDone {
+		return "In/" + p.Read().String()
+	}
+	return "Out/" + p.Read().String()
+}
+
+// In releases chip select, which the board pulls up.
+func (p *virtualPin) In(pull gpio.Pull, edge gpio.Edge) error {
+	if p.n == remotePinCS {
+		return p.Out(gpio.High)
+	}
+	return nil
+}
+
+func (p *virtualPin) Read() gpio.Level {
+	v := p.v
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	switch p.n {
+	case remotePinCS:
+		return v.cs
+	case remotePinReset:
+		return v.reset
+	}
+	if v.reset == gpio.Low {
+		return gpio.Low
+	}
+	if v.sram {
+		return gpio.Level(bitstreamAt(v.loaded))
+	}
+	return gpio.Level(v.done)
+}
+
+func (p *virtualPin) WaitForEdge(timeout time.Duration) bool { return false }
+func (p *virtualPin) Pull() gpio.Pull                        { return gpio.PullNoChange }
+func (p *virtualPin) DefaultPull() gpio.Pull                 { return gpio.PullNoChange }
+
+func (p *virtualPin) Out(l gpio.Level) error {
+	v := p.v
+	switch p.n {
+	case remotePinCS:
+		v.mu.Lock()
+		v.cs = l
+		v.mu.Unlock()
+	case remotePinReset:
+		v.mu.Lock()
+		rising := v.reset == gpio.Low && l == gpio.High
+		v.reset = l
+		// The FPGA samples chip select when leaving reset
+		v.sram = rising && v.cs == gpio.Low || v.sram && l == gpio.High
+		if rising {
+			v.loaded = nil
+		}
+		sram := v.sram
+		v.mu.Unlock()
+		if rising && !sram {
+			// Read the flash without the lock, as writing through to the file
+			// takes it while the chip is locked
+			done := bitstreamAt(v.chip.Bytes())
+			v.mu.Lock()
+			v.done = done
+			v.mu.Unlock()
+		}
+	default:
+		return errors.New("CDONE is an input")
+	}
+	return nil
+}
+
+func (p *virtualPin) PWM(gpio.Duty, physic.Frequency) error {
+	return errors.New("virtual pins do not support PWM")
+}
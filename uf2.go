@@ -0,0 +1,116 @@
+package gice
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+
+	"github.com/gentam/gice/flash"
+)
+
+// UF2 block layout. [UF2]
+const (
+	uf2BlockSize   = 512
+	uf2MagicStart0 = 0x0A324655 // "UF2\n"
+	uf2MagicStart1 = 0x9E5D5157
+	uf2MagicEnd    = 0x0AB16F30
+	uf2MaxPayload  = 476
+
+	uf2FlagNotMainFlash = 0x00000001
+	uf2FlagFamilyID     = 0x00002000
+)
+
+// IsUF2 reports whether data starts with a UF2 block.
+func IsUF2(data []byte) bool {
+	return len(data) >= uf2BlockSize &&
+		binary.LittleEndian.Uint32(data[0:]) == uf2MagicStart0 &&
+		binary.LittleEndian.Uint32(data[4:]) == uf2MagicStart1
+}
+
+// ParseUF2 decodes a UF2 file into regions at the target addresses of its
+// blocks, merging contiguous blocks. Blocks flagged as not for the main flash
+// are skipped. If family is non-zero, blocks carrying a different family ID
+// are skipped; otherwise the file must not mix several families.
+func ParseUF2(data []byte, family uint32) ([]Region, error) {
+	if len(data)%uf2BlockSize != 0 {
+		return nil, fmt.Errorf("UF2 size %d is not a multiple of %d", len(data), uf2BlockSize)
+	}
+
+	type block struct {
+		addr int
+		data []byte
+	}
+	blocks := []block{}
+	families := map[uint32]bool{}
+	for off := 0; off < len(data); off += uf2BlockSize {
+		b := data[off : off+uf2BlockSize]
+		le := binary.LittleEndian
+		if le.Uint32(b[0:]) != uf2MagicStart0 || le.Uint32(b[4:]) != uf2MagicStart1 ||
+			le.Uint32(b[508:]) != uf2MagicEnd {
+			return nil, fmt.Errorf("block %d: invalid magic", off/uf2BlockSize)
+		}
+		flags := le.Uint32(b[8:])
+		addr := le.Uint32(b[12:])
+		size := le.Uint32(b[16:])
+		if flags&uf2FlagNotMainFlash != 0 {
+			continue
+		}
+		if flags&uf2FlagFamilyID != 0 {
+			id := le.Uint32(b[28:])
+			if family != 0 && id != family {
+				continue
+			}
+			families[id] = true
+		}
+		if size > uf2MaxPayload {
+			return nil, fmt.Errorf("block %d: payload size %d exceeds %d", off/uf2BlockSize, size, uf2MaxPayload)
+		}
+		blocks = append(blocks, block{int(addr), b[32 : 32+size]})
+	}
+	if family == 0 && len(families) > 1 {
+		return nil, errors.New("UF2 contains several family IDs; select one")
+	}
+	if len(blocks) == 0 {
+		return nil, errors.New("UF2 contains no blocks for the flash")
+	}
+
+	slices.SortStableFunc(blocks, func(a, b block) int { return a.addr - b.addr })
+	regions := []Region{}
+	for _, b := range blocks {
+		regions = flash.AppendRegion(regions, b.addr, b.data)
+	}
+	return regions, nil
+}
+
+// WriteUF2 encodes data to be placed at addr as UF2 blocks of 256 bytes. If
+// family is non-zero, it is stored in every block.
+func WriteUF2(w io.Writer, addr int, data []byte, family uint32) error {
+	const payloadSize = 256
+	numBlocks := (len(data) + payloadSize - 1) / payloadSize
+	b := make([]byte, uf2BlockSize)
+	le := binary.LittleEndian
+	for i := range numBlocks {
+		clear(b)
+		chunk := data[i*payloadSize : min((i+1)*payloadSize, len(data))]
+		le.PutUint32(b[0:], uf2MagicStart0)
+		le.PutUint32(b[4:], uf2MagicStart1)
+		if family != 0 {
+			le.PutUint32(b[8:], uf2FlagFamilyID)
+			le.PutUint32(b[28:], family)
+		} else {
+			le.PutUint32(b[28:], uint32(len(data)))
+		}
+		le.PutUint32(b[12:], uint32(addr+i*payloadSize))
+		le.PutUint32(b[16:], uint32(len(chunk)))
+		le.PutUint32(b[20:], uint32(i))
+		le.PutUint32(b[24:], uint32(numBlocks))
+		copy(b[32:], chunk)
+		le.PutUint32(b[508:], uf2MagicEnd)
+		if _, err := w.Write(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,26 @@
+package gice
+
+import (
+	"bytes"
+	"testing"
+)
+
+func FuzzParseUF2(f *testing.F) {
+	for _, family := range []uint32{0, 0xE48BFF56} {
+		var buf bytes.Buffer
+		WriteUF2(&buf, 0x1000, bytes.Repeat([]byte{0xA5}, 300), family)
+		f.Add(buf.Bytes(), family)
+	}
+	f.Add(make([]byte, uf2BlockSize), uint32(0))
+	f.Fuzz(func(t *testing.T, data []byte, family uint32) {
+		regions, err := ParseUF2(data, family)
+		if err != nil {
+			return
+		}
+		checkRegions(t, regions, func(r Region) ([]byte, error) {
+			var buf bytes.Buffer
+			err := WriteUF2(&buf, r.Addr, r.Data, family)
+			return buf.Bytes(), err
+		}, func(b []byte) ([]Region, error) { return ParseUF2(b, family) })
+	})
+}